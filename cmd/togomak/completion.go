@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"github.com/srevinsaju/togomak/v1/internal/orchestra"
+	"github.com/urfave/cli/v2"
+	"os"
+	"strings"
+)
+
+// The completion scripts complete subcommands and flags through urfave/cli's
+// --generate-bash-completion, and the filters and addresses through the hidden
+// __complete command, which reads the pipeline in the directory passed with --dir or --file
+
+const bashCompletion = `# bash completion for togomak
+_togomak() {
+  local cur prev opts i
+  local -a pipeline
+  cur="${COMP_WORDS[COMP_CWORD]}"
+  prev="${COMP_WORDS[COMP_CWORD-1]}"
+  case "$prev" in
+    -C|--dir|--directory|-f|--file)
+      COMPREPLY=($(compgen -f -- "$cur"))
+      return
+      ;;
+  esac
+  for ((i = 1; i < COMP_CWORD - 1; i++)); do
+    case "${COMP_WORDS[i]}" in
+      -C|--dir|--directory|-f|--file) pipeline+=("${COMP_WORDS[i]}" "${COMP_WORDS[i+1]}") ;;
+    esac
+  done
+  if [[ "$cur" == -* ]]; then
+    opts=$("${COMP_WORDS[@]:0:COMP_CWORD}" "$cur" --generate-bash-completion 2>/dev/null)
+  else
+    opts=$("${COMP_WORDS[@]:0:COMP_CWORD}" --generate-bash-completion 2>/dev/null)
+    opts+=$'\n'$("${COMP_WORDS[0]}" "${pipeline[@]}" __complete -- "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null)
+  fi
+  COMPREPLY=($(compgen -W "$opts" -- "$cur"))
+}
+complete -o default -F _togomak togomak
+`
+
+const zshCompletion = `#compdef togomak
+_togomak() {
+  local cur=${words[CURRENT]} prev=${words[CURRENT-1]} i
+  local -a opts pipeline
+  case $prev in
+    -C|--dir|--directory|-f|--file)
+      _files
+      return
+      ;;
+  esac
+  for ((i = 2; i < CURRENT - 1; i++)); do
+    case ${words[i]} in
+      -C|--dir|--directory|-f|--file) pipeline+=(${words[i]} ${words[i+1]}) ;;
+    esac
+  done
+  if [[ $cur == -* ]]; then
+    opts=("${(@f)$(${words[@]:0:CURRENT-1} $cur --generate-bash-completion 2>/dev/null)}")
+  else
+    opts=("${(@f)$(${words[@]:0:CURRENT-1} --generate-bash-completion 2>/dev/null)}")
+    opts+=("${(@f)$(${words[1]} ${pipeline[@]} __complete -- ${words[@]:1:CURRENT-1} 2>/dev/null)}")
+  fi
+  opts=(${opts:#})
+  compadd -- $opts
+}
+compdef _togomak togomak
+`
+
+const fishCompletion = `# fish completion for togomak
+function __togomak_complete
+    set -l words (commandline -opc)
+    set -l cur (commandline -ct)
+    set -l args
+    set -l pipeline
+    if test (count $words) -gt 1
+        set args $words[2..-1]
+    end
+    for i in (seq 2 (math (count $words) - 1))
+        switch $words[$i]
+            case -C --dir --directory -f --file
+                set -a pipeline $words[$i] $words[(math $i + 1)]
+        end
+    end
+    if string match -q -- '-*' $cur
+        $words $cur --generate-bash-completion 2>/dev/null
+    else
+        $words --generate-bash-completion 2>/dev/null
+        $words[1] $pipeline __complete -- $args $cur 2>/dev/null
+    end
+end
+complete -c togomak -f -a '(__togomak_complete)'
+`
+
+// completionScripts are the completion scripts printed by togomak completion
+var completionScripts = map[string]string{
+	"bash": bashCompletion,
+	"zsh":  zshCompletion,
+	"fish": fishCompletion,
+}
+
+// completeCommands are the commands which accept filters, or the address of a block
+// in the case of describe, as arguments
+var completeCommands = map[string]bool{
+	"":         true,
+	"run":      true,
+	"plan":     true,
+	"watch":    true,
+	"graph":    true,
+	"describe": true,
+}
+
+func completion(ctx *cli.Context) error {
+	script, ok := completionScripts[ctx.Args().First()]
+	if ctx.NArg() != 1 || !ok {
+		return cli.Exit("completion expects the name of the shell: bash, zsh or fish", 1)
+	}
+	fmt.Print(script)
+	return nil
+}
+
+// complete is the hidden command used by the completion scripts. Its arguments are the
+// words typed after togomak, the last of which is being completed
+func complete(ctx *cli.Context) error {
+	words := ctx.Args().Slice()
+	prefix := ""
+	if len(words) != 0 {
+		prefix = words[len(words)-1]
+		words = words[:len(words)-1]
+	}
+
+	command := ""
+	for _, word := range words {
+		if c := ctx.App.Command(word); c != nil {
+			command = c.Name
+			break
+		}
+	}
+	if !completeCommands[command] || strings.HasPrefix(prefix, "-") {
+		return nil
+	}
+
+	cfg := newConfigFromCliContextArgs(ctx, nil)
+	cfg.Logging.Stderr = true
+	os.Exit(orchestra.Complete(cfg, command, prefix))
+	return nil
+}
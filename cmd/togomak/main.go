@@ -11,12 +11,16 @@ import (
 	"github.com/srevinsaju/togomak/v1/internal/global"
 	"github.com/srevinsaju/togomak/v1/internal/logging"
 	"github.com/srevinsaju/togomak/v1/internal/meta"
+	"github.com/srevinsaju/togomak/v1/internal/metrics"
 	"github.com/srevinsaju/togomak/v1/internal/orchestra"
 	"github.com/srevinsaju/togomak/v1/internal/path"
+	"github.com/srevinsaju/togomak/v1/internal/profile"
 	"github.com/srevinsaju/togomak/v1/internal/rules"
 	"github.com/urfave/cli/v2"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 )
 
 var verboseCount = 0
@@ -34,6 +38,7 @@ func main() {
 	app.Description = meta.AppDescription
 	app.Action = run
 	app.Version = fmt.Sprintf("%s (%s, %s)", version, commit, date)
+	app.EnableBashCompletion = true
 
 	app.Commands = []*cli.Command{
 		{
@@ -49,9 +54,139 @@ func main() {
 		},
 		{
 			Name:    "list",
-			Usage:   "list all the pipelines",
+			Usage:   "list the blocks of the pipeline",
 			Aliases: []string{"ls", "l"},
 			Action:  list,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "type",
+					Usage: "only list blocks of the given type: stage, module, macro, variable, data, local or import",
+				},
+				&cli.StringFlag{
+					Name:  "phase",
+					Usage: "only list the stages and modules which run in the given lifecycle phase",
+				},
+				&cli.BoolFlag{
+					Name:  "json",
+					Usage: "write the list as json",
+				},
+			},
+		},
+		{
+			Name:      "watch",
+			Usage:     "run the pipeline, and rerun the stages whose watch patterns match the files which changed",
+			ArgsUsage: "[filters...]",
+			Action:    watch,
+			Flags: []cli.Flag{
+				&cli.DurationFlag{
+					Name:  "debounce",
+					Usage: "how long to wait for more changes before rerunning the affected stages",
+					Value: 300 * time.Millisecond,
+				},
+			},
+		},
+		{
+			Name:      "describe",
+			Usage:     "show the evaluated configuration of a block, like stage.build or module.api[\"prod\"]",
+			ArgsUsage: "<address>",
+			Action:    describe,
+		},
+		{
+			Name:   "plan",
+			Usage:  "show which stages and modules would run, and the rule which decided it, without running them",
+			Action: plan,
+		},
+		{
+			Name:   "validate",
+			Usage:  "check the pipeline for errors, without running it",
+			Action: validate,
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  "json",
+					Usage: "write the diagnostics as json",
+				},
+			},
+		},
+		{
+			Name:   "graph",
+			Usage:  "print the dependency graph of the pipeline",
+			Action: graph,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "format",
+					Usage: fmt.Sprintf("output format of the graph, one of %s", strings.Join(ci.GraphFormats, ", ")),
+					Value: ci.GraphFormatDot,
+				},
+				&cli.BoolFlag{
+					Name:  "hide-internal",
+					Usage: "hide the togomak.root, togomak.pre and togomak.post nodes",
+				},
+				&cli.BoolFlag{
+					Name:  "collapse",
+					Usage: "collapse all the nodes of the same block type into a single node",
+				},
+			},
+		},
+		{
+			Name:      "logs",
+			Usage:     "list the recorded runs, the stages of a run, or show the output of its stages",
+			ArgsUsage: "[run-id|latest] [stage]",
+			Action:    logs,
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:    "follow",
+					Aliases: []string{"f"},
+					Usage:   "write the output as it is written, until the run finishes",
+				},
+				&cli.IntFlag{
+					Name:    "tail",
+					Aliases: []string{"n"},
+					Usage:   "only show the last lines of the output of each stage",
+				},
+			},
+		},
+		{
+			Name:   "lock",
+			Usage:  "fetch the remote sources of the imports and the modules, and record their commits and hashes in togomak.lock.hcl",
+			Action: lock,
+		},
+		{
+			Name:   "get",
+			Usage:  "fetch the remote sources of the imports and the modules to the cache, to run the pipeline offline",
+			Action: get,
+		},
+		{
+			Name:   "vendor",
+			Usage:  "copy the remote sources of the imports and the modules to togomak_vendor, which is used instead of fetching them",
+			Action: vendor,
+		},
+		{
+			Name:      "output",
+			Usage:     "show the values of the output blocks recorded by the latest run",
+			ArgsUsage: "[name]",
+			Action:    output,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "run",
+					Usage: "the id, or a prefix of the id, of the run whose outputs are shown",
+				},
+				&cli.BoolFlag{
+					Name:  "json",
+					Usage: "write the outputs as json",
+				},
+			},
+		},
+		{
+			Name:      "completion",
+			Usage:     "print the shell completion script for bash, zsh or fish",
+			ArgsUsage: "bash|zsh|fish",
+			Action:    completion,
+		},
+		{
+			Name:   "__complete",
+			Usage:  "print the completions of the filter or address being typed, used by the completion scripts",
+			Hidden: true,
+			Action: complete,
 		},
 		{
 			Name:   "fmt",
@@ -76,7 +211,7 @@ func main() {
 			Subcommands: []*cli.Command{
 				{
 					Name:   "clean",
-					Usage:  "clean the cache",
+					Usage:  "clean the temporary directories of the pipeline, or the cache selected by the flags",
 					Action: cleanCache,
 					Flags: []cli.Flag{
 						&cli.BoolFlag{
@@ -84,6 +219,67 @@ func main() {
 							Usage:   "clean the cache recursively",
 							Aliases: []string{"r"},
 						},
+						&cli.BoolFlag{
+							Name:  "all",
+							Usage: "remove the remote sources, the artifacts and the containers",
+						},
+						&cli.BoolFlag{
+							Name:  "imports",
+							Usage: "remove the remote sources of the imports and the modules in the cache",
+						},
+						&cli.BoolFlag{
+							Name:  "artifacts",
+							Usage: "remove the temporary directories and the recorded runs of the pipeline",
+						},
+						&cli.BoolFlag{
+							Name:  "containers",
+							Usage: "remove the containers of the stages left behind by the runs which are no longer running",
+						},
+					},
+				},
+				{
+					Name:   "ls",
+					Usage:  "list the remote sources in the cache, and the artifacts of the pipeline, with their size, age and pipeline",
+					Action: cacheList,
+					Flags: []cli.Flag{
+						&cli.BoolFlag{
+							Name:    "recursive",
+							Usage:   "list the artifacts of the pipelines in the subdirectories as well",
+							Aliases: []string{"r"},
+						},
+					},
+				},
+				{
+					Name:   "du",
+					Usage:  "show the disk usage of the remote sources in the cache, and of the artifacts of the pipeline",
+					Action: cacheDiskUsage,
+					Flags: []cli.Flag{
+						&cli.BoolFlag{
+							Name:    "recursive",
+							Usage:   "include the artifacts of the pipelines in the subdirectories",
+							Aliases: []string{"r"},
+						},
+					},
+				},
+				{
+					Name:   "prune",
+					Usage:  "remove the remote sources in the cache which were not used recently, and the old artifacts of the pipeline",
+					Action: cachePrune,
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:     "older-than",
+							Usage:    "remove the entries which were not used for longer than this, like 7d or 12h",
+							Required: true,
+						},
+						&cli.IntFlag{
+							Name:  "keep-last",
+							Usage: "keep the given number of the remote sources used most recently, and of the latest runs of the pipeline",
+						},
+						&cli.BoolFlag{
+							Name:    "recursive",
+							Usage:   "prune the artifacts of the pipelines in the subdirectories as well",
+							Aliases: []string{"r"},
+						},
 					},
 				},
 			},
@@ -147,18 +343,66 @@ func main() {
 			Usage:   "Don't actually run any stage; just print the commands",
 			EnvVars: []string{"TOGOMAK_DRY_RUN"},
 		},
+		&cli.BoolFlag{
+			Name:  "explain",
+			Usage: "show which stages and modules would run, and the rule which decided it, without running them. same as togomak plan",
+		},
+		&cli.StringFlag{
+			Name:    "profile",
+			Usage:   "record a Chrome trace-event profile of the run to the given path, and print the critical path",
+			EnvVars: []string{"TOGOMAK_PROFILE"},
+		},
+		&cli.BoolFlag{
+			Name:    "tui",
+			Usage:   "show an interactive terminal UI with the status and the output of the stages, instead of the logs",
+			EnvVars: []string{"TOGOMAK_TUI"},
+		},
+		&cli.StringFlag{
+			Name:    "output",
+			Usage:   "how the output of the stages is written: stream, prefix each line with the stage, or group it when the stage finishes. defaults to group in CI providers which support folding, and stream otherwise",
+			EnvVars: []string{"TOGOMAK_OUTPUT"},
+			Value:   "auto",
+		},
+		&cli.BoolFlag{
+			Name:    "quiet-success",
+			Usage:   "write the output of the failed stages only",
+			EnvVars: []string{"TOGOMAK_QUIET_SUCCESS"},
+		},
+		&cli.BoolFlag{
+			Name:    "upgrade",
+			Usage:   "fetch the remote sources again, and accept the sources which do not match togomak.lock.hcl instead of failing the run. togomak get and togomak vendor update them in the lock file",
+			EnvVars: []string{"TOGOMAK_UPGRADE"},
+		},
+		&cli.DurationFlag{
+			Name:    "sources-ttl",
+			Usage:   "how long the copy of a remote source in the cache is used before it is fetched again, if its ref may move, like a branch. the sources pinned to a tag or a commit are fetched once",
+			EnvVars: []string{"TOGOMAK_SOURCES_TTL"},
+			Value:   cache.DefaultSourcesTTL,
+		},
+		&cli.StringFlag{
+			Name:    "changed-since",
+			Usage:   "skip the stages and modules whose paths did not change since the merge base of the given git ref and HEAD",
+			EnvVars: []string{"TOGOMAK_CHANGED_SINCE"},
+		},
 		&cli.StringSliceFlag{
 			Name:    "query",
 			Aliases: []string{"q"},
 			Usage:   "filter the pipeline by a query",
 		},
-		&cli.StringSliceFlag{
-			Name: "var",
+		&cli.GenericFlag{
+			Name:  "var",
+			Value: &repeatedValue{},
 			Usage: "set a variable in the pipeline. " + "The format is <key>=<value>. " +
 				"Multiple variables can be set by passing the flag multiple times. " +
 				"Variables set this way take precedence over variables set in the pipeline file.",
 			Aliases: []string{"variable"},
 		},
+		&cli.StringSliceFlag{
+			Name: "var-file",
+			Usage: "read the values of the variables from a .togomakvars file, or a .json file. " +
+				"The *.auto.togomakvars files next to the pipeline are always read. " +
+				"A variable is set from, in order of precedence: TOGOMAK_VAR_<name>, the variable files, --var, and its default.",
+		},
 		&cli.BoolFlag{
 			Name:    "logging.remote.google-cloud",
 			Usage:   "Enable remote logging to Google Cloud",
@@ -170,6 +414,47 @@ func main() {
 			Usage:   "Google Cloud project ID where logs are ingested",
 			EnvVars: []string{"TOGOMAK_LOGGING_REMOTE_GCLOUD_PROJECT", "GOOGLE_CLOUD_PROJECT"},
 		},
+		&cli.StringFlag{
+			Name:    "logging.remote.loki",
+			Usage:   "Send the logs to Grafana Loki, like http://localhost:3100",
+			EnvVars: []string{"TOGOMAK_LOGGING_REMOTE_LOKI"},
+		},
+		&cli.StringFlag{
+			Name:    "logging.remote.http",
+			Usage:   "Send the logs to a URL as batches of JSON lines",
+			EnvVars: []string{"TOGOMAK_LOGGING_REMOTE_HTTP"},
+		},
+		&cli.StringFlag{
+			Name:    "logging.remote.syslog",
+			Usage:   "Send the logs to syslog, like unix:///dev/log or udp://localhost:514",
+			EnvVars: []string{"TOGOMAK_LOGGING_REMOTE_SYSLOG"},
+		},
+		&cli.StringFlag{
+			Name:    "otel-endpoint",
+			Usage:   "export the traces of the run to the OpenTelemetry collector at the given endpoint, like http://localhost:4317",
+			EnvVars: []string{"TOGOMAK_OTEL_ENDPOINT", "OTEL_EXPORTER_OTLP_ENDPOINT"},
+		},
+		&cli.StringFlag{
+			Name:    "otel-protocol",
+			Usage:   "the OTLP protocol of the OpenTelemetry collector, grpc or http/protobuf",
+			EnvVars: []string{"TOGOMAK_OTEL_PROTOCOL", "OTEL_EXPORTER_OTLP_PROTOCOL"},
+			Value:   profile.OTLPProtocolGRPC,
+		},
+		&cli.StringFlag{
+			Name:    "metrics-textfile",
+			Usage:   "write the metrics of the run in the Prometheus exposition format to a file, for the textfile collector of the node exporter",
+			EnvVars: []string{"TOGOMAK_METRICS_TEXTFILE"},
+		},
+		&cli.StringFlag{
+			Name:    "metrics-pushgateway",
+			Usage:   "push the metrics of the run to a Prometheus Pushgateway, like http://localhost:9091",
+			EnvVars: []string{"TOGOMAK_METRICS_PUSHGATEWAY"},
+		},
+		&cli.StringFlag{
+			Name:    "metrics-listen",
+			Usage:   "serve the metrics on /metrics at an address, like :9464, while togomak runs",
+			EnvVars: []string{"TOGOMAK_METRICS_LISTEN"},
+		},
 		&cli.BoolFlag{
 			Name:    "logging.local.file",
 			Usage:   "Enable local logging to a file",
@@ -209,6 +494,12 @@ func initPipeline(ctx *cli.Context) error {
 }
 
 func newConfigFromCliContext(ctx *cli.Context) ci.ConductorConfig {
+	return newConfigFromCliContextArgs(ctx, ctx.Args().Slice())
+}
+
+// newConfigFromCliContextArgs is newConfigFromCliContext, for commands whose positional
+// arguments are not filters. args are the filters of the stages and modules
+func newConfigFromCliContextArgs(ctx *cli.Context, args []string) ci.ConductorConfig {
 	var diags hcl.Diagnostics
 	owd, err := os.Getwd()
 	if err != nil {
@@ -224,12 +515,29 @@ func newConfigFromCliContext(ctx *cli.Context) ci.ConductorConfig {
 		pipelineFilePath = autoDetectFilePath(dir)
 	}
 
+	// the conductor changes the working directory to the pipeline directory,
+	// so the profile path needs to be resolved relative to the original working directory
+	profilePath := ctx.String("profile")
+	if profilePath != "" && !filepath.IsAbs(profilePath) {
+		profilePath = filepath.Join(owd, profilePath)
+	}
+	var varFiles []string
+	for _, f := range ctx.StringSlice("var-file") {
+		if !filepath.IsAbs(f) {
+			f = filepath.Join(owd, f)
+		}
+		varFiles = append(varFiles, f)
+	}
+	metricsTextfile := ctx.String("metrics-textfile")
+	if metricsTextfile != "" && !filepath.IsAbs(metricsTextfile) {
+		metricsTextfile = filepath.Join(owd, metricsTextfile)
+	}
+
 	hostname, err := os.Hostname()
 	if err != nil {
 		hostname = "localhost"
 	}
 
-	args := ctx.Args().Slice()
 	envArgs := os.Getenv("TOGOMAK_ARGS")
 	if envArgs != "" {
 		args = append(args, strings.Split(envArgs, " ")...)
@@ -253,11 +561,13 @@ func newConfigFromCliContext(ctx *cli.Context) ci.ConductorConfig {
 		os.Exit(1)
 	}
 	var variables []*ci.Variable
-	for _, v := range ctx.StringSlice("var") {
+	for _, v := range *ctx.Generic("var").(*repeatedValue) {
 		shell, d := ci.ParseVariableShell(v)
 		diags = diags.Extend(d)
 		variables = append(variables, shell)
 	}
+	output, d := ci.ParseOutputMode(ctx.String("output"))
+	diags = diags.Extend(d)
 	if diags.HasErrors() {
 		diagWriter.WriteDiagnostics(diags)
 		os.Exit(1)
@@ -283,15 +593,35 @@ func newConfigFromCliContext(ctx *cli.Context) ci.ConductorConfig {
 			Owd:      owd,
 			Module:   "",
 		},
-		User:      os.Getenv("USER"),
-		Hostname:  hostname,
-		Interface: ci.Interface{Verbosity: verboseCount, JSONLogging: ctx.Bool("json")},
+		User:     os.Getenv("USER"),
+		Hostname: hostname,
+		Interface: ci.Interface{
+			Verbosity:    verboseCount,
+			JSONLogging:  ctx.Bool("json"),
+			TUI:          ctx.Bool("tui"),
+			Output:       output,
+			QuietSuccess: ctx.Bool("quiet-success"),
+		},
 		Pipeline: ci.ConfigPipeline{
 			FilterQuery: engines,
 			Filtered:    filtered,
 			DryRun:      ctx.Bool("dry-run"),
+			Profile:     profilePath,
+			Trace: profile.OTLPConfig{
+				Endpoint: ctx.String("otel-endpoint"),
+				Protocol: ctx.String("otel-protocol"),
+			},
+			Metrics: metrics.Config{
+				Textfile:    metricsTextfile,
+				Pushgateway: ctx.String("metrics-pushgateway"),
+				Listen:      ctx.String("metrics-listen"),
+			},
+			ChangedSince: ctx.String("changed-since"),
+			Upgrade:      ctx.Bool("upgrade"),
+			SourcesTTL:   ctx.Duration("sources-ttl"),
 		},
 		Variables: variables,
+		VarFiles:  varFiles,
 
 		Logging: logging.Config{
 			Verbosity:     verboseCount,
@@ -306,6 +636,9 @@ func newConfigFromCliContext(ctx *cli.Context) ci.ConductorConfig {
 }
 
 func run(ctx *cli.Context) error {
+	if ctx.Bool("explain") {
+		return plan(ctx)
+	}
 	cfg := newConfigFromCliContext(ctx)
 	logger, err := logging.New(cfg.Logging)
 	if err != nil {
@@ -317,27 +650,177 @@ func run(ctx *cli.Context) error {
 	t := ci.NewConductor(cfg)
 	v := orchestra.Perform(t)
 	t.Destroy()
+	_ = logging.Close(logger)
 	os.Exit(v)
 	return nil
 }
 
 func cleanCache(ctx *cli.Context) error {
-	recursive := ctx.Bool("recursive")
-	owd, err := os.Getwd()
+	cfg, err := newCacheConfigFromCliContext(ctx)
 	if err != nil {
-		panic(err)
+		return err
 	}
+	cfg.All = ctx.Bool("all")
+	cfg.Imports = ctx.Bool("imports")
+	cfg.Artifacts = ctx.Bool("artifacts")
+	cfg.Containers = ctx.Bool("containers")
+	os.Exit(orchestra.CacheClean(cfg))
+	return nil
+}
+
+func list(ctx *cli.Context) error {
+	cfg := newConfigFromCliContext(ctx)
+	if ctx.Bool("json") {
+		cfg.Logging.Stderr = true
+	}
+	return orchestra.List(cfg, orchestra.ListConfig{
+		Type:  ctx.String("type"),
+		Phase: ctx.String("phase"),
+		JSON:  ctx.Bool("json"),
+	})
+}
+
+func plan(ctx *cli.Context) error {
+	cfg := newConfigFromCliContext(ctx)
+	os.Exit(orchestra.Plan(cfg))
+	return nil
+}
+
+func watch(ctx *cli.Context) error {
+	cfg := newConfigFromCliContext(ctx)
+	os.Exit(orchestra.Watch(cfg, orchestra.WatchConfig{
+		Debounce: ctx.Duration("debounce"),
+	}))
+	return nil
+}
+
+func describe(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return cli.Exit("describe expects the address of a single block, like stage.build", 1)
+	}
+	cfg := newConfigFromCliContextArgs(ctx, nil)
+	cfg.Logging.Stderr = true
+	os.Exit(orchestra.Describe(cfg, ctx.Args().First()))
+	return nil
+}
+
+func logs(ctx *cli.Context) error {
+	if ctx.NArg() > 2 {
+		return cli.Exit("logs expects at most the id of a run, and a stage", 1)
+	}
+	cfg := newConfigFromCliContextArgs(ctx, nil)
+	cfg.Logging.Stderr = true
+	os.Exit(orchestra.Logs(cfg, orchestra.LogsConfig{
+		Run:    ctx.Args().Get(0),
+		Stage:  ctx.Args().Get(1),
+		Follow: ctx.Bool("follow"),
+		Tail:   ctx.Int("tail"),
+	}))
+	return nil
+}
+
+func lock(ctx *cli.Context) error {
+	cfg := newConfigFromCliContext(ctx)
+	os.Exit(orchestra.Lock(cfg))
+	return nil
+}
+
+// newCacheConfigFromCliContext returns the configuration of the togomak cache commands,
+// the artifacts are those of the pipeline in --dir, or in the working directory
+func newCacheConfigFromCliContext(ctx *cli.Context) (orchestra.CacheConfig, error) {
 	dir := ctx.String("dir")
 	if dir == "" {
+		owd, err := os.Getwd()
+		if err != nil {
+			return orchestra.CacheConfig{}, cli.Exit(err.Error(), 1)
+		}
 		dir = owd
 	}
-	cache.CleanCache(dir, recursive)
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return orchestra.CacheConfig{}, cli.Exit(err.Error(), 1)
+	}
+	return orchestra.CacheConfig{Dir: dir, Recursive: ctx.Bool("recursive")}, nil
+}
+
+func cacheList(ctx *cli.Context) error {
+	cfg, err := newCacheConfigFromCliContext(ctx)
+	if err != nil {
+		return err
+	}
+	os.Exit(orchestra.CacheList(cfg))
 	return nil
 }
 
-func list(ctx *cli.Context) error {
+func cacheDiskUsage(ctx *cli.Context) error {
+	cfg, err := newCacheConfigFromCliContext(ctx)
+	if err != nil {
+		return err
+	}
+	os.Exit(orchestra.CacheDiskUsage(cfg))
+	return nil
+}
+
+func cachePrune(ctx *cli.Context) error {
+	cfg, err := newCacheConfigFromCliContext(ctx)
+	if err != nil {
+		return err
+	}
+	cfg.OlderThan, err = cache.ParseAge(ctx.String("older-than"))
+	if err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+	cfg.KeepLast = ctx.Int("keep-last")
+	if cfg.KeepLast < 0 {
+		return cli.Exit("--keep-last must not be negative", 1)
+	}
+	os.Exit(orchestra.CachePrune(cfg))
+	return nil
+}
+
+func get(ctx *cli.Context) error {
+	cfg := newConfigFromCliContext(ctx)
+	os.Exit(orchestra.Get(cfg))
+	return nil
+}
+
+func vendor(ctx *cli.Context) error {
+	cfg := newConfigFromCliContext(ctx)
+	os.Exit(orchestra.Vendor(cfg))
+	return nil
+}
+
+func output(ctx *cli.Context) error {
+	if ctx.NArg() > 1 {
+		return cli.Exit("output expects at most the name of an output", 1)
+	}
+	cfg := newConfigFromCliContextArgs(ctx, nil)
+	cfg.Logging.Stderr = true
+	os.Exit(orchestra.Output(cfg, orchestra.OutputConfig{
+		Run:  ctx.String("run"),
+		Name: ctx.Args().Get(0),
+		JSON: ctx.Bool("json"),
+	}))
+	return nil
+}
+
+func validate(ctx *cli.Context) error {
+	cfg := newConfigFromCliContext(ctx)
+	if ctx.Bool("json") {
+		cfg.Logging.Stderr = true
+	}
+	os.Exit(orchestra.Validate(cfg, ctx.Bool("json")))
+	return nil
+}
+
+func graph(ctx *cli.Context) error {
 	cfg := newConfigFromCliContext(ctx)
-	return orchestra.List(cfg)
+	cfg.Logging.Stderr = true
+	return orchestra.Graph(cfg, orchestra.GraphConfig{
+		Format:       ctx.String("format"),
+		HideInternal: ctx.Bool("hide-internal"),
+		Collapse:     ctx.Bool("collapse"),
+	})
 }
 
 func format(ctx *cli.Context) error {
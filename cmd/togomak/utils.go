@@ -7,8 +7,23 @@ import (
 	"log"
 	"path"
 	"path/filepath"
+	"strings"
 )
 
+// repeatedValue is the value of a flag which can be passed multiple times, like a
+// cli.StringSliceFlag, but which does not split its values on commas, so that
+// --var 'targets=["linux","darwin"]' is a single value
+type repeatedValue []string
+
+func (r *repeatedValue) Set(value string) error {
+	*r = append(*r, value)
+	return nil
+}
+
+func (r *repeatedValue) String() string {
+	return strings.Join(*r, " ")
+}
+
 func autoDetectFilePath(cwd string) string {
 	fs := afero.NewOsFs()
 	absPath, err := filepath.Abs(cwd)
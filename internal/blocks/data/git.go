@@ -101,6 +101,7 @@ func (e *GitProvider) DecodeBody(conductor conductor.Conductor, body hcl.Body, o
 	conductor.Eval().Mutex().RLock()
 	repo, d := content.Attributes[GitBlockArgumentUrl].Expr.Value(evalContext)
 	conductor.Eval().Mutex().RUnlock()
+	repo, _ = repo.Unmark()
 	diags = diags.Extend(d)
 
 	tagAttr, ok := content.Attributes[GitBlockArgumentTag]
@@ -195,6 +196,12 @@ func (e *GitProvider) DecodeBody(conductor conductor.Conductor, body hcl.Body, o
 		diags = diags.Extend(d)
 		conductor.Eval().Mutex().RUnlock()
 
+		// the credentials are usually marked as sensitive, like the variables with sensitive = true
+		authUsername, _ = authUsername.Unmark()
+		authPassword, _ = authPassword.Unmark()
+		authSshPassword, _ = authSshPassword.Unmark()
+		authSshPrivateKey, _ = authSshPrivateKey.Unmark()
+
 		authConfig = gitProviderAuthConfig{
 			username:      authUsername.AsString(),
 			password:      authPassword.AsString(),
@@ -57,9 +57,11 @@ func Variables(e Provider, body hcl.Body) []hcl.Traversal {
 	var traversal []hcl.Traversal
 
 	schema := e.Schema()
-	d, _, diags := body.PartialContent(schema)
-	if diags.HasErrors() {
-		panic(diags.Error())
+	// the diagnostics are reported when the body is decoded by the provider,
+	// we only need the attributes which could be decoded here
+	d, _, _ := body.PartialContent(schema)
+	if d == nil {
+		return nil
 	}
 	for _, attr := range d.Attributes {
 		traversal = append(traversal, attr.Expr.Variables()...)
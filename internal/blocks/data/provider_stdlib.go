@@ -1,6 +1,9 @@
 package data
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 var DefaultProviders = Providers{
 	&EnvProvider{},
@@ -20,6 +23,14 @@ func (p Providers) GoString() string {
 	return message
 }
 
+func (p Providers) String() string {
+	var names []string
+	for _, provider := range p {
+		names = append(names, provider.Name())
+	}
+	return strings.Join(names, ", ")
+}
+
 func (p Providers) Get(name string) Provider {
 	for _, provider := range p {
 		if provider.Name() == name {
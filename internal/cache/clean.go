@@ -1,46 +1,152 @@
 package cache
 
 import (
-	"fmt"
 	"github.com/srevinsaju/togomak/v1/internal/meta"
-	"github.com/srevinsaju/togomak/v1/internal/x"
+	"github.com/srevinsaju/togomak/v1/internal/runlog"
+	"io/fs"
 	"os"
 	"path/filepath"
-	"sync"
+	"sort"
+	"time"
 )
 
-func CleanCache(dir string, recursive bool) {
-	dirPath := filepath.Join(dir, meta.BuildDirPrefix, "pipelines", "tmp")
-	err := filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
-		if path == dirPath {
+// Artifact is a directory which a pipeline leaves behind in its .togomak directory, either
+// a temporary directory of the pipeline, or the record of a run, see runlog.Run
+type Artifact struct {
+	// Path is the path of the directory
+	Path string
+
+	// Pipeline is the pipeline which owns the directory
+	Pipeline string
+
+	// Time is when the directory was created, or when the run started
+	Time time.Time
+
+	// Run is the record of the run, it is nil for the temporary directories
+	Run *runlog.Run
+}
+
+func tmpDir(dir string) string {
+	return filepath.Join(dir, meta.BuildDirPrefix, "pipelines", "tmp")
+}
+
+// pipelineDirs returns dir, and the directories within dir with a .togomak directory if recursive
+func pipelineDirs(dir string, recursive bool) ([]string, error) {
+	if !recursive {
+		return []string{dir}, nil
+	}
+	dirs := []string{dir}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() || path == dir {
 			return nil
 		}
-		if info != nil && info.IsDir() {
-			fmt.Println("removing", path)
-			x.Must(os.RemoveAll(path))
+		switch d.Name() {
+		case meta.BuildDirPrefix:
+			if filepath.Dir(path) != dir {
+				dirs = append(dirs, filepath.Dir(path))
+			}
+			return filepath.SkipDir
+		case ".git":
+			return filepath.SkipDir
 		}
 		return nil
 	})
+	return dirs, err
+}
+
+// Artifacts returns the artifacts of the pipeline in dir, and of the pipelines within dir if
+// recursive, oldest first
+func Artifacts(dir string, recursive bool) ([]Artifact, error) {
+	dirs, err := pipelineDirs(dir, recursive)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	var wg sync.WaitGroup
-	if recursive {
-		entries, err := os.ReadDir(dir)
-		if err != nil {
-			panic(err)
+	var artifacts []Artifact
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(tmpDir(dir))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
 		}
 		for _, entry := range entries {
+			info, err := entry.Info()
+			if err != nil {
+				return nil, err
+			}
+			artifacts = append(artifacts, Artifact{
+				Path:     filepath.Join(tmpDir(dir), entry.Name()),
+				Pipeline: dir,
+				Time:     info.ModTime(),
+			})
+		}
 
-			if entry.IsDir() {
-				wg.Add(1)
-				go func(entry os.DirEntry) {
-					defer wg.Done()
-					CleanCache(filepath.Join(dir, entry.Name()), recursive)
-				}(entry)
+		runs, err := runlog.List(runlog.Dir(dir))
+		if err != nil {
+			return nil, err
+		}
+		for i := range runs {
+			artifacts = append(artifacts, Artifact{
+				Path:     filepath.Join(runlog.Dir(dir), runs[i].Id),
+				Pipeline: runs[i].Pipeline,
+				Time:     runs[i].Started,
+				Run:      &runs[i],
+			})
+		}
+	}
+	sort.SliceStable(artifacts, func(i, j int) bool {
+		return artifacts[i].Time.Before(artifacts[j].Time)
+	})
+	return artifacts, nil
+}
+
+// PruneArtifacts removes the artifacts of the pipeline in dir, and of the pipelines within dir
+// if recursive, which are older than olderThan, except the keepLast latest runs of each pipeline.
+// The runs which are still running are skipped. It returns the removed artifacts
+func PruneArtifacts(dir string, recursive bool, olderThan time.Duration, keepLast int) ([]Artifact, error) {
+	artifacts, err := Artifacts(dir, recursive)
+	if err != nil {
+		return nil, err
+	}
+	// the runs of each pipeline, latest first
+	kept := make(map[string]int)
+	var pruned []Artifact
+	for i := len(artifacts) - 1; i >= 0; i-- {
+		artifact := artifacts[i]
+		if artifact.Run != nil {
+			kept[filepath.Dir(artifact.Path)]++
+			if kept[filepath.Dir(artifact.Path)] <= keepLast || artifact.Run.Alive() {
+				continue
 			}
 		}
+		if time.Since(artifact.Time) < olderThan {
+			continue
+		}
+		if err := os.RemoveAll(artifact.Path); err != nil {
+			return pruned, err
+		}
+		pruned = append(pruned, artifact)
 	}
-	wg.Wait()
+	return pruned, nil
+}
 
+// CleanCache removes the temporary directories of the pipeline in dir, and of the pipelines
+// within dir if recursive, and their runs if runs is set. It returns the removed artifacts
+func CleanCache(dir string, recursive bool, runs bool) ([]Artifact, error) {
+	artifacts, err := Artifacts(dir, recursive)
+	if err != nil {
+		return nil, err
+	}
+	var removed []Artifact
+	for _, artifact := range artifacts {
+		if artifact.Run != nil && (!runs || artifact.Run.Alive()) {
+			continue
+		}
+		if err := os.RemoveAll(artifact.Path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, artifact)
+	}
+	return removed, nil
 }
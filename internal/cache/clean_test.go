@@ -0,0 +1,51 @@
+package cache
+
+import (
+	"github.com/srevinsaju/togomak/v1/internal/runlog"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPruneArtifacts(t *testing.T) {
+	dir := t.TempDir()
+	pipeline := filepath.Join(dir, "togomak.hcl")
+	assert.NoError(t, os.MkdirAll(filepath.Join(tmpDir(dir), "import"), 0755))
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		r, err := runlog.Start(runlog.Dir(dir), pipeline)
+		assert.NoError(t, err)
+		assert.NoError(t, r.Close(false))
+		ids = append(ids, r.Id())
+	}
+	running, err := runlog.Start(runlog.Dir(dir), pipeline)
+	assert.NoError(t, err)
+
+	artifacts, err := Artifacts(dir, false)
+	assert.NoError(t, err)
+	assert.Len(t, artifacts, 5)
+
+	// the two latest runs are kept, one of which is still running
+	pruned, err := PruneArtifacts(dir, false, 0, 2)
+	assert.NoError(t, err)
+	assert.Len(t, pruned, 3)
+	assert.NoDirExists(t, filepath.Join(tmpDir(dir), "import"))
+	assert.NoDirExists(t, filepath.Join(runlog.Dir(dir), ids[0]))
+	assert.NoDirExists(t, filepath.Join(runlog.Dir(dir), ids[1]))
+	assert.DirExists(t, filepath.Join(runlog.Dir(dir), ids[2]))
+	assert.DirExists(t, running.Dir())
+
+	// the runs are only removed with the artifacts
+	sub := filepath.Join(dir, "sub")
+	assert.NoError(t, os.MkdirAll(filepath.Join(tmpDir(sub), "import"), 0755))
+	removed, err := CleanCache(dir, true, false)
+	assert.NoError(t, err)
+	assert.Len(t, removed, 1)
+	assert.NoDirExists(t, filepath.Join(tmpDir(sub), "import"))
+	removed, err = CleanCache(dir, true, true)
+	assert.NoError(t, err)
+	assert.Len(t, removed, 1)
+	assert.DirExists(t, running.Dir())
+}
@@ -0,0 +1,54 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Lock locks key in dir, so that the pipelines which run in parallel do not fetch the same
+// source over each other. It blocks until the lock is acquired, and returns the function
+// which releases it
+func Lock(dir string, key string) (func(), error) {
+	return lock(dir, key, false)
+}
+
+// RLock is similar to Lock, but the lock is shared, so that the pipelines which run in
+// parallel may hold it together. The pipelines hold it on the copies they use, so that
+// they are not removed while the pipeline runs, see PruneSources
+func RLock(dir string, key string) (func(), error) {
+	return lock(dir, key, true)
+}
+
+func lock(dir string, key string, shared bool) (func(), error) {
+	f, err := os.OpenFile(filepath.Join(dir, key+lockExt), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f, shared, true); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		_ = unlockFile(f)
+		f.Close()
+	}, nil
+}
+
+// TryLock is similar to Lock, but returns false instead of blocking if the lock is held
+func TryLock(dir string, key string) (func(), bool, error) {
+	f, err := os.OpenFile(filepath.Join(dir, key+lockExt), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := lockFile(f, false, false); err != nil {
+		f.Close()
+		if errWouldBlock(err) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return func() {
+		_ = unlockFile(f)
+		f.Close()
+	}, true, nil
+}
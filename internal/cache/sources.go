@@ -0,0 +1,402 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultSourcesTTL is how long the copy of a remote source, whose ref may move, like a branch,
+// is used before it is fetched again
+const DefaultSourcesTTL = time.Hour
+
+const (
+	entryExt   = ".json"
+	lockExt    = ".lock"
+	tmpInfix   = ".tmp-"
+	contentDir = "content"
+)
+
+var commitRe = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// SourcesDir returns the directory of the user to which the remote sources of the imports
+// and the modules are fetched, ~/.cache/togomak/sources on Linux
+func SourcesDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "togomak", "sources")
+}
+
+// NormaliseSource returns source, as detected by go-getter, with the scheme and the host in
+// lowercase, without a trailing slash, and with the query parameters sorted, so that the
+// sources which only differ in their spelling share their copy in the cache
+func NormaliseSource(source string) string {
+	forced := ""
+	if i := strings.Index(source, "::"); i != -1 {
+		forced, source = source[:i+2], source[i+2:]
+	}
+	u, err := url.Parse(source)
+	if err != nil || u.Scheme == "" {
+		return forced + source
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	u.RawQuery = u.Query().Encode()
+	return forced + u.String()
+}
+
+// Key returns the name of the entry of source in the cache, which is the checksum of the
+// normalised source, including the ref it requests, see Entry
+func Key(source string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(NormaliseSource(source))))
+}
+
+// ContentKey returns the name of the copy of a source in the cache, which is the checksum of the
+// source pinned to the commit it resolved to, and of the hash of its files, see lockfile.HashDir.
+// The copies are never replaced, a source whose ref moved is fetched to another copy
+func ContentKey(resolved string, hash string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(NormaliseSource(resolved)+"\n"+hash)))
+}
+
+// ContentDir returns the directory of the copies of the sources in dir, see ContentKey
+func ContentDir(dir string) string {
+	return filepath.Join(dir, contentDir)
+}
+
+// Entry is a remote source in the cache, which maps the source, with the ref it requests,
+// to the copy of the commit it resolved to when it was fetched
+type Entry struct {
+	// Key is the name of the entry, see Key
+	Key string `json:"-"`
+
+	// Content is the name of the copy of the source, see ContentKey
+	Content string `json:"content"`
+
+	// Source is the source, as detected by go-getter
+	Source string `json:"source"`
+
+	// Resolved is the source pinned to the commit it resolved to
+	Resolved string `json:"resolved"`
+
+	// Immutable is set if the ref of the source cannot move, like a tag or a commit, the
+	// copy is then used without fetching the source again, see Entry.Fresh
+	Immutable bool `json:"immutable"`
+
+	// FetchedAt is when the source was fetched
+	FetchedAt time.Time `json:"fetched_at"`
+
+	// UsedAt is when the copy was last used by a pipeline
+	UsedAt time.Time `json:"used_at"`
+
+	// Pipeline is the path of the pipeline which last used the copy
+	Pipeline string `json:"pipeline,omitempty"`
+}
+
+// Dir returns the directory of the copy of the source in dir
+func (e *Entry) Dir(dir string) string {
+	return filepath.Join(ContentDir(dir), e.Content)
+}
+
+// Fresh reports if the copy is used instead of fetching the source again, which is the case
+// if the source is immutable, or if it was fetched less than ttl ago
+func (e *Entry) Fresh(ttl time.Duration) bool {
+	return e.Immutable || time.Since(e.FetchedAt) < ttl
+}
+
+// ReadEntry reads the entry of key in dir. It returns nil if the source was not
+// fetched to the cache, or if its copy is incomplete
+func ReadEntry(dir string, key string) (*Entry, error) {
+	data, err := os.ReadFile(filepath.Join(dir, key+entryExt))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entry := &Entry{Key: key}
+	if err := json.Unmarshal(data, entry); err != nil {
+		return nil, err
+	}
+	if entry.Content == "" {
+		return nil, nil
+	}
+	if _, err := os.Stat(entry.Dir(dir)); os.IsNotExist(err) {
+		return nil, nil
+	}
+	return entry, nil
+}
+
+// WriteEntry writes entry to dir, the copy of the source is expected to be in entry.Dir, see Store
+func WriteEntry(dir string, entry *Entry) error {
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, entry.Key+entryExt)
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// Entries returns the entries of the cache in dir, sorted by source
+func Entries(dir string) ([]*Entry, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*"+entryExt))
+	if err != nil {
+		return nil, err
+	}
+	var entries []*Entry
+	for _, file := range files {
+		entry, err := ReadEntry(dir, strings.TrimSuffix(filepath.Base(file), entryExt))
+		if err != nil {
+			return nil, err
+		}
+		if entry != nil {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Source < entries[j].Source
+	})
+	return entries, nil
+}
+
+// Immutable reports if the ref of source, fetched to dir, cannot move. The git sources are
+// immutable if their ref is a commit or a tag, and the other sources if they have a checksum
+func Immutable(source string, dir string) bool {
+	forced := ""
+	if i := strings.Index(source, "::"); i != -1 {
+		forced, source = source[:i], source[i+2:]
+	}
+	u, err := url.Parse(source)
+	if err != nil {
+		return false
+	}
+	if forced != "git" {
+		return u.Query().Get("checksum") != ""
+	}
+
+	ref := u.Query().Get("ref")
+	if ref == "" {
+		return false
+	}
+	if commitRe.MatchString(ref) {
+		return true
+	}
+	out, err := exec.Command("git", "-C", dir, "tag", "--points-at", "HEAD").Output()
+	if err != nil {
+		return false
+	}
+	for _, tag := range strings.Fields(string(out)) {
+		if tag == ref {
+			return true
+		}
+	}
+	return false
+}
+
+// Size returns the size of the files in dir
+func Size(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// PruneSources removes the entries of the sources in dir which were not used for longer than
+// olderThan, except the keepLast entries used most recently, with their copies, unless the copy
+// is shared by another entry. It also removes the copies which no entry maps to, like those of a
+// branch which moved, and the incomplete copies left behind by the interrupted fetches. The
+// copies used by a running pipeline, which holds RLock on them, are skipped. It returns the
+// removed entries
+func PruneSources(dir string, olderThan time.Duration, keepLast int) ([]*Entry, error) {
+	entries, err := Entries(dir)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].UsedAt.After(entries[j].UsedAt)
+	})
+	var pruned []*Entry
+	for i, entry := range entries {
+		if i < keepLast || time.Since(entry.UsedAt) < olderThan {
+			continue
+		}
+		removed, err := remove(dir, entry.Key, olderThan)
+		if err != nil {
+			return pruned, err
+		}
+		if removed {
+			pruned = append(pruned, entry)
+		}
+	}
+	if err := pruneContent(dir); err != nil {
+		return pruned, err
+	}
+
+	// the copies which were being fetched when the process was interrupted
+	tmps, err := filepath.Glob(filepath.Join(dir, "*"+tmpInfix+"*"))
+	if err != nil {
+		return pruned, err
+	}
+	for _, tmp := range tmps {
+		info, err := os.Stat(tmp)
+		if err != nil || time.Since(info.ModTime()) < olderThan {
+			continue
+		}
+		if err := os.RemoveAll(tmp); err != nil {
+			return pruned, err
+		}
+	}
+	return pruned, nil
+}
+
+// remove removes the entry of key, and its copy, unless a pipeline fetches the source or uses
+// its copy, or used it since it was listed
+func remove(dir string, key string, olderThan time.Duration) (bool, error) {
+	unlock, ok, err := TryLock(dir, key)
+	if err != nil || !ok {
+		return false, err
+	}
+	defer unlock()
+	entry, err := ReadEntry(dir, key)
+	if err != nil || entry == nil || time.Since(entry.UsedAt) < olderThan {
+		return false, err
+	}
+	unlockContent, ok, err := TryLock(ContentDir(dir), entry.Content)
+	if err != nil || !ok {
+		return false, err
+	}
+	defer unlockContent()
+	if err := os.Remove(filepath.Join(dir, key+entryExt)); err != nil {
+		return false, err
+	}
+
+	// the copy is shared by the refs which resolved to the same commit
+	refs, err := references(dir)
+	if err != nil || refs[entry.Content] {
+		return true, err
+	}
+	return true, os.RemoveAll(entry.Dir(dir))
+}
+
+// pruneContent removes the copies in dir which no entry maps to, unless a pipeline uses them
+func pruneContent(dir string) error {
+	copies, err := os.ReadDir(ContentDir(dir))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	refs, err := references(dir)
+	if err != nil {
+		return err
+	}
+	for _, c := range copies {
+		if !c.IsDir() || refs[c.Name()] {
+			continue
+		}
+		unlock, ok, err := TryLock(ContentDir(dir), c.Name())
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+
+		// a pipeline maps an entry to a copy while it holds RLock on it, so the entries
+		// are read again once the copy is locked
+		refs, err = references(dir)
+		if err == nil && !refs[c.Name()] {
+			err = os.RemoveAll(filepath.Join(ContentDir(dir), c.Name()))
+		}
+		unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// references returns the copies in dir which the entries map to
+func references(dir string) (map[string]bool, error) {
+	entries, err := Entries(dir)
+	if err != nil {
+		return nil, err
+	}
+	refs := make(map[string]bool)
+	for _, entry := range entries {
+		refs[entry.Content] = true
+	}
+	return refs, nil
+}
+
+// ParseAge parses an age like 7d, 12h or 30m. Days are accepted in addition to the
+// units of time.ParseDuration
+func ParseAge(age string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(age, "d"); ok {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age %q", age)
+		}
+		return time.Duration(n * float64(24*time.Hour)), nil
+	}
+	d, err := time.ParseDuration(age)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q", age)
+	}
+	return d, nil
+}
+
+// TmpDir returns a new directory in dir to which key is fetched, before it is stored in the
+// cache, see Store. The directory does not exist, it is expected to be created by go-getter
+func TmpDir(dir string, key string) (string, error) {
+	tmp, err := os.MkdirTemp(dir, key+tmpInfix)
+	if err != nil {
+		return "", err
+	}
+	return tmp, os.Remove(tmp)
+}
+
+// Store moves tmp, to which a source was fetched, see TmpDir, to the copy content in dir, or
+// removes it if the copy exists, as the copies are never replaced. The caller is expected to
+// hold RLock on the copy, so that it is not removed while it is stored
+func Store(dir string, tmp string, content string) error {
+	dst := filepath.Join(ContentDir(dir), content)
+	if _, err := os.Stat(dst); err == nil {
+		return os.RemoveAll(tmp)
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		// another pipeline stored the same copy since
+		if _, statErr := os.Stat(dst); statErr == nil {
+			return os.RemoveAll(tmp)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package cache
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestKey(t *testing.T) {
+	assert.Equal(t,
+		Key("git::https://github.com/org/repo?ref=main&depth=1"),
+		Key("git::HTTPS://GitHub.com/org/repo/?depth=1&ref=main"),
+	)
+	assert.NotEqual(t, Key("git::https://github.com/org/repo?ref=main"), Key("git::https://github.com/org/repo?ref=v1.0.0"))
+}
+
+func TestImmutable(t *testing.T) {
+	dir := t.TempDir()
+	assert.True(t, Immutable("git::https://github.com/org/repo?ref=0123456789abcdef0123456789abcdef01234567", dir))
+	assert.False(t, Immutable("git::https://github.com/org/repo?ref=main", dir))
+	assert.False(t, Immutable("git::https://github.com/org/repo", dir))
+	assert.True(t, Immutable("https://example.com/src.zip?checksum=sha256:abc", dir))
+	assert.False(t, Immutable("https://example.com/src.zip", dir))
+}
+
+func TestParseAge(t *testing.T) {
+	age, err := ParseAge("7d")
+	assert.NoError(t, err)
+	assert.Equal(t, 7*24*time.Hour, age)
+	age, err = ParseAge("12h")
+	assert.NoError(t, err)
+	assert.Equal(t, 12*time.Hour, age)
+	_, err = ParseAge("-1d")
+	assert.Error(t, err)
+}
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(ContentDir(dir), 0755))
+	fetch := func(content string) string {
+		tmp, err := TmpDir(dir, Key("git::https://github.com/org/repo?ref=main"))
+		assert.NoError(t, err)
+		assert.NoError(t, os.MkdirAll(tmp, 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(tmp, "togomak.hcl"), []byte(content), 0644))
+		return tmp
+	}
+	resolved := "git::https://github.com/org/repo?ref=0123456789abcdef0123456789abcdef01234567"
+	assert.Equal(t, ContentKey(resolved, "h1:a"), ContentKey("git::HTTPS://GitHub.com/org/repo/?ref=0123456789abcdef0123456789abcdef01234567", "h1:a"))
+	assert.NotEqual(t, ContentKey(resolved, "h1:a"), ContentKey(resolved, "h1:b"))
+
+	// the copies are not replaced
+	content := ContentKey(resolved, "h1:a")
+	first := fetch("v1")
+	assert.NoError(t, Store(dir, first, content))
+	assert.NoDirExists(t, first)
+	second := fetch("v2")
+	assert.NoError(t, Store(dir, second, content))
+	assert.NoDirExists(t, second)
+	data, err := os.ReadFile(filepath.Join(ContentDir(dir), content, "togomak.hcl"))
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", string(data))
+}
+
+func TestPrune(t *testing.T) {
+	dir := t.TempDir()
+	write := func(source string, content string, usedAt time.Time) *Entry {
+		entry := &Entry{Key: Key(source), Content: content, Source: source, FetchedAt: usedAt, UsedAt: usedAt}
+		assert.NoError(t, os.MkdirAll(entry.Dir(dir), 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(entry.Dir(dir), "togomak.hcl"), []byte("togomak {}"), 0644))
+		assert.NoError(t, WriteEntry(dir, entry))
+		return entry
+	}
+	old := write("git::https://github.com/org/old?ref=main", "old", time.Now().Add(-48*time.Hour))
+	recent := write("git::https://github.com/org/recent?ref=main", "recent", time.Now())
+	locked := write("git::https://github.com/org/locked?ref=main", "locked", time.Now().Add(-48*time.Hour))
+	shared := write("git::https://github.com/org/recent?ref=v1.0.0", "recent", time.Now().Add(-48*time.Hour))
+
+	// the copy of a branch which moved is no longer mapped to
+	moved := &Entry{Content: "moved"}
+	assert.NoError(t, os.MkdirAll(moved.Dir(dir), 0755))
+
+	entries, err := Entries(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 4)
+	assert.False(t, old.Fresh(time.Hour))
+	assert.True(t, recent.Fresh(time.Hour))
+
+	// the copies in use by a pipeline are not removed
+	unlock, err := RLock(ContentDir(dir), locked.Content)
+	assert.NoError(t, err)
+	pruned, err := PruneSources(dir, 24*time.Hour, 0)
+	unlock()
+	assert.NoError(t, err)
+	assert.Len(t, pruned, 2)
+	assert.ElementsMatch(t, []string{old.Source, shared.Source}, []string{pruned[0].Source, pruned[1].Source})
+	assert.NoDirExists(t, old.Dir(dir))
+	assert.NoDirExists(t, moved.Dir(dir))
+	assert.DirExists(t, recent.Dir(dir))
+	assert.DirExists(t, locked.Dir(dir))
+
+	// the copies used most recently are kept
+	pruned, err = PruneSources(dir, 0, 1)
+	assert.NoError(t, err)
+	assert.Len(t, pruned, 1)
+	assert.Equal(t, locked.Source, pruned[0].Source)
+	assert.NoDirExists(t, locked.Dir(dir))
+	assert.DirExists(t, recent.Dir(dir))
+}
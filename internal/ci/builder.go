@@ -1,12 +1,28 @@
 package ci
 
+import "github.com/hashicorp/hcl/v2"
+
 const BuilderBlock = "togomak"
 
 type Behavior struct {
 	DisableConcurrency bool `hcl:"disable_concurrency,optional" json:"disable_concurrency"`
 }
 
+// LoggingSink is a sink the logs of the pipeline are sent to, like a loki or http sink.
+// Its attributes are the options of the sink, see logging.SinkConfig
+type LoggingSink struct {
+	Name string   `hcl:"name,label" json:"name"`
+	Body hcl.Body `hcl:",remain" json:"-"`
+}
+
+// Logging configures where the logs of the pipeline are sent, in addition to the
+// sinks passed on the command line
+type Logging struct {
+	Sinks []*LoggingSink `hcl:"sink,block" json:"sinks"`
+}
+
 type Builder struct {
 	Version  int       `hcl:"version" json:"version"`
 	Behavior *Behavior `hcl:"behavior,block" json:"behavior"`
+	Logging  *Logging  `hcl:"logging,block" json:"logging"`
 }
@@ -0,0 +1,173 @@
+package ci
+
+import (
+	"fmt"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/sirupsen/logrus"
+	"github.com/srevinsaju/togomak/v1/internal/blocks"
+	"github.com/srevinsaju/togomak/v1/internal/logging"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+// sinkOptions flattens the value of an attribute of a sink block into options. The maps,
+// like labels = { team = "platform" }, become options like labels.team
+func sinkOptions(key string, v cty.Value, options map[string]string, rng hcl.Range) hcl.Diagnostics {
+	if v.IsNull() {
+		return nil
+	}
+	if !v.IsWhollyKnown() {
+		return hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "invalid sink option",
+			Detail:   fmt.Sprintf("the value of %s must be known before the pipeline runs", key),
+			Subject:  rng.Ptr(),
+		}}
+	}
+	ty := v.Type()
+	if ty.IsObjectType() || ty.IsMapType() {
+		var diags hcl.Diagnostics
+		for k, elem := range v.AsValueMap() {
+			diags = diags.Extend(sinkOptions(key+"."+k, elem, options, rng))
+		}
+		return diags
+	}
+	s, err := convert.Convert(v, cty.String)
+	if err != nil {
+		return hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "invalid sink option",
+			Detail:   fmt.Sprintf("%s must be a string, a number, a bool or a map: %s", key, err),
+			Subject:  rng.Ptr(),
+		}}
+	}
+	options[key] = s.AsString()
+	return nil
+}
+
+// sinkReferences rejects the references of the attributes of a sink to the blocks of the
+// pipeline, like var.loki_password. The sinks are attached before the pipeline runs, when
+// the blocks are not evaluated yet, so only literals, the built-in values like hostname,
+// and functions like env() are allowed
+func sinkReferences(attrs hcl.Attributes) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	for _, attr := range attrs {
+		for _, traversal := range attr.Expr.Variables() {
+			switch traversal.RootName() {
+			case blocks.VarBlock, LocalBlock, blocks.StageBlock, blocks.ModuleBlock, DataBlock, blocks.MacroBlock, blocks.ParamBlock, OutputBlock, EachBlock, ThisBlock:
+			default:
+				continue
+			}
+			diags = diags.Append(&hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Unsupported reference in logging sink",
+				Detail: fmt.Sprintf("The options of the logging sinks are evaluated before the pipeline runs, they may only use literals, the built-in values and functions like env(), "+
+					"and cannot refer to %s, which is only known while the pipeline runs. Use env() to read a secret from the environment instead.", traversalName(traversal)),
+				Subject: traversal.SourceRange().Ptr(),
+			})
+		}
+	}
+	return diags
+}
+
+// traversalName returns the name of the block a traversal refers to, like var.loki_password
+func traversalName(traversal hcl.Traversal) string {
+	name := traversal.RootName()
+	if len(traversal) > 1 {
+		if attr, ok := traversal[1].(hcl.TraverseAttr); ok {
+			name += "." + attr.Name
+		}
+	}
+	return name
+}
+
+// Config evaluates the attributes of the sink into a logging.SinkConfig. The level
+// attribute is the least severe level sent to the sink, it defaults to debug.
+// The attributes may not refer to other blocks, see sinkReferences
+func (s *LoggingSink) Config(evalCtx *hcl.EvalContext) (logging.SinkConfig, hcl.Diagnostics) {
+	cfg := logging.SinkConfig{
+		Name:    s.Name,
+		Level:   logrus.DebugLevel,
+		Options: make(map[string]string),
+	}
+	attrs, diags := s.Body.JustAttributes()
+	diags = diags.Extend(sinkReferences(attrs))
+	if diags.HasErrors() {
+		return cfg, diags
+	}
+	for name, attr := range attrs {
+		v, d := attr.Expr.Value(evalCtx)
+		diags = diags.Extend(d)
+		if d.HasErrors() {
+			continue
+		}
+		// the credentials of the sinks, like the password of loki, are usually sensitive values
+		v, _ = v.UnmarkDeep()
+		diags = diags.Extend(sinkOptions(name, v, cfg.Options, attr.Expr.Range()))
+	}
+
+	if level, ok := cfg.Options["level"]; ok {
+		l, err := logrus.ParseLevel(level)
+		if err != nil {
+			diags = diags.Append(&hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "invalid sink level",
+				Detail:   err.Error(),
+				Subject:  attrs["level"].Expr.Range().Ptr(),
+			})
+		}
+		cfg.Level = l
+		delete(cfg.Options, "level")
+	}
+	return cfg, diags
+}
+
+// logrusLogger returns the logger the loggers of the conductor are derived from
+func (c *Conductor) logrusLogger() *logrus.Logger {
+	switch l := c.RootLogger.(type) {
+	case *logrus.Logger:
+		return l
+	case *logrus.Entry:
+		return l.Logger
+	}
+	return nil
+}
+
+// AttachLoggingSinks sends the logs of the conductor to the sinks of the logging block
+// of the togomak block of pipe, in addition to the sinks passed on the command line.
+// The sinks are closed when the conductor is destroyed. The child processes do not send
+// their logs, as their output is logged by the parent process
+func AttachLoggingSinks(conductor *Conductor, pipe *Pipeline) hcl.Diagnostics {
+	if pipe.Builder.Logging == nil || conductor.Config.Behavior.Child.Enabled {
+		return nil
+	}
+	logger := conductor.logrusLogger()
+	if logger == nil {
+		return nil
+	}
+	cfg := conductor.Config.Logging
+	cfg.CorrelationID = conductor.Process.Id.String()
+
+	var diags hcl.Diagnostics
+	for _, s := range pipe.Builder.Logging.Sinks {
+		conductor.Eval().Mutex().RLock()
+		sinkCfg, d := s.Config(conductor.Eval().Context())
+		conductor.Eval().Mutex().RUnlock()
+		diags = diags.Extend(d)
+		if d.HasErrors() {
+			continue
+		}
+		sink, err := logging.NewSink(cfg, sinkCfg)
+		if err != nil {
+			diags = diags.Append(&hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "invalid sink",
+				Detail:   err.Error(),
+				Subject:  s.Body.MissingItemRange().Ptr(),
+			})
+			continue
+		}
+		logger.AddHook(sink)
+	}
+	return diags
+}
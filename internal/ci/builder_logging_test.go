@@ -0,0 +1,69 @@
+package ci
+
+import (
+	"github.com/hashicorp/hcl/v2"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLoggingSink_Config(t *testing.T) {
+	src := `
+togomak {
+  version = 2
+  logging {
+    sink "loki" {
+      url = "http://localhost:3100"
+      level = "warn"
+      batch_size = 10
+      labels = {
+        team = "platform"
+      }
+    }
+    sink "kafka" {}
+  }
+}
+`
+	pipe := &Pipeline{}
+	decodeConfig(t, src, pipe)
+	assert.Len(t, pipe.Builder.Logging.Sinks, 2)
+
+	cfg, diags := pipe.Builder.Logging.Sinks[0].Config(&hcl.EvalContext{})
+	assert.Empty(t, diags)
+	assert.Equal(t, "loki", cfg.Name)
+	assert.Equal(t, logrus.WarnLevel, cfg.Level)
+	assert.Equal(t, map[string]string{
+		"url":         "http://localhost:3100",
+		"batch_size":  "10",
+		"labels.team": "platform",
+	}, cfg.Options)
+
+	assert.Empty(t, pipe.Builder.Logging.Sinks[0].validate())
+	assert.Equal(t, []string{"Unknown logging sink"}, diagSummaries(pipe.Builder.Logging.Sinks[1].validate()))
+}
+
+func TestLoggingSink_References(t *testing.T) {
+	src := `
+togomak {
+  version = 2
+  logging {
+    sink "loki" {
+      url      = "http://${hostname}:3100"
+      username = env("LOKI_USER")
+      password = var.loki_password
+      labels = {
+        team = local.team
+      }
+    }
+  }
+}
+`
+	pipe := &Pipeline{}
+	decodeConfig(t, src, pipe)
+
+	// the sinks are attached before the variables and the locals are evaluated
+	sink := pipe.Builder.Logging.Sinks[0]
+	_, diags := sink.Config(&hcl.EvalContext{})
+	assert.Equal(t, []string{"Unsupported reference in logging sink", "Unsupported reference in logging sink"}, diagSummaries(diags))
+	assert.Len(t, sink.validate(), 2)
+}
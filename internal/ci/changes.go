@@ -0,0 +1,126 @@
+package ci
+
+import (
+	"code.gitea.io/gitea/modules/git"
+	"context"
+	"fmt"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/kendru/darwin/go/depgraph"
+	"github.com/srevinsaju/togomak/v1/internal/blocks"
+	"github.com/srevinsaju/togomak/v1/internal/x"
+	"strings"
+)
+
+// splitNul splits the NUL terminated output of git commands run with -z
+func splitNul(s string) []string {
+	var parts []string
+	for _, part := range strings.Split(s, "\000") {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// gitError returns the error message git wrote to stderr, falling back to err
+func gitError(err error, stderr string) string {
+	if msg := strings.TrimSpace(stderr); msg != "" {
+		return msg
+	}
+	return err.Error()
+}
+
+// ChangedFiles returns the files, relative to dir, which changed since the merge base of ref
+// and HEAD in the git repository at dir. Uncommitted and untracked files are included
+func ChangedFiles(ctx context.Context, dir string, ref string) ([]string, error) {
+	stdout, stderr, err := git.NewCommand(ctx, "merge-base").AddDynamicArguments(ref, "HEAD").RunStdString(&git.RunOpts{Dir: dir})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the merge base of %s and HEAD: %s", ref, gitError(err, stderr))
+	}
+	base := strings.TrimSpace(stdout)
+
+	stdout, stderr, err = git.NewCommand(ctx, "diff", "--name-only", "--relative", "-z").AddDynamicArguments(base).RunStdString(&git.RunOpts{Dir: dir})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the files changed since %s: %s", ref, gitError(err, stderr))
+	}
+	files := splitNul(stdout)
+
+	stdout, stderr, err = git.NewCommand(ctx, "ls-files", "--others", "--exclude-standard", "-z").RunStdString(&git.RunOpts{Dir: dir})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the untracked files: %s", gitError(err, stderr))
+	}
+	return append(files, splitNul(stdout)...), nil
+}
+
+// Unchanged returns the addresses of the stages and modules with paths, none of which match
+// the changed files, and which do not depend on a stage or module whose paths changed
+func (pipe *Pipeline) Unchanged(conductor *Conductor, depGraph *depgraph.Graph, files []string) (map[string]bool, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	paths := make(map[string][]string)
+	for _, stage := range pipe.Stages {
+		patterns, d := globPatterns(conductor, stage.Paths, "paths")
+		diags = diags.Extend(d)
+		if exprIsSet(stage.Paths) {
+			paths[x.RenderBlock(blocks.StageBlock, stage.Id)] = patterns
+		}
+	}
+	for _, module := range pipe.Modules {
+		patterns, d := globPatterns(conductor, module.Paths, "paths")
+		diags = diags.Extend(d)
+		if exprIsSet(module.Paths) {
+			paths[x.RenderBlock(blocks.ModuleBlock, module.Id)] = patterns
+		}
+	}
+
+	changed := make(map[string]bool)
+	unchanged := make(map[string]bool)
+	for _, node := range depGraph.TopoSorted() {
+		ty := graphNodeType(node)
+		if ty != blocks.StageBlock && ty != blocks.ModuleBlock {
+			continue
+		}
+		patterns, ok := paths[node]
+		if !ok {
+			continue
+		}
+		if globMatchAny(patterns, files) {
+			changed[node] = true
+			continue
+		}
+		dependencyChanged := false
+		for dep := range depGraph.Dependencies(node) {
+			dependencyChanged = dependencyChanged || changed[dep]
+		}
+		if dependencyChanged {
+			changed[node] = true
+			continue
+		}
+		unchanged[node] = true
+	}
+	return unchanged, diags
+}
+
+// expandChanges computes the stages and modules skipped by ConfigPipeline.ChangedSince,
+// and stores them in the conductor
+func (pipe *Pipeline) expandChanges(conductor *Conductor, depGraph *depgraph.Graph) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	ref := conductor.Config.Pipeline.ChangedSince
+	if ref == "" {
+		return diags
+	}
+
+	files, err := ChangedFiles(conductor.Context(), conductor.Config.Paths.Cwd, ref)
+	if err != nil {
+		return diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Failed to compute the changed files",
+			Detail:   err.Error(),
+		})
+	}
+	conductor.Logger().Debugf("%d files changed since %s", len(files), ref)
+
+	unchanged, d := pipe.Unchanged(conductor, depGraph, files)
+	diags = diags.Extend(d)
+	conductor.Update(ConductorWithUnchanged(unchanged))
+	return diags
+}
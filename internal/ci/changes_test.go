@@ -0,0 +1,48 @@
+package ci
+
+import (
+	"github.com/srevinsaju/togomak/v1/internal/path"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func TestPipeline_Unchanged(t *testing.T) {
+	cwd, err := os.Getwd()
+	assert.NoError(t, err)
+	conductor := newTestConductor(ConductorConfig{Paths: &path.Path{Cwd: cwd}})
+
+	src := `
+togomak {
+  version = 2
+}
+stage "api" {
+  paths  = ["services/api/**"]
+  script = "make"
+}
+stage "api_deploy" {
+  paths      = ["deploy/api/**"]
+  depends_on = [stage.api]
+  script     = "make deploy"
+}
+stage "web" {
+  paths  = ["services/web/**"]
+  script = "npm run build"
+}
+stage "lint" {
+  script = "make lint"
+}
+`
+	pipe := &Pipeline{}
+	decodeConfig(t, src, pipe)
+	depGraph, diags := GraphTopoSort(conductor, pipe)
+	assert.False(t, diags.HasErrors())
+
+	unchanged, diags := pipe.Unchanged(conductor, depGraph, []string{"services/api/main.go", "README.md"})
+	assert.False(t, diags.HasErrors())
+	assert.Equal(t, map[string]bool{"stage.web": true}, unchanged)
+
+	unchanged, diags = pipe.Unchanged(conductor, depGraph, nil)
+	assert.False(t, diags.HasErrors())
+	assert.Equal(t, map[string]bool{"stage.api": true, "stage.api_deploy": true, "stage.web": true}, unchanged)
+}
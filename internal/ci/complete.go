@@ -0,0 +1,71 @@
+package ci
+
+import (
+	"github.com/srevinsaju/togomak/v1/internal/blocks"
+	"github.com/srevinsaju/togomak/v1/internal/meta"
+	"github.com/srevinsaju/togomak/v1/internal/rules"
+	"sort"
+	"strings"
+)
+
+// completeMatching returns the sorted and unique candidates, prefixed with op, which start with prefix
+func completeMatching(candidates []string, op string, prefix string) []string {
+	seen := make(map[string]bool)
+	var matching []string
+	for _, candidate := range candidates {
+		candidate = op + candidate
+		if seen[candidate] || !strings.HasPrefix(candidate, prefix) {
+			continue
+		}
+		seen[candidate] = true
+		matching = append(matching, candidate)
+	}
+	sort.Strings(matching)
+	return matching
+}
+
+// CompleteFilters returns the filters which start with prefix, which are the addresses of the
+// stages, modules and macros, and the lifecycle phases. If prefix starts with the "+" or "^"
+// operator, the filters are returned with the operator
+func CompleteFilters(items ListItems, prefix string) []string {
+	op := ""
+	if strings.HasPrefix(prefix, rules.OperationTypeAdd.String()) || strings.HasPrefix(prefix, rules.OperationTypeSub.String()) {
+		op = prefix[:1]
+	}
+
+	var candidates []string
+	for _, phase := range Lifecycles {
+		candidates = append(candidates, phase.String())
+	}
+	for _, item := range items {
+		switch item.Type {
+		case blocks.StageBlock, blocks.ModuleBlock, blocks.MacroBlock:
+		default:
+			continue
+		}
+		if strings.HasPrefix(item.Address, item.Type+".") {
+			candidates = append(candidates, item.Address)
+		}
+		for _, phase := range item.Phases {
+			// phases which could not be evaluated statically are listed as their source,
+			// like local.phases, which is not a phase
+			if rules.OperationTypeAnd.Matcher().MatchString(phase) && !strings.Contains(phase, ".") {
+				candidates = append(candidates, phase)
+			}
+		}
+	}
+	return completeMatching(candidates, op, prefix)
+}
+
+// CompleteAddresses returns the addresses of the blocks which start with prefix, as accepted
+// by togomak describe
+func CompleteAddresses(items ListItems, prefix string) []string {
+	var candidates []string
+	for _, item := range items {
+		if item.Type == ImportBlock || item.Address == meta.PreStage || item.Address == meta.PostStage {
+			continue
+		}
+		candidates = append(candidates, item.Address)
+	}
+	return completeMatching(candidates, "", prefix)
+}
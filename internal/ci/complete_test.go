@@ -0,0 +1,25 @@
+package ci
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCompleteFilters(t *testing.T) {
+	items := ListItems{
+		{Address: "stage.build", Type: "stage", Phases: []string{"build", "local.phases"}},
+		{Address: "togomak.pre", Type: "stage"},
+		{Address: "module.api", Type: "module"},
+		{Address: "macro.deploy", Type: "macro"},
+		{Address: "var.name", Type: "variable"},
+	}
+	assert.Equal(t, []string{"stage.build"}, CompleteFilters(items, "st"))
+	assert.Equal(t, []string{"^module.api"}, CompleteFilters(items, "^mod"))
+	assert.Equal(t, []string{"+build"}, CompleteFilters(items, "+bu"))
+	assert.Equal(t, []string{"default", "deploy"}, CompleteFilters(items, "de"))
+	assert.Empty(t, CompleteFilters(items, "var."))
+	assert.Empty(t, CompleteFilters(items, "local."))
+
+	assert.Equal(t, []string{"var.name"}, CompleteAddresses(items, "var"))
+	assert.Empty(t, CompleteAddresses(items, "togomak"))
+}
@@ -8,10 +8,16 @@ import (
 	"github.com/hashicorp/hcl/v2/hclparse"
 	"github.com/sirupsen/logrus"
 	"github.com/srevinsaju/togomak/v1/internal/conductor"
+	"github.com/srevinsaju/togomak/v1/internal/lockfile"
 	"github.com/srevinsaju/togomak/v1/internal/logging"
 	"github.com/srevinsaju/togomak/v1/internal/meta"
+	"github.com/srevinsaju/togomak/v1/internal/metrics"
+	"github.com/srevinsaju/togomak/v1/internal/profile"
 	"github.com/srevinsaju/togomak/v1/internal/rules"
+	"github.com/srevinsaju/togomak/v1/internal/runlog"
 	"github.com/srevinsaju/togomak/v1/internal/x"
+	"github.com/zclconf/go-cty/cty"
+	"io"
 	"os"
 	"path/filepath"
 	"sync"
@@ -46,7 +52,7 @@ func ConductorWithParser(parser *Parser) ConductorOption {
 
 func ConductorWithDiagWriter(diagWriter hcl.DiagnosticWriter) ConductorOption {
 	return func(c *Conductor) {
-		c.DiagWriter = diagWriter
+		c.DiagWriter = redactDiagWriter{writer: diagWriter, conductor: c}
 	}
 }
 
@@ -68,6 +74,83 @@ func ConductorWithVariable(variable *Variable) ConductorOption {
 	}
 }
 
+func ConductorWithProfiler(profiler *profile.Profiler) ConductorOption {
+	return func(c *Conductor) {
+		c.profiler = profiler
+	}
+}
+
+// ConductorWithObserver sets the observer which is notified when the stages and
+// modules of the pipeline start, retry, finish or are skipped
+func ConductorWithObserver(observer Observer) ConductorOption {
+	return func(c *Conductor) {
+		c.observer = observer
+	}
+}
+
+// ConductorWithUnchanged sets the addresses of the stages and modules which are skipped,
+// because none of their paths changed since ConfigPipeline.ChangedSince
+func ConductorWithUnchanged(unchanged map[string]bool) ConductorOption {
+	return func(c *Conductor) {
+		c.unchanged = unchanged
+	}
+}
+
+// ConductorWithRunLog sets the recorder of the logs of the stages of the run, see runlog.Recorder
+func ConductorWithRunLog(runLog *runlog.Recorder) ConductorOption {
+	return func(c *Conductor) {
+		c.runLog = runLog
+	}
+}
+
+// ConductorWithMetrics sets the metrics of the run, see metrics.Metrics
+func ConductorWithMetrics(m *metrics.Metrics) ConductorOption {
+	return func(c *Conductor) {
+		c.metrics = m
+	}
+}
+
+// ConductorWithOutput sets the writer of the grouped and prefixed output of the
+// stages, see OutputMode. It defaults to os.Stdout
+func ConductorWithOutput(out io.Writer) ConductorOption {
+	return func(c *Conductor) {
+		c.out = out
+	}
+}
+
+// ConductorWithVarFileValues sets the values of the variables read from the variable files, see ReadVarFiles
+func ConductorWithVarFileValues(values map[string]cty.Value) ConductorOption {
+	return func(c *Conductor) {
+		c.varFileValues = values
+	}
+}
+
+// ConductorWithRedactions sets the sensitive values which are redacted from the output, see Redactions
+func ConductorWithRedactions(redactions *Redactions) ConductorOption {
+	return func(c *Conductor) {
+		c.redactions = redactions
+	}
+}
+
+func ConductorWithLock(lock *lockfile.Lock) ConductorOption {
+	return func(c *Conductor) {
+		c.lock = lock
+	}
+}
+
+// conductorWithSources shares the remote sources fetched by the parent with the modules, see fetchSource
+func conductorWithSources(sources *sources) ConductorOption {
+	return func(c *Conductor) {
+		c.sources = sources
+	}
+}
+
+func ConductorWithModule(module *Module) ConductorOption {
+	return func(c *Conductor) {
+		c.module = module
+	}
+}
+
 func ConductorWithVariablesList(variables Variables) ConductorOption {
 	return func(c *Conductor) {
 		c.variables = variables
@@ -114,32 +197,108 @@ type Conductor struct {
 
 	variables Variables
 
+	// lock verifies the remote sources of the imports and the modules, see fetchSource.
+	// It is shared by the modules, and is nil unless the pipeline is run
+	lock *lockfile.Lock
+
+	// module is the module block which runs the pipeline of the conductor, it is
+	// nil unless the conductor was created for a module, see Module.run
+	module *Module
+
+	// varFileValues are the values of the variables read from the variable files,
+	// see ReadVarFiles. They are not inherited by the modules
+	varFileValues map[string]cty.Value
+
 	outputsMu sync.Mutex
-	outputs   map[string]*bytes.Buffer
+	outputs   map[string]*OutputStream
+
+	// outputValues are the values of the output blocks of the pipeline, evaluated by
+	// Pipeline.Run once the graph completed
+	outputValues OutputValues
+
+	// profiler records the spans of the run, it is nil unless profiling
+	// was requested through ConfigPipeline.Profile
+	profiler *profile.Profiler
+
+	// observer is notified of the changes in the state of the runnables, it is nil
+	// unless an interface like the terminal UI observes the run
+	observer Observer
+
+	// unchanged are the addresses of the stages and modules skipped by ConfigPipeline.ChangedSince
+	unchanged map[string]bool
+
+	// out is the writer of the grouped and prefixed output of the stages, outMu
+	// keeps the output of each stage contiguous
+	outMu sync.Mutex
+	out   io.Writer
+
+	// runLog records the output of the stages of the run in .togomak/runs, it is
+	// nil unless the pipeline is being run, see Pipeline.Run
+	runLog *runlog.Recorder
+
+	// metrics records the metrics of the run, it is nil unless they are exported, see metrics.Config
+	metrics *metrics.Metrics
+
+	// redactions are the sensitive values redacted from the output of the stages, the
+	// logs and the diagnostics, they are shared with the modules
+	redactions *Redactions
+
+	// sources are the remote sources fetched by the run, they are shared with the modules
+	sources *sources
+}
+
+// Unchanged reports if the stage or module at address is skipped, because none of
+// its paths changed since ConfigPipeline.ChangedSince
+func (c *Conductor) Unchanged(address string) bool {
+	return c.unchanged[address]
+}
+
+// OutputStream is the output of a stage. It is written by the stage while it runs,
+// and is safe to read concurrently
+type OutputStream struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (o *OutputStream) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.Write(p)
+}
+
+func (o *OutputStream) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.String()
 }
 
-func (c *Conductor) Outputs() map[string]*bytes.Buffer {
+// Outputs returns the output streams of the stages which have run, by the address of the stage
+func (c *Conductor) Outputs() map[string]*OutputStream {
 	c.outputsMu.Lock()
 	defer c.outputsMu.Unlock()
-	return c.outputs
+	outputs := make(map[string]*OutputStream, len(c.outputs))
+	for name, stream := range c.outputs {
+		outputs[name] = stream
+	}
+	return outputs
 }
 
-func (c *Conductor) OutputMemoryStream(name string) *bytes.Buffer {
+func (c *Conductor) OutputMemoryStream(name string) *OutputStream {
 	c.outputsMu.Lock()
 	defer c.outputsMu.Unlock()
 	if c.outputs == nil {
-		c.outputs = make(map[string]*bytes.Buffer)
+		c.outputs = make(map[string]*OutputStream)
 	}
 	return c.outputs[name]
 }
 
-func (c *Conductor) NewOutputMemoryStream(name string) *bytes.Buffer {
+func (c *Conductor) NewOutputMemoryStream(name string) *OutputStream {
 	c.outputsMu.Lock()
 	defer c.outputsMu.Unlock()
 	if c.outputs == nil {
-		c.outputs = make(map[string]*bytes.Buffer)
+		c.outputs = make(map[string]*OutputStream)
 	}
-	c.outputs[name] = bytes.NewBuffer(nil)
+	c.outputs[name] = &OutputStream{}
 	return c.outputs[name]
 }
 
@@ -154,6 +313,12 @@ func (p *Parser) ParseHCLFile(filename string) (*hcl.File, hcl.Diagnostics) {
 	return p.parser.ParseHCLFile(filename)
 }
 
+func (p *Parser) ParseJSONFile(filename string) (*hcl.File, hcl.Diagnostics) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.parser.ParseJSONFile(filename)
+}
+
 func (p *Parser) Files() map[string]*hcl.File {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
@@ -179,6 +344,12 @@ func (c *Conductor) StdinUnlock() {
 func (c *Conductor) Child(opts ...ConductorOption) *Conductor {
 	inheritOpts := []ConductorOption{
 		ConductorWithConfig(c.Config),
+		ConductorWithProfiler(c.profiler),
+		ConductorWithRunLog(c.runLog),
+		ConductorWithMetrics(c.metrics),
+		ConductorWithRedactions(c.redactions),
+		ConductorWithLock(c.lock),
+		conductorWithSources(c.sources),
 	}
 	opts = append(inheritOpts, opts...)
 	child := NewConductor(c.Config, opts...)
@@ -197,6 +368,23 @@ func (c *Conductor) RootParent() *Conductor {
 	return c.parent.RootParent()
 }
 
+func (c *Conductor) Profiler() *profile.Profiler {
+	return c.profiler
+}
+
+// Redactions returns the sensitive values redacted from the output, see Redactions
+func (c *Conductor) Redactions() *Redactions {
+	return c.redactions
+}
+
+func (c *Conductor) RunLog() *runlog.Recorder {
+	return c.runLog
+}
+
+func (c *Conductor) Metrics() *metrics.Metrics {
+	return c.metrics
+}
+
 func (c *Conductor) Logger() logrus.Ext1FieldLogger {
 	return c.RootLogger
 }
@@ -239,6 +427,18 @@ func (c *Conductor) Variables() Variables {
 	return c.variables
 }
 
+// VarFileValue returns the value of the variable id read from the variable files, see ReadVarFiles
+func (c *Conductor) VarFileValue(id string) (cty.Value, bool) {
+	v, ok := c.varFileValues[id]
+	return v, ok
+}
+
+// OutputValues returns the values of the output blocks of the pipeline, they are
+// only available once the pipeline ran successfully
+func (c *Conductor) OutputValues() OutputValues {
+	return c.outputValues
+}
+
 func Chdir(cfg ConductorConfig, logger *logrus.Logger) string {
 	cwd := cfg.Paths.Cwd
 	if cwd == "" {
@@ -271,6 +471,7 @@ func NewConductor(cfg ConductorConfig, opts ...ConductorOption) *Conductor {
 		IsCI:          cfg.Logging.IsCI,
 		JSON:          cfg.Logging.JSON,
 		CorrelationID: process.Id.String(),
+		Stderr:        cfg.Logging.Stderr,
 		Sinks:         cfg.Logging.Sinks,
 	})
 	if err != nil {
@@ -290,21 +491,27 @@ func NewConductor(cfg ConductorConfig, opts ...ConductorOption) *Conductor {
 			parser: parser,
 			mu:     &sync.RWMutex{},
 		},
-		DiagWriter: diagWriter,
 		ctx:        context.Background(),
 		Process:    process,
 		RootLogger: logger,
 		Config:     cfg,
+		redactions: &Redactions{},
+		sources:    &sources{fetched: make(map[string]*fetchedSource)},
 	}
+	c.DiagWriter = redactDiagWriter{writer: diagWriter, conductor: c}
 	for _, v := range cfg.Variables {
 		c.variables = append(c.variables, v)
 	}
+	if cfg.Pipeline.Profile != "" {
+		c.profiler = profile.New()
+	}
 
 	for _, opt := range opts {
 		opt(c)
 	}
+	addRedactHook(logger, c.redactions)
 	c.eval = &Eval{
-		context: CreateEvalContext(c.Config, process),
+		context: CreateEvalContext(c.Config, process, c.redactions),
 		mu:      &sync.RWMutex{},
 	}
 
@@ -323,6 +530,12 @@ func (c *Conductor) Destroy() {
 	}
 
 	c.Logger().Debug("destroying togomak")
+	if c.parent == nil {
+		c.sources.Release()
+		if err := logging.Close(c.logrusLogger()); err != nil {
+			c.Logger().Warn(err)
+		}
+	}
 
 	c.RootLogger = nil
 	c.Config = ConductorConfig{}
@@ -3,20 +3,64 @@ package ci
 import (
 	"github.com/srevinsaju/togomak/v1/internal/behavior"
 	"github.com/srevinsaju/togomak/v1/internal/logging"
+	"github.com/srevinsaju/togomak/v1/internal/metrics"
 	"github.com/srevinsaju/togomak/v1/internal/path"
+	"github.com/srevinsaju/togomak/v1/internal/profile"
 	"github.com/srevinsaju/togomak/v1/internal/rules"
+	"time"
 )
 
 type ConfigPipeline struct {
 	Filtered    rules.Operations
 	FilterQuery QueryEngines
 	DryRun      bool
+
+	// Exact selects only the stages and modules named by the Filtered rules, and not the
+	// stages and modules they depend on, see BlockFilterExplain
+	Exact bool
+
+	// Profile is the path where the Chrome trace-event profile of the run is written.
+	// Profiling is disabled if Profile is empty
+	Profile string
+
+	// Trace exports the spans of the run to an OpenTelemetry collector.
+	// Tracing is disabled if its endpoint is empty
+	Trace profile.OTLPConfig
+
+	// Metrics is where the metrics of the run are exported, see metrics.Config
+	Metrics metrics.Config
+
+	// ChangedSince is the git ref the changed files are computed against. Stages and
+	// modules with paths, none of which changed, are skipped. It is disabled if empty
+	ChangedSince string
+
+	// Upgrade accepts the remote sources which are not in the lock file, or which do not
+	// match it, instead of failing the run, and updates them in the lock file when it is
+	// written by togomak get or togomak vendor, see lockfile.Lock
+	Upgrade bool
+
+	// IgnoreVendor fetches the remote sources, even if they were vendored, see VendorDir
+	IgnoreVendor bool
+
+	// SourcesTTL is how long the copy of a remote source in the cache, whose ref may move, like a
+	// branch, is used before the source is fetched again, see cache.Entry.Fresh
+	SourcesTTL time.Duration
 }
 
 type Interface struct {
 	// Verbosity is the level of verbosity
 	Verbosity   int
 	JSONLogging bool
+
+	// TUI shows the interactive terminal UI instead of the logs. It falls back to the
+	// logs when the output is not a terminal, in CI, or in unattended mode
+	TUI bool
+
+	// Output is how the output of the stages is written, see OutputMode
+	Output OutputMode
+
+	// QuietSuccess writes the output of the failed stages only. It groups the output
+	QuietSuccess bool
 }
 
 type ConductorConfig struct {
@@ -35,5 +79,8 @@ type ConductorConfig struct {
 
 	Variables Variables
 
+	// VarFiles are the variable files passed with --var-file, see ReadVarFiles
+	VarFiles []string
+
 	Logging logging.Config
 }
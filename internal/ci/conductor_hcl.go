@@ -15,7 +15,7 @@ import (
 	"time"
 )
 
-func CreateEvalContext(cfg ConductorConfig, process Process) *hcl.EvalContext {
+func CreateEvalContext(cfg ConductorConfig, process Process, redactions *Redactions) *hcl.EvalContext {
 	// --> set up HCL context
 	paths := cfg.Paths
 	behavior := cfg.Behavior
@@ -88,7 +88,7 @@ func CreateEvalContext(cfg ConductorConfig, process Process) *hcl.EvalContext {
 			"replace":          funcs.ReplaceFunc,
 			"reverse":          stdlib.ReverseListFunc,
 			"rsadecrypt":       funcs.RsaDecryptFunc,
-			"sensitive":        funcs.SensitiveFunc,
+			"sensitive":        sensitiveFunc(redactions),
 			"nonsensitive":     funcs.NonsensitiveFunc,
 			"setintersection":  stdlib.SetIntersectionFunc,
 			"setproduct":       stdlib.SetProductFunc,
@@ -8,9 +8,10 @@ import (
 func (s *Data) Variables() []hcl.Traversal {
 	var traversal []hcl.Traversal
 	provider := dataBlock.DefaultProviders.Get(s.Provider)
-	// TODO: this will panic, if the provider is not found
 	if provider == nil {
-		panic("provider not found")
+		// the invalid provider is reported when the data block is run,
+		// or validated
+		return nil
 	}
 	provide := provider.New()
 	traversal = append(traversal, dataBlock.Variables(provide, s.Body)...)
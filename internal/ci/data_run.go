@@ -5,7 +5,9 @@ import (
 	"github.com/hashicorp/hcl/v2"
 	dataBlock "github.com/srevinsaju/togomak/v1/internal/blocks/data"
 	"github.com/srevinsaju/togomak/v1/internal/global"
+	"github.com/srevinsaju/togomak/v1/internal/profile"
 	"github.com/srevinsaju/togomak/v1/internal/runnable"
+	"github.com/srevinsaju/togomak/v1/internal/x"
 	"github.com/zclconf/go-cty/cty"
 )
 
@@ -41,6 +43,7 @@ func (s *Data) Run(conductor *Conductor, options ...runnable.Option) (diags hcl.
 	for _, pr := range dataBlock.DefaultProviders {
 		if pr.Name() == s.Provider {
 			validProvider = true
+			span := conductor.Profiler().Start(profile.CategoryData, x.RenderBlock(DataBlock, s.Provider, s.Id), fmt.Sprintf("provider %s", s.Provider))
 			provide := pr.New()
 			provide.SetContext(ctx)
 			diags = diags.Extend(provide.DecodeBody(conductor, s.Body, opts...))
@@ -48,6 +51,7 @@ func (s *Data) Run(conductor *Conductor, options ...runnable.Option) (diags hcl.
 			diags = diags.Extend(d)
 			attr, d = provide.Attributes(conductor, ctx, s.Id, opts...)
 			diags = diags.Extend(d)
+			span.End()
 			break
 		}
 	}
@@ -0,0 +1,592 @@
+package ci
+
+import (
+	"context"
+	"fmt"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/kendru/darwin/go/depgraph"
+	"github.com/srevinsaju/togomak/v1/internal/blocks"
+	"github.com/srevinsaju/togomak/v1/internal/c"
+	"github.com/srevinsaju/togomak/v1/internal/runnable"
+	"github.com/srevinsaju/togomak/v1/internal/third-party/hashicorp/terraform/lang/marks"
+	"github.com/zclconf/go-cty/cty"
+	"sort"
+	"strings"
+)
+
+const describeUnknown = "(known after run)"
+
+// DescribeAttribute is an evaluated attribute of a block
+type DescribeAttribute struct {
+	Name  string
+	Value cty.Value
+}
+
+// BlockDescription is the fully evaluated configuration of a block, as shown by togomak describe
+type BlockDescription struct {
+	Address    string
+	Attributes []DescribeAttribute
+}
+
+func (d *BlockDescription) add(name string, v cty.Value) {
+	d.Attributes = append(d.Attributes, DescribeAttribute{Name: name, Value: v})
+}
+
+// parseDescribeAddress parses addresses like stage.build, module.api["prod"] or data.git.repo,
+// into the id of the block in the dependency graph, and the key of the for_each instance, if any
+func parseDescribeAddress(address string) (string, cty.Value, hcl.Diagnostics) {
+	traversal, diags := hclsyntax.ParseTraversalAbs([]byte(address), "<address>", hcl.InitialPos)
+	if diags.HasErrors() {
+		return "", cty.NilVal, diags
+	}
+	id, diags := ResolveFromTraversal(traversal)
+	if diags.HasErrors() {
+		return "", cty.NilVal, diags
+	}
+
+	n := 2
+	if traversal.RootName() == DataBlock {
+		n = 3
+	}
+	if id == "" || len(traversal) > n+1 {
+		return "", cty.NilVal, diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid address",
+			Detail:   fmt.Sprintf("%q is not the address of a block, expected an address like stage.build, module.api[\"prod\"] or data.git.repo", address),
+		})
+	}
+	if len(traversal) == n {
+		return id, cty.NilVal, diags
+	}
+	index, ok := traversal[n].(hcl.TraverseIndex)
+	if !ok {
+		return "", cty.NilVal, diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid address",
+			Detail:   fmt.Sprintf("%q is not the address of a block, only the key of a for_each instance may follow the name of the block", address),
+			Subject:  traversal[n].SourceRange().Ptr(),
+		})
+	}
+	return id, index.Key, diags
+}
+
+// describeEach finds the for_each instance with the given key, and returns the option
+// which populates each.key and each.value. key is cty.NilVal if the address did not have a key
+func describeEach(conductor *Conductor, address string, forEach hcl.Expression, key cty.Value) ([]runnable.Option, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	if !exprIsSet(forEach) {
+		if key != cty.NilVal {
+			return nil, diags.Append(&hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Unexpected instance key",
+				Detail:   fmt.Sprintf("%s does not use for_each, and cannot be addressed with a key", address),
+			})
+		}
+		return nil, diags
+	}
+
+	conductor.Eval().Mutex().RLock()
+	items, d := forEach.Value(conductor.Eval().Context())
+	conductor.Eval().Mutex().RUnlock()
+	diags = diags.Extend(d)
+	if d.HasErrors() {
+		return nil, diags
+	}
+	if items.IsNull() || !items.IsWhollyKnown() || !items.CanIterateElements() {
+		return nil, diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "invalid type for for_each",
+			Detail:   "for_each must be a set or map of objects",
+			Subject:  forEach.Range().Ptr(),
+		})
+	}
+	items, _ = items.Unmark()
+
+	// the keys are derived the same way as Stage.Run and Module.Run
+	var keys []string
+	var opts []runnable.Option
+	counter := 0
+	items.ForEachElement(func(k cty.Value, v cty.Value) bool {
+		keyCty := cty.NumberIntVal(int64(counter))
+		if k.Type() == cty.String {
+			keyCty = k
+		}
+		counter++
+		keys = append(keys, renderValue(keyCty, ""))
+		if key != cty.NilVal && keyCty.Type() == key.Type() && keyCty.Equals(key).True() {
+			opts = append(opts, runnable.WithEach(keyCty, v))
+			return true
+		}
+		return false
+	})
+	if opts != nil {
+		return opts, diags
+	}
+
+	summary, detail := "Missing instance key", fmt.Sprintf("%s uses for_each, the key of an instance is required", address)
+	if key != cty.NilVal {
+		summary, detail = "Invalid instance key", fmt.Sprintf("%s does not have an instance with the key %s", address, renderValue(key, ""))
+	}
+	return nil, diags.Append(&hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  summary,
+		Detail:   fmt.Sprintf("%s, available keys are %s", detail, strings.Join(keys, ", ")),
+		Subject:  forEach.Range().Ptr(),
+	})
+}
+
+// describeExpr evaluates expr, the value is unknown if it could not be evaluated
+func describeExpr(conductor *Conductor, evalCtx *hcl.EvalContext, expr hcl.Expression) (cty.Value, hcl.Diagnostics) {
+	conductor.Eval().Mutex().RLock()
+	v, diags := expr.Value(evalCtx)
+	conductor.Eval().Mutex().RUnlock()
+	if diags.HasErrors() {
+		return cty.DynamicVal, diags
+	}
+	return v, diags
+}
+
+func describeLifecycle(conductor *Conductor, evalCtx *hcl.EvalContext, lifecycle *Lifecycle) (cty.Value, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	attrs := map[string]cty.Value{}
+	if exprIsSet(lifecycle.Phase) {
+		v, d := describeExpr(conductor, evalCtx, lifecycle.Phase)
+		diags = diags.Extend(d)
+		attrs["phase"] = v
+	}
+	if exprIsSet(lifecycle.Timeout) {
+		v, d := describeExpr(conductor, evalCtx, lifecycle.Timeout)
+		diags = diags.Extend(d)
+		attrs["timeout"] = v
+	}
+	return cty.ObjectVal(attrs), diags
+}
+
+func (s *Stage) describe(conductor *Conductor, description *BlockDescription, options ...runnable.Option) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	cfg := runnable.NewConfig(options...)
+
+	// macros which provide files read the statuses of the child stages from the filters
+	s.Set(StageContextChildStatuses, conductor.Config.Pipeline.Filtered.Children(description.Address).Marshall())
+
+	s, d := s.expandMacros(conductor, options...)
+	diags = diags.Extend(d)
+	if d.HasErrors() {
+		return diags
+	}
+
+	evalCtx, _, d := s.evalContext(conductor, conductor.Eval().Context(), cfg)
+	diags = diags.Extend(d)
+
+	eval := func(name string, expr hcl.Expression) cty.Value {
+		v, d := describeExpr(conductor, evalCtx, expr)
+		diags = diags.Extend(d)
+		description.add(name, v)
+		return v
+	}
+
+	if s.Name != "" {
+		description.add("name", cty.StringVal(s.Name))
+	}
+	if exprIsSet(s.Condition) {
+		eval("if", s.Condition)
+	}
+
+	dir := cty.StringVal(cfg.Paths.Cwd)
+	if exprIsSet(s.Dir) {
+		v, d := describeExpr(conductor, evalCtx, s.Dir)
+		diags = diags.Extend(d)
+		if !v.IsKnown() || v.HasMark(marks.Sensitive) || (!v.IsNull() && v.Type() == cty.String && v.AsString() != "") {
+			dir = v
+		}
+	}
+	description.add("dir", dir)
+
+	if exprIsSet(s.Script) {
+		// the same default as Stage.parseExecCommand
+		shell := cty.StringVal("bash")
+		if exprIsSet(s.Shell) {
+			v, d := describeExpr(conductor, evalCtx, s.Shell)
+			diags = diags.Extend(d)
+			shell = v
+		}
+		description.add("shell", shell)
+		eval("script", s.Script)
+	}
+	if exprIsSet(s.Args) {
+		eval("args", s.Args)
+	}
+
+	if len(s.Environment) > 0 {
+		env := map[string]cty.Value{}
+		for _, e := range s.Environment {
+			v, d := describeExpr(conductor, evalCtx, e.Value)
+			diags = diags.Extend(d)
+			env[e.Name] = v
+		}
+		description.add("env", cty.ObjectVal(env))
+	}
+
+	if s.Container != nil {
+		container := map[string]cty.Value{
+			"skip_workspace": cty.BoolVal(s.Container.SkipWorkspace),
+			"stdin":          cty.BoolVal(s.Container.Stdin),
+		}
+		v, d := describeExpr(conductor, evalCtx, s.Container.Image)
+		diags = diags.Extend(d)
+		container["image"] = v
+		if exprIsSet(s.Container.Entrypoint) {
+			v, d := describeExpr(conductor, evalCtx, s.Container.Entrypoint)
+			diags = diags.Extend(d)
+			container["entrypoint"] = v
+		}
+		var volumes []cty.Value
+		for _, volume := range s.Container.Volumes {
+			source, d := describeExpr(conductor, evalCtx, volume.Source)
+			diags = diags.Extend(d)
+			destination, d := describeExpr(conductor, evalCtx, volume.Destination)
+			diags = diags.Extend(d)
+			volumes = append(volumes, cty.ObjectVal(map[string]cty.Value{"source": source, "destination": destination}))
+		}
+		if volumes != nil {
+			container["volume"] = cty.TupleVal(volumes)
+		}
+		var ports []cty.Value
+		for _, port := range s.Container.Ports {
+			attrs := map[string]cty.Value{}
+			for name, expr := range map[string]hcl.Expression{"host": port.Hostname, "container_port": port.ContainerPort, "port": port.Port} {
+				if !exprIsSet(expr) {
+					continue
+				}
+				v, d := describeExpr(conductor, evalCtx, expr)
+				diags = diags.Extend(d)
+				attrs[name] = v
+			}
+			ports = append(ports, cty.ObjectVal(attrs))
+		}
+		if ports != nil {
+			container["port"] = cty.TupleVal(ports)
+		}
+		description.add("container", cty.ObjectVal(container))
+	}
+
+	if s.Lifecycle != nil {
+		v, d := describeLifecycle(conductor, evalCtx, s.Lifecycle)
+		diags = diags.Extend(d)
+		description.add("lifecycle", v)
+	}
+	if s.IsDaemon() {
+		description.add("daemon", cty.True)
+	}
+	if s.Retry != nil && s.Retry.Enabled {
+		description.add("retry", cty.ObjectVal(map[string]cty.Value{
+			"attempts":            cty.NumberIntVal(int64(s.Retry.Attempts)),
+			"exponential_backoff": cty.BoolVal(s.Retry.ExponentialBackoff),
+		}))
+	}
+	return diags
+}
+
+func (m *Module) describe(conductor *Conductor, description *BlockDescription, options ...runnable.Option) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	cfg := runnable.NewConfig(options...)
+
+	// the same evaluation context as Module.Run, each is also available to the inputs
+	evalCtx := conductor.Eval().Context().NewChild()
+	evalCtx.Variables = map[string]cty.Value{
+		ThisBlock: cty.ObjectVal(map[string]cty.Value{
+			"id":     cty.StringVal(m.Id),
+			"status": cty.StringVal(string(cfg.Status.Status)),
+		}),
+	}
+	if cfg.Each != nil {
+		evalCtx.Variables[EachBlock] = cty.ObjectVal(cfg.Each)
+	}
+
+	eval := func(name string, expr hcl.Expression) {
+		v, d := describeExpr(conductor, evalCtx, expr)
+		diags = diags.Extend(d)
+		description.add(name, v)
+	}
+
+	if m.Name != "" {
+		description.add("name", cty.StringVal(m.Name))
+	}
+	if exprIsSet(m.Condition) {
+		eval("if", m.Condition)
+	}
+	eval("source", m.Source)
+
+	attrs, d := m.Body.JustAttributes()
+	diags = diags.Extend(d)
+	if len(attrs) > 0 {
+		inputs := map[string]cty.Value{}
+		for name, attr := range attrs {
+			v, d := describeExpr(conductor, evalCtx, attr.Expr)
+			diags = diags.Extend(d)
+			inputs[name] = v
+		}
+		description.add("inputs", cty.ObjectVal(inputs))
+	}
+
+	if m.Lifecycle != nil {
+		v, d := describeLifecycle(conductor, evalCtx, m.Lifecycle)
+		diags = diags.Extend(d)
+		description.add("lifecycle", v)
+	}
+	if m.Daemon != nil && m.Daemon.Enabled {
+		description.add("daemon", cty.True)
+	}
+	return diags
+}
+
+// describeValue describes the blocks which store their value in the evaluation
+// context when they are run, like var, local, data and macro blocks
+func describeValue(conductor *Conductor, description *BlockDescription, id string) hcl.Diagnostics {
+	traversal, diags := hclsyntax.ParseTraversalAbs([]byte(id), "<address>", hcl.InitialPos)
+	if diags.HasErrors() {
+		return diags
+	}
+	conductor.Eval().Mutex().RLock()
+	v, diags := traversal.TraverseAbs(conductor.Eval().Context())
+	conductor.Eval().Mutex().RUnlock()
+	if diags.HasErrors() {
+		return diags
+	}
+
+	if v.IsKnown() && !v.IsNull() && !v.HasMark(marks.Sensitive) && v.Type().IsObjectType() {
+		for name, attr := range v.AsValueMap() {
+			description.add(name, attr)
+		}
+		sort.SliceStable(description.Attributes, func(i, j int) bool {
+			return description.Attributes[i].Name < description.Attributes[j].Name
+		})
+		return diags
+	}
+	description.add("value", v)
+	return diags
+}
+
+// describeVariables returns the references of the attributes which are evaluated by describe
+// in addition to those returned by Variables, like the shell and the container image of a stage,
+// or the inputs of a module
+func describeVariables(block Block) []hcl.Traversal {
+	var vars []hcl.Traversal
+	switch block := block.(type) {
+	case *Stage:
+		vars = append(vars, block.Shell.Variables()...)
+		if block.ForEach != nil {
+			vars = append(vars, block.ForEach.Variables()...)
+		}
+		if block.Container != nil {
+			vars = append(vars, block.Container.Image.Variables()...)
+			vars = append(vars, block.Container.Entrypoint.Variables()...)
+		}
+	case *Module:
+		attrs, _ := block.Body.JustAttributes()
+		for _, attr := range attrs {
+			vars = append(vars, attr.Expr.Variables()...)
+		}
+	}
+	return vars
+}
+
+// Describe evaluates the block at address the same way it would be evaluated when the pipeline
+// is run. The variables, locals, data and macro blocks it depends on are run, the stages and
+// modules are not, and references to them are unknown. It is expected that the imports and
+// the locals are expanded before Describe is called.
+func (pipe *Pipeline) Describe(conductor *Conductor, depGraph *depgraph.Graph, address string, opts ...runnable.Option) (*BlockDescription, hcl.Diagnostics) {
+	id, key, diags := parseDescribeAddress(address)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	target, _, d := pipe.Resolve(id)
+	diags = diags.Extend(d)
+	if d.HasErrors() {
+		return nil, diags
+	}
+
+	// Stage.expandMacros resolves the macros from the pipeline stored in the context
+	ctx := context.WithValue(conductor.Context(), c.TogomakContextPipeline, pipe)
+	conductor.Update(ConductorWithContext(ctx))
+
+	isRunnable := func(ty string) bool {
+		return ty == blocks.StageBlock || ty == blocks.ModuleBlock
+	}
+
+	// describe evaluates attributes which are not part of the dependency graph of the block,
+	// like the container image, the blocks they refer to are run as well
+	deps := make(map[string]struct{})
+	for dep := range depGraph.Dependencies(id) {
+		deps[dep] = struct{}{}
+	}
+	for _, variable := range describeVariables(target) {
+		ref, d := ResolveFromTraversal(variable)
+		if d.HasErrors() || ref == "" {
+			continue
+		}
+		deps[ref] = struct{}{}
+		for dep := range depGraph.Dependencies(ref) {
+			deps[dep] = struct{}{}
+		}
+	}
+	for _, layer := range depGraph.TopoSortedLayers() {
+		for _, runnableId := range layer {
+			_, isDep := deps[runnableId]
+			if !isDep && (runnableId != id || isRunnable(target.Type())) {
+				continue
+			}
+			block, skip, d := pipe.Resolve(runnableId)
+			diags = diags.Extend(d)
+			if skip || d.HasErrors() || isRunnable(block.Type()) {
+				continue
+			}
+			diags = diags.Extend(block.Run(conductor, opts...))
+		}
+	}
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	// stages and modules are not run, references to them are unknown
+	conductor.Eval().Mutex().Lock()
+	for _, ty := range []string{blocks.StageBlock, blocks.ModuleBlock} {
+		if _, ok := conductor.Eval().Context().Variables[ty]; !ok {
+			conductor.Eval().Context().Variables[ty] = cty.DynamicVal
+		}
+	}
+	conductor.Eval().Mutex().Unlock()
+
+	description := &BlockDescription{Address: address}
+	switch block := target.(type) {
+	case *Stage:
+		each, d := describeEach(conductor, address, block.ForEach, key)
+		diags = diags.Extend(d)
+		if d.HasErrors() {
+			return nil, diags
+		}
+		diags = diags.Extend(block.describe(conductor, description, append(opts, each...)...))
+	case *Module:
+		each, d := describeEach(conductor, address, block.ForEach, key)
+		diags = diags.Extend(d)
+		if d.HasErrors() {
+			return nil, diags
+		}
+		diags = diags.Extend(block.describe(conductor, description, append(opts, each...)...))
+	default:
+		if key != cty.NilVal {
+			return nil, diags.Append(&hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Unexpected instance key",
+				Detail:   fmt.Sprintf("%s blocks cannot be addressed with a key", target.Type()),
+			})
+		}
+		if data, ok := target.(*Data); ok {
+			description.add("provider", cty.StringVal(data.Provider))
+		}
+		diags = diags.Extend(describeValue(conductor, description, id))
+	}
+
+	// the direct dependencies, as shown by togomak graph
+	var dependencies []cty.Value
+	for _, edge := range NewGraphExport(depGraph, GraphExportConfig{HideInternal: true}).Edges {
+		if edge.To == id {
+			dependencies = append(dependencies, cty.StringVal(edge.From))
+		}
+	}
+	if dependencies != nil {
+		description.add("dependencies", cty.TupleVal(dependencies))
+	}
+	return description, diags
+}
+
+// renderValue renders v in the HCL syntax. Values marked as sensitive are redacted, and
+// values which depend on stages or modules are shown as unknown
+func renderValue(v cty.Value, indent string) string {
+	if v.HasMark(marks.Sensitive) {
+		return sensitiveValue
+	}
+	if !v.IsKnown() {
+		return describeUnknown
+	}
+	if v.IsNull() {
+		return "null"
+	}
+	v, _ = v.Unmark()
+	ty := v.Type()
+
+	switch {
+	case ty == cty.String && strings.Contains(v.AsString(), "\n"):
+		var b strings.Builder
+		b.WriteString("<<-EOT\n")
+		for _, line := range strings.Split(strings.TrimSuffix(v.AsString(), "\n"), "\n") {
+			if line == "" {
+				b.WriteString("\n")
+				continue
+			}
+			b.WriteString(indent + "  " + line + "\n")
+		}
+		b.WriteString(indent + "EOT")
+		return b.String()
+	case ty.IsPrimitiveType():
+		return string(hclwrite.TokensForValue(v).Bytes())
+	case ty.IsListType() || ty.IsSetType() || ty.IsTupleType():
+		if v.LengthInt() == 0 {
+			return "[]"
+		}
+		var b strings.Builder
+		b.WriteString("[\n")
+		for it := v.ElementIterator(); it.Next(); {
+			_, e := it.Element()
+			b.WriteString(indent + "  " + renderValue(e, indent+"  ") + ",\n")
+		}
+		b.WriteString(indent + "]")
+		return b.String()
+	case ty.IsMapType() || ty.IsObjectType():
+		if v.LengthInt() == 0 {
+			return "{}"
+		}
+		var names []string
+		var elems []cty.Value
+		width := 0
+		for it := v.ElementIterator(); it.Next(); {
+			k, e := it.Element()
+			name := k.AsString()
+			if !hclsyntax.ValidIdentifier(name) {
+				name = fmt.Sprintf("%q", name)
+			}
+			if len(name) > width {
+				width = len(name)
+			}
+			names = append(names, name)
+			elems = append(elems, e)
+		}
+		var b strings.Builder
+		b.WriteString("{\n")
+		for i, name := range names {
+			b.WriteString(fmt.Sprintf("%s  %-*s = %s\n", indent, width, name, renderValue(elems[i], indent+"  ")))
+		}
+		b.WriteString(indent + "}")
+		return b.String()
+	}
+	return describeUnknown
+}
+
+// String renders the description in the HCL syntax
+func (d *BlockDescription) String() string {
+	width := 0
+	for _, attr := range d.Attributes {
+		if len(attr.Name) > width {
+			width = len(attr.Name)
+		}
+	}
+	var b strings.Builder
+	b.WriteString(d.Address + " {\n")
+	for _, attr := range d.Attributes {
+		b.WriteString(fmt.Sprintf("  %-*s = %s\n", width, attr.Name, renderValue(attr.Value, "  ")))
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
@@ -0,0 +1,93 @@
+package ci
+
+import (
+	"fmt"
+	"github.com/srevinsaju/togomak/v1/internal/path"
+	"github.com/srevinsaju/togomak/v1/internal/runnable"
+	"github.com/srevinsaju/togomak/v1/internal/third-party/hashicorp/terraform/lang/marks"
+	"github.com/stretchr/testify/assert"
+	"github.com/zclconf/go-cty/cty"
+	"os"
+	"testing"
+)
+
+func TestParseDescribeAddress(t *testing.T) {
+	id, key, diags := parseDescribeAddress(`module.api["prod"]`)
+	assert.False(t, diags.HasErrors())
+	assert.Equal(t, "module.api", id)
+	assert.Equal(t, cty.StringVal("prod"), key)
+
+	id, key, diags = parseDescribeAddress("data.git.repo")
+	assert.False(t, diags.HasErrors())
+	assert.Equal(t, "data.git.repo", id)
+	assert.Equal(t, cty.NilVal, key)
+
+	_, _, diags = parseDescribeAddress("stage.build.id")
+	assert.True(t, diags.HasErrors())
+	_, _, diags = parseDescribeAddress("stage")
+	assert.True(t, diags.HasErrors())
+}
+
+func TestRenderValue(t *testing.T) {
+	v := cty.ObjectVal(map[string]cty.Value{
+		"image": cty.StringVal("alpine"),
+		"token": cty.StringVal("hunter2").Mark(marks.Sensitive),
+		"tag":   cty.UnknownVal(cty.String),
+		"args":  cty.ListVal([]cty.Value{cty.StringVal("-c")}),
+	})
+	assert.Equal(t, `{
+  args  = [
+    "-c",
+  ]
+  image = "alpine"
+  tag   = (known after run)
+  token = (sensitive value)
+}`, renderValue(v, ""))
+	assert.Equal(t, "<<-EOT\n  echo a\n  echo b\nEOT", renderValue(cty.StringVal("echo a\necho b\n"), ""))
+}
+
+func TestPipeline_Describe(t *testing.T) {
+	cwd, err := os.Getwd()
+	assert.NoError(t, err)
+	conductor := newTestConductor(ConductorConfig{Paths: &path.Path{Cwd: cwd}})
+
+	src := `
+togomak {
+  version = 2
+}
+locals {
+  token = sensitive("hunter2")
+  image = "alpine"
+}
+stage "build" {
+  for_each = toset(["a", "b"])
+  script   = "echo ${each.key}"
+  env {
+    name  = "TOKEN"
+    value = local.token
+  }
+  container {
+    image = local.image
+  }
+}
+`
+	pipe := &Pipeline{}
+	decodeConfig(t, src, pipe)
+	locals, diags := pipe.Locals.Expand()
+	assert.False(t, diags.HasErrors())
+	pipe.Local = locals
+	depGraph, diags := GraphTopoSort(conductor, pipe)
+	assert.False(t, diags.HasErrors())
+
+	_, diags = pipe.Describe(conductor, depGraph, "stage.build", runnable.WithPaths(conductor.Config.Paths))
+	assert.True(t, diags.HasErrors())
+
+	description, diags := pipe.Describe(conductor, depGraph, `stage.build["b"]`, runnable.WithPaths(conductor.Config.Paths))
+	assert.False(t, diags.HasErrors())
+	out := description.String()
+	assert.Contains(t, out, `script       = "echo b"`)
+	assert.Contains(t, out, `TOKEN = (sensitive value)`)
+	assert.Contains(t, out, `image          = "alpine"`)
+	assert.Contains(t, out, fmt.Sprintf("dir          = %q", cwd))
+	assert.NotContains(t, out, "hunter2")
+}
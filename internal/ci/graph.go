@@ -26,6 +26,12 @@ func GraphResolve(ctx context.Context, pipe *Pipeline, g *depgraph.Graph, v []hc
 		}
 
 		_, d = Resolve(pipe, parent)
+		for _, diag := range d {
+			// Resolve does not know where the block was referenced from
+			if diag.Subject == nil {
+				diag.Subject = variable.SourceRange().Ptr()
+			}
+		}
 		diags = diags.Extend(d)
 		err := g.DependOn(child, parent)
 
@@ -34,6 +40,7 @@ func GraphResolve(ctx context.Context, pipe *Pipeline, g *depgraph.Graph, v []hc
 				Severity: hcl.DiagError,
 				Summary:  "Invalid dependency",
 				Detail:   err.Error(),
+				Subject:  variable.SourceRange().Ptr(),
 			})
 		}
 
@@ -151,6 +158,23 @@ func GraphTopoSort(conductor *Conductor, pipe *Pipeline) (*depgraph.Graph, hcl.D
 		diags = diags.Extend(d)
 	}
 
+	// the outputs are evaluated once the graph completed, they are not a part of it,
+	// but the blocks they refer to must exist
+	for _, variable := range pipe.Outputs.Variables() {
+		parent, d := ResolveFromTraversal(variable)
+		diags = diags.Extend(d)
+		if parent == "" {
+			continue
+		}
+		_, d = Resolve(pipe, parent)
+		for _, diag := range d {
+			if diag.Subject == nil {
+				diag.Subject = variable.SourceRange().Ptr()
+			}
+		}
+		diags = diags.Extend(d)
+	}
+
 	for i, layer := range g.TopoSortedLayers() {
 		logger.Debugf("layer %d: %s", i, layer)
 	}
@@ -0,0 +1,245 @@
+package ci
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/kendru/darwin/go/depgraph"
+	"github.com/srevinsaju/togomak/v1/internal/meta"
+	"sort"
+	"strings"
+)
+
+const (
+	GraphFormatDot     = "dot"
+	GraphFormatMermaid = "mermaid"
+	GraphFormatJSON    = "json"
+)
+
+var GraphFormats = []string{GraphFormatDot, GraphFormatMermaid, GraphFormatJSON}
+
+type GraphExportConfig struct {
+	// HideInternal hides the togomak.root, togomak.pre and togomak.post nodes.
+	// The dependencies through the hidden nodes are preserved
+	HideInternal bool
+
+	// Collapse merges all the nodes of the same block type into a single node
+	Collapse bool
+
+	// Selection marks the stages and modules which would run with the
+	// filters and queries passed on the command line. Runnables which are absent
+	// from Selection are not highlighted
+	Selection map[string]bool
+}
+
+type GraphNode struct {
+	Id   string `json:"id"`
+	Type string `json:"type"`
+
+	// Selected is nil when no filter or query was passed, or when the node
+	// is not a stage or a module
+	Selected *bool `json:"selected,omitempty"`
+}
+
+// GraphEdge is a dependency between two nodes, From needs to complete before To runs
+type GraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type GraphExport struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+func graphNodeType(id string) string {
+	return strings.SplitN(id, ".", 2)[0]
+}
+
+func graphNodeInternal(id string) bool {
+	return id == meta.RootStage || id == meta.PreStage || id == meta.PostStage
+}
+
+// NewGraphExport creates an exportable view of the dependency graph. depgraph.Graph only
+// exposes the transitive dependencies of a node, the exported edges are the transitive
+// reduction of the graph, which drops the dependencies implied by other dependencies.
+func NewGraphExport(g *depgraph.Graph, cfg GraphExportConfig) *GraphExport {
+	var nodes []string
+	for _, node := range g.TopoSorted() {
+		if cfg.HideInternal && graphNodeInternal(node) {
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+
+	deps := make(map[string]map[string]bool)
+	for _, node := range nodes {
+		deps[node] = make(map[string]bool)
+		for dep := range g.Dependencies(node) {
+			if cfg.HideInternal && graphNodeInternal(dep) {
+				continue
+			}
+			deps[node][dep] = true
+		}
+	}
+
+	export := &GraphExport{}
+	for _, node := range nodes {
+		n := GraphNode{Id: node, Type: graphNodeType(node)}
+		if selected, ok := cfg.Selection[node]; ok {
+			selected := selected
+			n.Selected = &selected
+		}
+		export.Nodes = append(export.Nodes, n)
+
+		for dep := range deps[node] {
+			implied := false
+			for other := range deps[node] {
+				if other != dep && deps[other][dep] {
+					implied = true
+					break
+				}
+			}
+			if !implied {
+				export.Edges = append(export.Edges, GraphEdge{From: dep, To: node})
+			}
+		}
+	}
+
+	if cfg.Collapse {
+		export = export.collapse()
+	}
+	export.sort()
+	return export
+}
+
+// collapse merges the nodes of the same block type together, a collapsed node is selected
+// if any of its members is selected
+func (e *GraphExport) collapse() *GraphExport {
+	collapsed := &GraphExport{}
+	index := make(map[string]int)
+	for _, node := range e.Nodes {
+		i, ok := index[node.Type]
+		if !ok {
+			i = len(collapsed.Nodes)
+			index[node.Type] = i
+			collapsed.Nodes = append(collapsed.Nodes, GraphNode{Id: node.Type, Type: node.Type})
+		}
+		if node.Selected != nil {
+			selected := *node.Selected
+			if collapsed.Nodes[i].Selected != nil {
+				selected = selected || *collapsed.Nodes[i].Selected
+			}
+			collapsed.Nodes[i].Selected = &selected
+		}
+	}
+
+	seen := make(map[GraphEdge]bool)
+	for _, edge := range e.Edges {
+		ce := GraphEdge{From: graphNodeType(edge.From), To: graphNodeType(edge.To)}
+		if ce.From == ce.To || seen[ce] {
+			continue
+		}
+		seen[ce] = true
+		collapsed.Edges = append(collapsed.Edges, ce)
+	}
+	return collapsed
+}
+
+func (e *GraphExport) sort() {
+	sort.SliceStable(e.Nodes, func(i, j int) bool {
+		return e.Nodes[i].Id < e.Nodes[j].Id
+	})
+	sort.SliceStable(e.Edges, func(i, j int) bool {
+		if e.Edges[i].From != e.Edges[j].From {
+			return e.Edges[i].From < e.Edges[j].From
+		}
+		return e.Edges[i].To < e.Edges[j].To
+	})
+}
+
+// Render renders the graph in one of GraphFormats
+func (e *GraphExport) Render(format string) (string, error) {
+	switch format {
+	case GraphFormatDot:
+		return e.Dot(), nil
+	case GraphFormatMermaid:
+		return e.Mermaid(), nil
+	case GraphFormatJSON:
+		data, err := json.MarshalIndent(e, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(data) + "\n", nil
+	}
+	return "", fmt.Errorf("unsupported graph format %q, expected one of %s", format, strings.Join(GraphFormats, ", "))
+}
+
+// Dot renders the graph in the Graphviz DOT language
+func (e *GraphExport) Dot() string {
+	var b strings.Builder
+	b.WriteString("digraph togomak {\n")
+	b.WriteString("  rankdir = \"LR\";\n")
+	b.WriteString("  node [shape = \"box\", style = \"rounded\"];\n")
+	for _, node := range e.Nodes {
+		var attrs []string
+		attrs = append(attrs, fmt.Sprintf("label = %q", node.Id))
+		if graphNodeInternal(node.Id) || node.Type == meta.AppName {
+			attrs = append(attrs, "shape = \"diamond\"")
+		}
+		if node.Selected != nil {
+			if *node.Selected {
+				attrs = append(attrs, "style = \"rounded,filled,bold\"", "fillcolor = \"palegreen\"")
+			} else {
+				attrs = append(attrs, "style = \"rounded,dashed\"", "color = \"grey\"", "fontcolor = \"grey\"")
+			}
+		}
+		b.WriteString(fmt.Sprintf("  %q [%s];\n", node.Id, strings.Join(attrs, ", ")))
+	}
+	for _, edge := range e.Edges {
+		b.WriteString(fmt.Sprintf("  %q -> %q;\n", edge.From, edge.To))
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func mermaidId(id string) string {
+	r := strings.NewReplacer(".", "_", "[", "_", "]", "_", "\"", "", " ", "_", "-", "_")
+	return r.Replace(id)
+}
+
+// Mermaid renders the graph as a Mermaid flowchart, which is rendered
+// natively by GitHub and GitLab in markdown documents
+func (e *GraphExport) Mermaid() string {
+	var b strings.Builder
+	var selected, skipped []string
+	b.WriteString("flowchart LR\n")
+	for _, node := range e.Nodes {
+		id := mermaidId(node.Id)
+		if graphNodeInternal(node.Id) || node.Type == meta.AppName {
+			b.WriteString(fmt.Sprintf("  %s{{\"%s\"}}\n", id, node.Id))
+		} else {
+			b.WriteString(fmt.Sprintf("  %s[\"%s\"]\n", id, node.Id))
+		}
+		if node.Selected != nil {
+			if *node.Selected {
+				selected = append(selected, id)
+			} else {
+				skipped = append(skipped, id)
+			}
+		}
+	}
+	for _, edge := range e.Edges {
+		b.WriteString(fmt.Sprintf("  %s --> %s\n", mermaidId(edge.From), mermaidId(edge.To)))
+	}
+	if len(selected) > 0 || len(skipped) > 0 {
+		b.WriteString("  classDef selected fill:#98fb98,stroke:#2e8b57,stroke-width:2px\n")
+		b.WriteString("  classDef skipped fill:#f5f5f5,stroke:#a9a9a9,color:#a9a9a9,stroke-dasharray:5 5\n")
+	}
+	if len(selected) > 0 {
+		b.WriteString(fmt.Sprintf("  class %s selected\n", strings.Join(selected, ",")))
+	}
+	if len(skipped) > 0 {
+		b.WriteString(fmt.Sprintf("  class %s skipped\n", strings.Join(skipped, ",")))
+	}
+	return b.String()
+}
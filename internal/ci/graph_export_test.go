@@ -0,0 +1,79 @@
+package ci
+
+import (
+	"github.com/kendru/darwin/go/depgraph"
+	"strings"
+	"testing"
+)
+
+func testExportGraph() *depgraph.Graph {
+	g := depgraph.New()
+	_ = g.DependOn("togomak.pre", "togomak.root")
+	_ = g.DependOn("stage.a", "togomak.pre")
+	_ = g.DependOn("stage.b", "stage.a")
+	_ = g.DependOn("stage.b", "togomak.pre")
+	_ = g.DependOn("togomak.post", "stage.b")
+	return g
+}
+
+func TestNewGraphExport_TransitiveReduction(t *testing.T) {
+	export := NewGraphExport(testExportGraph(), GraphExportConfig{})
+	for _, edge := range export.Edges {
+		if edge.From == "togomak.pre" && edge.To == "stage.b" {
+			t.Error("togomak.pre -> stage.b is implied by togomak.pre -> stage.a -> stage.b")
+		}
+	}
+	if len(export.Edges) != 4 {
+		t.Errorf("expected 4 edges, got %v", export.Edges)
+	}
+}
+
+func TestNewGraphExport_HideInternal(t *testing.T) {
+	export := NewGraphExport(testExportGraph(), GraphExportConfig{HideInternal: true})
+	if len(export.Nodes) != 2 {
+		t.Errorf("expected only stage.a and stage.b, got %v", export.Nodes)
+	}
+	if len(export.Edges) != 1 || export.Edges[0] != (GraphEdge{From: "stage.a", To: "stage.b"}) {
+		t.Errorf("expected stage.a -> stage.b, got %v", export.Edges)
+	}
+}
+
+func TestNewGraphExport_Collapse(t *testing.T) {
+	export := NewGraphExport(testExportGraph(), GraphExportConfig{
+		HideInternal: true,
+		Collapse:     true,
+		Selection:    map[string]bool{"stage.a": false, "stage.b": true},
+	})
+	if len(export.Nodes) != 1 || export.Nodes[0].Id != "stage" {
+		t.Fatalf("expected a single stage node, got %v", export.Nodes)
+	}
+	if export.Nodes[0].Selected == nil || !*export.Nodes[0].Selected {
+		t.Error("collapsed node should be selected if any of its members is selected")
+	}
+	if len(export.Edges) != 0 {
+		t.Errorf("edges within a collapsed node should be dropped, got %v", export.Edges)
+	}
+}
+
+func TestGraphExport_Render(t *testing.T) {
+	export := NewGraphExport(testExportGraph(), GraphExportConfig{
+		Selection: map[string]bool{"stage.a": true, "stage.b": false},
+	})
+	dot, err := export.Render(GraphFormatDot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(dot, "\"stage.a\" -> \"stage.b\";") {
+		t.Errorf("dot output is missing the stage.a -> stage.b edge:\n%s", dot)
+	}
+	mermaid, err := export.Render(GraphFormatMermaid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(mermaid, "class stage_a selected") || !strings.Contains(mermaid, "class stage_b skipped") {
+		t.Errorf("mermaid output does not highlight the selection:\n%s", mermaid)
+	}
+	if _, err := export.Render("svg"); err == nil {
+		t.Error("expected an error for an unsupported format")
+	}
+}
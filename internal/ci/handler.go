@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"github.com/hashicorp/hcl/v2"
+	"github.com/kendru/darwin/go/depgraph"
 	"github.com/sirupsen/logrus"
 	"github.com/srevinsaju/togomak/v1/internal/dg"
 	"github.com/srevinsaju/togomak/v1/internal/ui"
@@ -88,6 +89,10 @@ type Handler struct {
 	Logger  logrus.Ext1FieldLogger
 	Process *HandlerProcess
 
+	// Graph is the dependency graph of the pipeline, it is nil until
+	// the graph has been generated
+	Graph *depgraph.Graph
+
 	diagWriter hcl.DiagnosticWriter
 	ctxMu      sync.RWMutex
 	ctx        context.Context
@@ -138,6 +143,12 @@ func WithTracker(tracker *Tracker) HandlerOption {
 	}
 }
 
+func WithGraph(graph *depgraph.Graph) HandlerOption {
+	return func(h *Handler) {
+		h.Graph = graph
+	}
+}
+
 func WithProcessBootTime(bootTime time.Time) HandlerOption {
 	return func(h *Handler) {
 		h.Process.BootTime = bootTime
@@ -242,7 +253,8 @@ func (h *Handler) Daemons() {
 				h.Diags.Extend(d)
 				return
 			}
-			if lifecycle == nil {
+			if lifecycle == nil || len(lifecycle.StopWhenComplete) == 0 {
+				// the daemon runs until the pipeline is stopped
 				continue
 			}
 
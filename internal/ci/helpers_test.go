@@ -0,0 +1,47 @@
+package ci
+
+import (
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/srevinsaju/togomak/v1/internal/behavior"
+	"github.com/srevinsaju/togomak/v1/internal/meta"
+	"github.com/srevinsaju/togomak/v1/internal/path"
+	"testing"
+)
+
+// newTestConductor returns a conductor for the tests, which only logs in json and below the
+// lowest level. The paths default to empty paths, and the behavior to the default behavior
+func newTestConductor(cfg ConductorConfig, opts ...ConductorOption) *Conductor {
+	if cfg.Paths == nil {
+		cfg.Paths = &path.Path{}
+	}
+	if cfg.Behavior == nil {
+		cfg.Behavior = behavior.NewDefaultBehavior()
+	}
+	cfg.Interface.JSONLogging = true
+	cfg.Interface.Verbosity = LifecycleInvalid
+	return NewConductor(cfg, opts...)
+}
+
+// decodeConfig parses src as a togomak.hcl file, and decodes it into target, like a *Pipeline.
+// The test fails if src cannot be parsed or decoded
+func decodeConfig(t *testing.T, src string, target any) {
+	t.Helper()
+	f, diags := hclsyntax.ParseConfig([]byte(src), meta.ConfigFileName, hcl.InitialPos)
+	if diags.HasErrors() {
+		t.Fatal(diags.Error())
+	}
+	if diags := gohcl.DecodeBody(f.Body, nil, target); diags.HasErrors() {
+		t.Fatal(diags.Error())
+	}
+}
+
+// diagSummaries returns the summaries of diags, in order
+func diagSummaries(diags hcl.Diagnostics) []string {
+	var summaries []string
+	for _, diag := range diags {
+		summaries = append(summaries, diag.Summary)
+	}
+	return summaries
+}
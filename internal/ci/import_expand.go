@@ -3,40 +3,45 @@ package ci
 import (
 	"crypto/sha256"
 	"fmt"
-	"github.com/hashicorp/go-getter"
 	"github.com/hashicorp/hcl/v2"
 	"github.com/srevinsaju/togomak/v1/internal/ui"
 	"path/filepath"
 )
 
-func (m *Import) Expand(conductor *Conductor, pwd string, dst string) (*Pipeline, hcl.Diagnostics) {
-	logger := conductor.Logger().WithField("import", "")
-	var diags hcl.Diagnostics
-	shaIdentifier := sha256.Sum256([]byte(m.Identifier()))
-	clientImportPath, err := filepath.Abs(filepath.Join(dst, fmt.Sprintf("%x", shaIdentifier)))
+// ImportsDir is the directory to which all the imports are fetched
+func ImportsDir(conductor *Conductor) string {
+	dst, err := filepath.Abs(filepath.Join(conductor.TempDir(), "import"))
 	if err != nil {
 		panic(err)
 	}
+	return dst
+}
 
-	// fmt.Println(pwd, dst, m.Source, fmt.Sprintf("%x", shaIdentifier))
-	get := getter.Client{
-		Ctx: conductor.Context(),
-		Src: m.Identifier(),
-		Dir: true,
-		Pwd: pwd,
-		Dst: clientImportPath,
+// Dir returns the directory within dst to which the import is fetched, if it is on the
+// local filesystem. The remote imports are fetched to the cache, see Conductor.fetchSource
+func (m *Import) Dir(dst string) string {
+	shaIdentifier := sha256.Sum256([]byte(m.Identifier()))
+	dir, err := filepath.Abs(filepath.Join(dst, fmt.Sprintf("%x", shaIdentifier)))
+	if err != nil {
+		panic(err)
 	}
+	return dir
+}
+
+func (m *Import) Expand(conductor *Conductor, pwd string, dst string) (*Pipeline, hcl.Diagnostics) {
+	logger := conductor.Logger().WithField("import", "")
+	var diags hcl.Diagnostics
+	clientImportPath := m.Dir(dst)
+
 	ppb := ui.NewPassiveProgressBar(logger, fmt.Sprintf("pulling %s", m.Identifier()))
 	ppb.Init()
-	err = get.Get()
-	if err != nil {
-		diags = diags.Append(&hcl.Diagnostic{
-			Severity: hcl.DiagError,
-			Summary:  "import failed",
-			Detail:   fmt.Sprintf("import of %s failed: %s", m.Identifier(), err.Error()),
-		})
-	}
+	clientImportPath, d := conductor.fetchSource(m.Identifier(), pwd, clientImportPath, m.Source.Range().Ptr())
 	ppb.Done()
+	diags = diags.Extend(d)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	m.dir = clientImportPath
 
 	p, d := ReadDirFromPath(conductor, clientImportPath)
 	diags = diags.Extend(d)
@@ -5,6 +5,9 @@ import "github.com/hashicorp/hcl/v2"
 type Import struct {
 	id     string
 	Source hcl.Expression `hcl:"source" json:"source"`
+
+	// dir is the directory the import was read from, see Import.Expand
+	dir string
 }
 
 type Imports []*Import
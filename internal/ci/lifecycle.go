@@ -47,17 +47,20 @@ func (ty LifecycleType) String() string {
 	panic("invalid lifecycle type")
 }
 
+// Lifecycles are the phases recognized by LifecycleUnmarshall
+var Lifecycles = []LifecycleType{
+	LifecycleDefault,
+	LifecycleValidate,
+	LifecycleCompile,
+	LifecycleTest,
+	LifecyclePackage,
+	LifecycleVerify,
+	LifecycleInstall,
+	LifecycleDeploy,
+}
+
 func LifecycleUnmarshall(v string) (LifecycleType, bool) {
-	lifecycle := []LifecycleType{
-		LifecycleDefault,
-		LifecycleValidate,
-		LifecycleCompile,
-		LifecycleTest,
-		LifecyclePackage,
-		LifecycleVerify,
-		LifecycleDeploy,
-	}
-	for _, ly := range lifecycle {
+	for _, ly := range Lifecycles {
 		if ly.String() == v {
 			return ly, true
 		}
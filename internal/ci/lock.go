@@ -0,0 +1,56 @@
+package ci
+
+import (
+	"errors"
+	"fmt"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/srevinsaju/togomak/v1/internal/lockfile"
+	"github.com/srevinsaju/togomak/v1/internal/meta"
+	"github.com/srevinsaju/togomak/v1/internal/path"
+	"path/filepath"
+)
+
+// LockFile returns the path of the lock file of the pipeline, see lockfile.Lock
+func LockFile(paths *path.Path) string {
+	return filepath.Join(paths.Cwd, meta.LockFileName)
+}
+
+// verifySource verifies the remote source src of an import or a module against the lock
+// file of the run
+func (c *Conductor) verifySource(src RemoteSource, subject *hcl.Range) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	err := c.lock.Verify(src.Source, src.Resolved, src.Dir)
+	var mismatch *lockfile.MismatchError
+	if errors.As(err, &mismatch) {
+		return diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Source does not match the lock file",
+			Detail:   fmt.Sprintf("%s. Run togomak lock to update %s, or run the pipeline with --upgrade to use it without updating %s.", err, meta.LockFileName, meta.LockFileName),
+			Subject:  subject,
+		})
+	}
+	var notLocked *lockfile.NotLockedError
+	if errors.As(err, &notLocked) {
+		// without a lock file, the sources are not verified, but the run is not failed,
+		// so that the pipelines which do not lock their sources keep running
+		severity := hcl.DiagError
+		if !c.lock.Exists() {
+			severity = hcl.DiagWarning
+		}
+		return diags.Append(&hcl.Diagnostic{
+			Severity: severity,
+			Summary:  "Source is not in the lock file",
+			Detail:   fmt.Sprintf("%s is not in %s, and was not verified. Run togomak lock to add it.", src.Source, meta.LockFileName),
+			Subject:  subject,
+		})
+	}
+	if err != nil {
+		return diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Failed to verify source",
+			Detail:   fmt.Sprintf("%s could not be verified against %s: %s", src.Source, meta.LockFileName, err),
+			Subject:  subject,
+		})
+	}
+	return diags
+}
@@ -0,0 +1,43 @@
+package ci
+
+import (
+	"github.com/hashicorp/hcl/v2"
+	"github.com/srevinsaju/togomak/v1/internal/lockfile"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConductor_VerifySource(t *testing.T) {
+	dir := t.TempDir()
+	src := RemoteSource{Source: "https://example.com/src.zip", Resolved: "https://example.com/src.zip", Dir: filepath.Join(dir, "src")}
+	assert.NoError(t, os.MkdirAll(src.Dir, 0755))
+	path := filepath.Join(dir, "togomak.lock.hcl")
+
+	// without a lock file, the sources which are not locked are a warning
+	lock, diags := lockfile.Load(path, false)
+	assert.False(t, diags.HasErrors())
+	conductor := newTestConductor(ConductorConfig{}, ConductorWithLock(lock))
+	defer conductor.Destroy()
+	diags = conductor.verifySource(src, nil)
+	assert.Len(t, diags, 1)
+	assert.Equal(t, hcl.DiagWarning, diags[0].Severity)
+	assert.Equal(t, "Source is not in the lock file", diags[0].Summary)
+	assert.Contains(t, diags[0].Detail, src.Source)
+
+	// with a lock file, they are an error
+	assert.NoError(t, lockfile.New(path).Write())
+	lock, diags = lockfile.Load(path, false)
+	assert.False(t, diags.HasErrors())
+	conductor.Update(ConductorWithLock(lock))
+	diags = conductor.verifySource(src, nil)
+	assert.True(t, diags.HasErrors())
+	assert.Equal(t, []string{"Source is not in the lock file"}, diagSummaries(diags))
+
+	// unless they are upgraded
+	lock, diags = lockfile.Load(path, true)
+	assert.False(t, diags.HasErrors())
+	conductor.Update(ConductorWithLock(lock))
+	assert.Empty(t, conductor.verifySource(src, nil))
+}
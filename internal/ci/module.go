@@ -43,10 +43,12 @@ func (m *Module) IsDaemon() bool {
 }
 
 func (m *Module) Terminate(conductor *Conductor, safe bool) hcl.Diagnostics {
+	m.terminated = true
 	return nil
 }
 
 func (m *Module) Kill() hcl.Diagnostics {
+	m.terminated = true
 	return nil
 }
 
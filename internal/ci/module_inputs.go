@@ -0,0 +1,62 @@
+package ci
+
+import (
+	"fmt"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty/convert"
+	"os"
+)
+
+// checkInputs checks the inputs passed by the module block to the pipeline of the module against
+// its variable blocks, vars. Every input must be declared by a variable block, and must be
+// convertible to the type of the variable. The variables without a default must be set, either
+// by the module block, or with TOGOMAK_VAR_<name>
+func (m *Module) checkInputs(vars Variables, inputs Variables) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	for _, input := range inputs {
+		v, d := vars.ById(input.Id)
+		if d.HasErrors() {
+			diags = diags.Append(&hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Unsupported argument",
+				Detail:   fmt.Sprintf("An argument named %q is not expected here, the module does not declare a variable %q.", input.Id, input.Id),
+				Subject:  input.Value.Range().Ptr(),
+			})
+			continue
+		}
+
+		ty, _, d := v.typeConstraint()
+		if d.HasErrors() {
+			// reported by the variable block, when it runs
+			continue
+		}
+		value, d := input.Value.Value(nil)
+		if d.HasErrors() || !value.IsWhollyKnown() {
+			continue
+		}
+		if _, err := convert.Convert(value, ty); err != nil {
+			diags = diags.Append(&hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid value for module argument",
+				Detail:   fmt.Sprintf("The given value is not suitable for the variable %q of the module: %s.", input.Id, err),
+				Subject:  input.Value.Range().Ptr(),
+			})
+		}
+	}
+
+	for _, v := range vars {
+		if exprIsSet(v.Default) || os.Getenv(fmt.Sprintf("TOGOMAK_VAR_%s", v.Id)) != "" {
+			continue
+		}
+		if _, d := inputs.ById(v.Id); !d.HasErrors() {
+			continue
+		}
+		diags = diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Missing required argument",
+			Detail:   fmt.Sprintf("The argument %q is required by module %s, because the variable %q has no default value, but no definition was found.", v.Id, m.Id, v.Id),
+			Subject:  m.Source.Range().Ptr(),
+		})
+	}
+	return diags
+}
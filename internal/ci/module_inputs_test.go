@@ -0,0 +1,35 @@
+package ci
+
+import (
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/zclconf/go-cty/cty"
+	"testing"
+)
+
+func TestModule_CheckInputs(t *testing.T) {
+	src := `
+variable "env" {
+  type = string
+}
+variable "replicas" {
+  type    = number
+  default = 1
+}
+`
+	pipe := &struct {
+		Vars Variables `hcl:"variable,block"`
+	}{}
+	decodeConfig(t, src, pipe)
+
+	input := func(id string, v cty.Value) *Variable {
+		return &Variable{Id: id, Value: hcl.StaticExpr(v, hcl.Range{})}
+	}
+	m := &Module{Id: "api", Source: hcl.StaticExpr(cty.StringVal("./api"), hcl.Range{})}
+
+	diags := m.checkInputs(pipe.Vars, Variables{input("env", cty.StringVal("prod")), input("replicas", cty.StringVal("3"))})
+	assert.False(t, diags.HasErrors())
+
+	diags = m.checkInputs(pipe.Vars, Variables{input("replicas", cty.StringVal("many")), input("region", cty.StringVal("eu"))})
+	assert.Equal(t, []string{"Invalid value for module argument", "Unsupported argument", "Missing required argument"}, diagSummaries(diags))
+}
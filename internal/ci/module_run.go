@@ -2,7 +2,6 @@ package ci
 
 import (
 	"fmt"
-	"github.com/hashicorp/go-getter"
 	"github.com/hashicorp/hcl/v2"
 	"github.com/srevinsaju/togomak/v1/internal/behavior"
 	"github.com/srevinsaju/togomak/v1/internal/blocks"
@@ -13,6 +12,7 @@ import (
 	"github.com/srevinsaju/togomak/v1/internal/ui"
 	"github.com/srevinsaju/togomak/v1/internal/x"
 	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
 	"path/filepath"
 	"sync"
 )
@@ -26,6 +26,9 @@ func (m *Module) Prepare(conductor *Conductor, skip bool, overridden bool) hcl.D
 		id = ""
 	} else {
 		id = fmt.Sprintf("%s", ui.Grey("skipped"))
+		if conductor.Unchanged(x.RenderBlock(m.Type(), m.Id)) {
+			id = fmt.Sprintf("%s", ui.Grey("skipped, unchanged"))
+		}
 	}
 	if overridden {
 		id = fmt.Sprintf("%s", ui.Blue("overridden"))
@@ -49,6 +52,7 @@ func (m *Module) Run(conductor *Conductor, options ...runnable.Option) (diags hc
 	conductor.Eval().Mutex().RLock()
 	source, d := m.Source.Value(evalCtx)
 	conductor.Eval().Mutex().RUnlock()
+	source = conductor.unmark(source)
 	if d.HasErrors() {
 		return diags.Extend(d)
 	}
@@ -72,6 +76,7 @@ func (m *Module) Run(conductor *Conductor, options ...runnable.Option) (diags hc
 	conductor.Eval().Mutex().RLock()
 	forEachItems, d := m.ForEach.Value(evalCtx)
 	conductor.Eval().Mutex().RUnlock()
+	forEachItems = conductor.unmark(forEachItems)
 
 	diags = diags.Extend(d)
 	if d.HasErrors() {
@@ -122,6 +127,9 @@ func (m *Module) Run(conductor *Conductor, options ...runnable.Option) (diags hc
 			Retry:     m.Retry,
 			Daemon:    m.Daemon,
 			Body:      m.Body,
+
+			forEachOf:  m.Id,
+			forEachKey: keyCty,
 		}
 		go func(keyCty cty.Value, options ...runnable.Option) {
 			options = append(options, runnable.WithEach(keyCty, v))
@@ -145,22 +153,10 @@ func (m *Module) run(conductor *Conductor, source string, evalCtx *hcl.EvalConte
 	cfg := runnable.NewConfig(options...)
 
 	paths := cfg.Paths
-	get := &getter.Client{
-		Ctx: conductor.Context(),
-		Src: source,
-		Dst: filepath.Join(conductor.TempDir(), "modules", m.Id),
-		Pwd: paths.Module,
-		Dir: true,
-	}
-	err := get.Get()
-	if err != nil {
-		return diags.Append(&hcl.Diagnostic{
-			Severity:    hcl.DiagError,
-			Summary:     "failed to download source",
-			Detail:      err.Error(),
-			Subject:     m.Source.Range().Ptr(),
-			EvalContext: evalCtx,
-		})
+	dir, d := conductor.fetchSource(source, paths.Module, filepath.Join(conductor.TempDir(), "modules", m.Id), m.Source.Range().Ptr())
+	diags = diags.Extend(d)
+	if diags.HasErrors() {
+		return diags
 	}
 
 	var parentLifecycles []string
@@ -171,6 +167,7 @@ func (m *Module) run(conductor *Conductor, source string, evalCtx *hcl.EvalConte
 		conductor.Eval().Mutex().RLock()
 		lifecyclePhases, d := m.Lifecycle.Phase.Value(evalCtx)
 		conductor.Eval().Mutex().RUnlock()
+		lifecyclePhases = conductor.unmark(lifecyclePhases)
 		diags = diags.Extend(d)
 		for _, phase := range lifecyclePhases.AsValueSlice() {
 			parentLifecycles = append(parentLifecycles, phase.AsString())
@@ -188,17 +185,21 @@ func (m *Module) run(conductor *Conductor, source string, evalCtx *hcl.EvalConte
 		},
 		DryRun: false,
 	}
+	// the module is skipped by its own paths, the changes are not computed again
+	// for the stages in the module
+	childPipeline := conductor.Config.Pipeline
+	childPipeline.ChangedSince = ""
 	childCfg := ConductorConfig{
 		User:     conductor.Config.User,
 		Hostname: conductor.Config.Hostname,
 		Paths: &path.Path{
-			Pipeline: filepath.Join(get.Dst, meta.ConfigFileName),
+			Pipeline: filepath.Join(dir, meta.ConfigFileName),
 			Owd:      conductor.Config.Paths.Owd,
 			Cwd:      conductor.Config.Paths.Cwd,
-			Module:   get.Dst,
+			Module:   dir,
 		},
 		Interface: conductor.Config.Interface,
-		Pipeline:  conductor.Config.Pipeline,
+		Pipeline:  childPipeline,
 		Behavior:  b,
 	}
 	childConductor := conductor.Child(ConductorWithConfig(childCfg))
@@ -208,30 +209,45 @@ func (m *Module) run(conductor *Conductor, source string, evalCtx *hcl.EvalConte
 	// this will make hcl.Diagnostics more descriptive
 	conductorOptions = append(conductorOptions, ConductorWithParser(conductor.Parser))
 
+	// the variables of the module are only set by the module block, see Module.checkInputs
+	conductorOptions = append(conductorOptions, ConductorWithModule(m), ConductorWithVariablesList(nil))
+
+	// the inputs may refer to each.key and each.value of the instance
+	if cfg.Each != nil {
+		evalCtx = evalCtx.NewChild()
+		evalCtx.Variables = map[string]cty.Value{EachBlock: cty.ObjectVal(cfg.Each)}
+	}
+
 	// populate input variables for the child conductor, which would be passed to the module
 	attrs, _ := m.Body.JustAttributes()
 	for _, attr := range attrs {
 		//we need to evaluate the values first within the parent's evaluation context
 		//before sending it to the child goroutine and child conductor
-		//because the child evaluation context is independent of the parent's, and it is
-		//possible that the particular value may not exist in child.
-		var expr hcl.Expression
+		//because the child evaluation context is independent of the parent's
+		conductor.Eval().Mutex().RLock()
 		v, d := attr.Expr.Value(evalCtx)
-		if d.HasErrors() {
-			expr = attr.Expr
-		} else {
-			expr = hcl.StaticExpr(v, attr.Expr.Range())
-		}
+		conductor.Eval().Mutex().RUnlock()
+		diags = diags.Extend(d)
 		variable := &Variable{
 			Id:    attr.Name,
-			Value: expr,
+			Value: hcl.StaticExpr(v, attr.Expr.Range()),
 		}
 		conductorOptions = append(conductorOptions, ConductorWithVariable(variable))
 	}
+	if diags.HasErrors() {
+		return diags
+	}
 
 	// update the child conductor's logger with the parent's logger
 	conductorOptions = append(conductorOptions, ConductorWithLogger(logger))
 
+	// runnables of the child pipeline are recorded on their own tracks, under the module
+	conductorOptions = append(conductorOptions, ConductorWithProfiler(conductor.Profiler().Scope(x.RenderBlock(blocks.ModuleBlock, m.Id))))
+
+	// and so are the logs of its stages
+	conductorOptions = append(conductorOptions, ConductorWithRunLog(conductor.RunLog().Scope(x.RenderBlock(blocks.ModuleBlock, m.Id))))
+	conductorOptions = append(conductorOptions, ConductorWithMetrics(conductor.Metrics().Scope(x.RenderBlock(blocks.ModuleBlock, m.Id))))
+
 	childConductor.Update(conductorOptions...)
 
 	// parse the config file
@@ -252,9 +268,42 @@ func (m *Module) run(conductor *Conductor, source string, evalCtx *hcl.EvalConte
 	_, sd := pipe.Run(childConductor)
 
 	diags = diags.Extend(sd.Diagnostics())
+	if !diags.HasErrors() {
+		m.exportOutputs(conductor, childConductor.OutputValues())
+	}
 	return diags
 }
 
+// exportOutputs makes the outputs of the child pipeline available to the parent pipeline
+// as module.<id>.outputs, or module.<id>[<key>].outputs for the instances created by for_each.
+// Each output can also be read as module.<id>.<name>, unless it is named outputs
+func (m *Module) exportOutputs(conductor *Conductor, values OutputValues) {
+	conductor.Eval().Mutex().Lock()
+	defer conductor.Eval().Mutex().Unlock()
+	variables := conductor.Eval().Context().Variables
+
+	modules := map[string]cty.Value{}
+	if v, ok := variables[blocks.ModuleBlock]; ok {
+		for id, outputs := range v.AsValueMap() {
+			modules[id] = outputs
+		}
+	}
+	if m.forEachOf == "" {
+		modules[m.Id] = values.moduleObject()
+	} else {
+		instances := map[string]cty.Value{}
+		if v, ok := modules[m.forEachOf]; ok {
+			for key, outputs := range v.AsValueMap() {
+				instances[key] = outputs
+			}
+		}
+		key, _ := convert.Convert(m.forEachKey, cty.String)
+		instances[key.AsString()] = values.moduleObject()
+		modules[m.forEachOf] = cty.ObjectVal(instances)
+	}
+	variables[blocks.ModuleBlock] = cty.ObjectVal(modules)
+}
+
 func (m *Module) CanRun(conductor *Conductor, options ...runnable.Option) (ok bool, diags hcl.Diagnostics) {
 	logger := conductor.Logger().WithField("module", m.Id)
 	logger.Debugf("checking if %s can run", x.RenderBlock(blocks.ModuleBlock, m.Id))
@@ -274,6 +323,7 @@ func (m *Module) CanRun(conductor *Conductor, options ...runnable.Option) (ok bo
 	conductor.Eval().Mutex().RLock()
 	v, d := m.Condition.Value(evalCtx)
 	conductor.Eval().Mutex().RUnlock()
+	v = conductor.unmark(v)
 	if d.HasErrors() {
 		return false, diags.Extend(d)
 	}
@@ -288,5 +338,5 @@ func (m *Module) CanRun(conductor *Conductor, options ...runnable.Option) (ok bo
 }
 
 func (m *Module) Terminated() bool {
-	return true
+	return m.terminated
 }
@@ -2,6 +2,7 @@ package ci
 
 import (
 	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
 )
 
 type Module struct {
@@ -14,8 +15,20 @@ type Module struct {
 
 	Source hcl.Expression `hcl:"source" json:"source"`
 
+	// Paths accepts a list of glob patterns of the files the module builds, see Stage.Paths
+	Paths hcl.Expression `hcl:"paths,optional" json:"paths"`
+
 	pipeline *Pipeline
 
+	// terminated is set when the module is terminated or killed, see Module.Terminate
+	terminated bool
+
+	// forEachOf is the id of the module block of an instance created by for_each,
+	// and forEachKey is its key. The outputs of the instances are exported under
+	// module.<id>[<key>]
+	forEachOf  string
+	forEachKey cty.Value
+
 	Lifecycle *Lifecycle   `hcl:"lifecycle,block" json:"lifecycle"`
 	Retry     *StageRetry  `hcl:"retry,block" json:"retry"`
 	Daemon    *StageDaemon `hcl:"daemon,block" json:"daemon"`
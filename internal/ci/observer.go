@@ -0,0 +1,73 @@
+package ci
+
+import (
+	"github.com/srevinsaju/togomak/v1/internal/blocks"
+	"github.com/srevinsaju/togomak/v1/internal/runnable"
+	"time"
+)
+
+// RunnableEvent is a change in the state of a stage or a module
+type RunnableEvent struct {
+	// Id is the address of the runnable, like stage.build
+	Id string
+
+	// Block is the runnable, it can be used to terminate it
+	Block Block
+
+	Status runnable.StatusType
+	Daemon bool
+
+	// Retry is the number of the retry, it is zero for the first attempt
+	Retry int
+
+	Time time.Time
+}
+
+// Observer is notified of the changes in the state of the stages and modules of the pipeline,
+// see ConductorWithObserver. Observe is called concurrently by the runnables
+type Observer interface {
+	Observe(event RunnableEvent)
+}
+
+// observe notifies the observer of the conductor, if any, of a change in the state of
+// a stage or a module, and records it in the metrics. The other blocks are not observed
+func (c *Conductor) observe(id string, block Block, status runnable.StatusType, retry int) {
+	if block.Type() != blocks.StageBlock && block.Type() != blocks.ModuleBlock {
+		return
+	}
+	now := time.Now()
+	c.metrics.Observe(id, status, retry, now)
+	if c.observer == nil {
+		return
+	}
+	c.observer.Observe(RunnableEvent{
+		Id:     id,
+		Block:  block,
+		Status: status,
+		Daemon: block.IsDaemon(),
+		Retry:  retry,
+		Time:   now,
+	})
+}
+
+// observeRetry notifies the observer that the runnable is being retried
+func (c *Conductor) observeRetry(id string, block Block, retry int) {
+	c.observe(id, block, runnable.StatusRunning, retry)
+}
+
+// resultStatus returns the status of a runnable which finished. A runnable which failed is
+// failed even if it was terminated, like a daemon which crashed before it was stopped
+func resultStatus(block Block, failed bool) runnable.StatusType {
+	switch {
+	case failed:
+		return runnable.StatusFailure
+	case block.Terminated():
+		return runnable.StatusTerminated
+	}
+	return runnable.StatusSuccess
+}
+
+// observeResult notifies the observer that the runnable finished
+func (c *Conductor) observeResult(id string, block Block, failed bool, retry int) {
+	c.observe(id, block, resultStatus(block, failed), retry)
+}
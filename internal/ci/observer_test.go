@@ -0,0 +1,21 @@
+package ci
+
+import (
+	"github.com/srevinsaju/togomak/v1/internal/runnable"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestResultStatus(t *testing.T) {
+	m := &Module{Id: "api"}
+	assert.Equal(t, runnable.StatusSuccess, resultStatus(m, false))
+	assert.Equal(t, runnable.StatusFailure, resultStatus(m, true))
+	assert.False(t, m.Kill().HasErrors())
+	assert.Equal(t, runnable.StatusTerminated, resultStatus(m, false))
+	assert.Equal(t, runnable.StatusFailure, resultStatus(m, true))
+
+	s := &Stage{Id: "build"}
+	assert.Equal(t, runnable.StatusSuccess, resultStatus(s, false))
+	s.terminated = true
+	assert.Equal(t, runnable.StatusTerminated, resultStatus(s, false))
+}
@@ -1,3 +1,229 @@
 package ci
 
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/srevinsaju/togomak/v1/internal/runlog"
+	"github.com/srevinsaju/togomak/v1/internal/third-party/hashicorp/terraform/lang/marks"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+	"sort"
+	"strings"
+)
+
+// OutputBlock is the name of the values exported by the stages through the TOGOMAK_ENV file,
+// like output.VERSION, and of the output blocks of the pipeline
 const OutputBlock = "output"
+
+// moduleOutputsAttr is the attribute of module.<id> with the outputs of the module
+const moduleOutputsAttr = "outputs"
+
+// Output is a value computed by the pipeline, declared with an output block. The outputs are
+// evaluated once all the stages and modules ran, and are read by the parent pipeline of a
+// module as module.<id>.<name>
+type Output struct {
+	Id string `hcl:"id,label" json:"id"`
+
+	Value     hcl.Expression `hcl:"value" json:"value"`
+	Desc      string         `hcl:"description,optional" json:"description"`
+	Sensitive bool           `hcl:"sensitive,optional" json:"sensitive"`
+}
+
+type Outputs []*Output
+
+// OutputValue is the value of an output block, once the pipeline ran
+type OutputValue struct {
+	Name        string
+	Description string
+	Sensitive   bool
+
+	// Value is marked as sensitive if the output is sensitive
+	Value cty.Value
+}
+
+type OutputValues []OutputValue
+
+// Object returns the outputs as an object, by their name
+func (o OutputValues) Object() cty.Value {
+	attrs := make(map[string]cty.Value, len(o))
+	for _, output := range o {
+		attrs[output.Name] = output.Value
+	}
+	return cty.ObjectVal(attrs)
+}
+
+// moduleObject returns the outputs as they are read by the parent pipeline of a module, as
+// module.<id>.outputs.<name>, or module.<id>.<name>
+func (o OutputValues) moduleObject() cty.Value {
+	attrs := make(map[string]cty.Value, len(o)+1)
+	for _, output := range o {
+		attrs[output.Name] = output.Value
+	}
+	attrs[moduleOutputsAttr] = o.Object()
+	return cty.ObjectVal(attrs)
+}
+
+// String renders the outputs, one per line, aligned by name. The sensitive values are redacted
+func (o OutputValues) String() string {
+	width := 0
+	for _, output := range o {
+		if len(output.Name) > width {
+			width = len(output.Name)
+		}
+	}
+	var b strings.Builder
+	for _, output := range o {
+		fmt.Fprintf(&b, "%-*s = %s\n", width, output.Name, renderValue(output.Value, ""))
+	}
+	return b.String()
+}
+
+// Raw renders the value of the output as is if it is a string, so that it can be read
+// by a shell script, or in the HCL syntax otherwise. Sensitive values are shown
+func (o OutputValue) Raw() string {
+	v, _ := o.Value.UnmarkDeep()
+	if v.Type() == cty.String && v.IsKnown() && !v.IsNull() {
+		return v.AsString()
+	}
+	return renderValue(v, "")
+}
+
+// Record returns the outputs as they are recorded with the run, see runlog.Run
+func (o OutputValues) Record() (map[string]runlog.Output, error) {
+	outputs := make(map[string]runlog.Output, len(o))
+	for _, output := range o {
+		v, _ := output.Value.UnmarkDeep()
+		value, err := ctyjson.Marshal(v, v.Type())
+		if err != nil {
+			return nil, fmt.Errorf("output %s: %w", output.Name, err)
+		}
+		ty, err := ctyjson.MarshalType(v.Type())
+		if err != nil {
+			return nil, fmt.Errorf("output %s: %w", output.Name, err)
+		}
+		outputs[output.Name] = runlog.Output{
+			Value:       value,
+			Type:        ty,
+			Sensitive:   output.Sensitive,
+			Description: output.Description,
+		}
+	}
+	return outputs, nil
+}
+
+// RedactOutputs returns the outputs recorded with a run, with the values of the sensitive
+// outputs replaced with (sensitive value), so that they can be shown in a report
+func RedactOutputs(outputs map[string]runlog.Output) map[string]runlog.Output {
+	redactedValue, _ := json.Marshal(sensitiveValue)
+	redacted := make(map[string]runlog.Output, len(outputs))
+	for name, output := range outputs {
+		if output.Sensitive {
+			output.Value = redactedValue
+		}
+		redacted[name] = output
+	}
+	return redacted
+}
+
+// OutputValuesFromRun returns the outputs recorded with run, sorted by name
+func OutputValuesFromRun(run runlog.Run) (OutputValues, error) {
+	var values OutputValues
+	for name, output := range run.Outputs {
+		ty, err := ctyjson.UnmarshalType(output.Type)
+		if err != nil {
+			return nil, fmt.Errorf("output %s: %w", name, err)
+		}
+		v, err := ctyjson.Unmarshal(output.Value, ty)
+		if err != nil {
+			return nil, fmt.Errorf("output %s: %w", name, err)
+		}
+		if output.Sensitive {
+			v = v.Mark(marks.Sensitive)
+		}
+		values = append(values, OutputValue{
+			Name:        name,
+			Description: output.Description,
+			Sensitive:   output.Sensitive,
+			Value:       v,
+		})
+	}
+	sort.Slice(values, func(i, j int) bool {
+		return values[i].Name < values[j].Name
+	})
+	return values, nil
+}
+
+// CheckIfDistinct checks if the outputs in s and ss are distinct
+func (s Outputs) CheckIfDistinct(ss Outputs) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	for _, output := range s {
+		for _, output2 := range ss {
+			if output.Id == output2.Id {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Duplicate output",
+					Detail:   "Output with id " + output.Id + " is defined more than once",
+				})
+			}
+		}
+	}
+	return diags
+}
+
+// Variables returns the references of the values of the outputs
+func (s Outputs) Variables() []hcl.Traversal {
+	var traversal []hcl.Traversal
+	for _, output := range s {
+		traversal = append(traversal, output.Value.Variables()...)
+	}
+	return traversal
+}
+
+// Eval evaluates the values of the outputs, sorted by name. The value of an output which is not
+// sensitive cannot be derived from a sensitive value, like a variable with sensitive = true
+func (s Outputs) Eval(conductor *Conductor) (OutputValues, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	var values OutputValues
+	for _, output := range s {
+		conductor.Eval().Mutex().RLock()
+		v, d := output.Value.Value(conductor.Eval().Context())
+		conductor.Eval().Mutex().RUnlock()
+		diags = diags.Extend(d)
+		if d.HasErrors() {
+			continue
+		}
+		if !v.IsWhollyKnown() {
+			diags = diags.Append(&hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Unknown output value",
+				Detail:   fmt.Sprintf("The value of output %s depends on a value which is not known, because the block it refers to did not run.", output.Id),
+				Subject:  output.Value.Range().Ptr(),
+			})
+			continue
+		}
+
+		if output.Sensitive {
+			v = v.Mark(marks.Sensitive)
+			conductor.Redactions().AddValue(v)
+		} else if v.ContainsMarked() {
+			diags = diags.Append(&hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Output refers to sensitive values",
+				Detail:   fmt.Sprintf("The value of output %s is derived from a sensitive value. Set sensitive = true in the output block, to confirm that it is intended.", output.Id),
+				Subject:  output.Value.Range().Ptr(),
+			})
+			continue
+		}
+		values = append(values, OutputValue{
+			Name:        output.Id,
+			Description: output.Desc,
+			Sensitive:   output.Sensitive,
+			Value:       v,
+		})
+	}
+	sort.Slice(values, func(i, j int) bool {
+		return values[i].Name < values[j].Name
+	})
+	return values, diags
+}
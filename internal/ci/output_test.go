@@ -0,0 +1,64 @@
+package ci
+
+import (
+	"encoding/json"
+	"github.com/srevinsaju/togomak/v1/internal/blocks"
+	"github.com/srevinsaju/togomak/v1/internal/runlog"
+	"github.com/srevinsaju/togomak/v1/internal/third-party/hashicorp/terraform/lang/marks"
+	"github.com/stretchr/testify/assert"
+	"github.com/zclconf/go-cty/cty"
+	"testing"
+)
+
+func TestOutputs_Eval(t *testing.T) {
+	src := `
+output "version" {
+  value       = "1.${var.minor}"
+  description = "the computed version"
+}
+output "artifacts" {
+  value = ["dist/a.tar.gz"]
+}
+output "token" {
+  value     = var.token
+  sensitive = true
+}
+output "header" {
+  value = "Bearer ${var.token}"
+}
+`
+	pipe := &struct {
+		Outputs Outputs `hcl:"output,block"`
+	}{}
+	decodeConfig(t, src, pipe)
+
+	conductor := newTestConductor(ConductorConfig{})
+	conductor.Eval().Context().Variables[blocks.VarBlock] = cty.ObjectVal(map[string]cty.Value{
+		"minor": cty.StringVal("2"),
+		"token": cty.StringVal("s3cr3t").Mark(marks.Sensitive),
+	})
+
+	values, diags := pipe.Outputs.Eval(conductor)
+	assert.Len(t, diags, 1)
+	assert.Equal(t, "Output refers to sensitive values", diags[0].Summary)
+	assert.Len(t, values, 3)
+	assert.Equal(t, "artifacts = [\n  \"dist/a.tar.gz\",\n]\ntoken     = (sensitive value)\nversion   = \"1.2\"\n", values.String())
+	assert.Equal(t, "s3cr3t", values[1].Raw())
+
+	outputs, err := values.Record()
+	assert.NoError(t, err)
+	recorded, err := OutputValuesFromRun(runlog.Run{Outputs: outputs})
+	assert.NoError(t, err)
+	assert.Equal(t, values, recorded)
+	assert.Equal(t, "the computed version", recorded[2].Description)
+	assert.True(t, recorded[1].Value.HasMark(marks.Sensitive))
+
+	// the sensitive values are hidden from the reports of the outputs
+	redacted := RedactOutputs(outputs)
+	assert.JSONEq(t, `"(sensitive value)"`, string(redacted["token"].Value))
+	assert.Equal(t, outputs["version"], redacted["version"])
+	assert.JSONEq(t, `"s3cr3t"`, string(outputs["token"].Value))
+	data, err := json.Marshal(redacted)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "s3cr3t")
+}
@@ -17,6 +17,7 @@ type Pipeline struct {
 	Macros  Macros      `hcl:"macro,block" json:"macro"`
 	Locals  LocalsGroup `hcl:"locals,block" json:"locals"`
 	Imports Imports     `hcl:"import,block" json:"import"`
+	Outputs Outputs     `hcl:"output,block" json:"outputs"`
 
 	Modules Modules `hcl:"module,block" json:"modules"`
 
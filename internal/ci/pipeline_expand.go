@@ -2,19 +2,13 @@ package ci
 
 import (
 	"github.com/hashicorp/hcl/v2"
-	"path/filepath"
 )
 
 func (pipe *Pipeline) ExpandImports(conductor *Conductor, pwd string) (*Pipeline, hcl.Diagnostics) {
 	var pipes MetaList
 	var diags hcl.Diagnostics
 	pipes = pipes.Append(NewMeta(pipe, nil, "memory"))
-	tmpDir := conductor.TempDir()
-
-	dst, err := filepath.Abs(filepath.Join(tmpDir, "import"))
-	if err != nil {
-		panic(err)
-	}
+	dst := ImportsDir(conductor)
 	m := pipe.Imports
 	for _, im := range m {
 		p, d := im.Expand(conductor, pwd, dst)
@@ -0,0 +1,251 @@
+package ci
+
+import (
+	"fmt"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/srevinsaju/togomak/v1/internal/blocks"
+	"github.com/srevinsaju/togomak/v1/internal/meta"
+	"github.com/srevinsaju/togomak/v1/internal/x"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ListItem describes a single block of the pipeline, as shown by togomak list
+type ListItem struct {
+	Address     string   `json:"address"`
+	Type        string   `json:"type"`
+	Description string   `json:"description,omitempty"`
+	Phases      []string `json:"phases,omitempty"`
+	Daemon      bool     `json:"daemon,omitempty"`
+
+	// VariableType and Default are the source of the type and the default
+	// value of a variable block, the default of a sensitive variable is redacted
+	VariableType string `json:"variable_type,omitempty"`
+	Default      string `json:"default,omitempty"`
+	Sensitive    bool   `json:"sensitive,omitempty"`
+
+	// Source is the source of import, module and macro blocks
+	Source string `json:"source,omitempty"`
+
+	// Import is the source of the import which defined the block, and is empty
+	// if the block was defined in the pipeline itself
+	Import string `json:"import,omitempty"`
+
+	Filename string `json:"filename,omitempty"`
+	Line     int    `json:"line,omitempty"`
+}
+
+type ListItems []ListItem
+
+// blockDefRanges maps the address of every block in the parsed files to the
+// location of its definition
+func blockDefRanges(files map[string]*hcl.File) map[string]hcl.Range {
+	ranges := make(map[string]hcl.Range)
+	for _, f := range files {
+		body, ok := f.Body.(*hclsyntax.Body)
+		if !ok {
+			continue
+		}
+		for _, block := range body.Blocks {
+			var address string
+			switch {
+			case block.Type == blocks.VariableBlock && len(block.Labels) == 1:
+				address = x.RenderBlock(blocks.VarBlock, block.Labels[0])
+			case block.Type == DataBlock && len(block.Labels) == 2:
+				address = x.RenderBlock(DataBlock, block.Labels[0], block.Labels[1])
+			case block.Type == "pre":
+				address = meta.PreStage
+			case block.Type == "post":
+				address = meta.PostStage
+			case len(block.Labels) == 1:
+				address = x.RenderBlock(block.Type, block.Labels[0])
+			default:
+				continue
+			}
+			ranges[address] = block.DefRange()
+		}
+	}
+	return ranges
+}
+
+// exprSource returns the configuration source of expr
+func exprSource(files map[string]*hcl.File, expr hcl.Expression) string {
+	if !exprIsSet(expr) {
+		return ""
+	}
+	rng := expr.Range()
+	f, ok := files[rng.Filename]
+	if !ok {
+		return ""
+	}
+	return string(rng.SliceBytes(f.Bytes))
+}
+
+// lifecyclePhases returns the phases of a lifecycle block. Phases which depend on other
+// blocks cannot be evaluated statically, and the source of the expression is returned instead
+func lifecyclePhases(conductor *Conductor, files map[string]*hcl.File, lifecycle *Lifecycle) []string {
+	if lifecycle == nil || !exprIsSet(lifecycle.Phase) {
+		return nil
+	}
+	if len(lifecycle.Phase.Variables()) != 0 {
+		return []string{exprSource(files, lifecycle.Phase)}
+	}
+
+	conductor.Eval().Mutex().RLock()
+	v, d := lifecycle.Phase.Value(conductor.Eval().Context())
+	conductor.Eval().Mutex().RUnlock()
+	if d.HasErrors() {
+		return []string{exprSource(files, lifecycle.Phase)}
+	}
+	v, err := convert.Convert(v, cty.List(cty.String))
+	if err != nil || v.IsNull() || !v.IsWhollyKnown() {
+		return []string{exprSource(files, lifecycle.Phase)}
+	}
+	var phases []string
+	for _, phase := range v.AsValueSlice() {
+		phases = append(phases, phase.AsString())
+	}
+	return phases
+}
+
+// List describes every block in the pipeline. The imports are expected to be populated,
+// and the locals to be expanded.
+func (pipe *Pipeline) List(conductor *Conductor) ListItems {
+	files := conductor.Parser.Files()
+	ranges := blockDefRanges(files)
+
+	// the blocks of an import are read from the directory it was fetched to
+	importDirs := make(map[string]string)
+	for _, im := range pipe.Imports {
+		if im.dir != "" {
+			importDirs[im.dir] = im.Identifier()
+		}
+	}
+
+	var items ListItems
+	add := func(item ListItem, rng *hcl.Range) {
+		if rng == nil {
+			if r, ok := ranges[item.Address]; ok {
+				rng = &r
+			}
+		}
+		if rng != nil {
+			item.Filename = rng.Filename
+			item.Line = rng.Start.Line
+			for dir, identifier := range importDirs {
+				rel, err := filepath.Rel(dir, rng.Filename)
+				if err == nil && !strings.HasPrefix(rel, "..") {
+					// the fetched directory is temporary, or in the cache, so the filename
+					// is shown relative to the source of the import instead
+					item.Import = identifier
+					item.Filename = rel
+					break
+				}
+			}
+		}
+		items = append(items, item)
+	}
+
+	for _, im := range pipe.Imports {
+		add(ListItem{
+			Address: fmt.Sprintf("%s %q", ImportBlock, im.Identifier()),
+			Type:    ImportBlock,
+			Source:  im.Identifier(),
+		}, im.Source.Range().Ptr())
+	}
+	for _, v := range pipe.Vars {
+		def := exprSource(files, v.Default)
+		if v.Sensitive && def != "" {
+			def = sensitiveValue
+		}
+		add(ListItem{
+			Address:      x.RenderBlock(blocks.VarBlock, v.Id),
+			Type:         blocks.VariableBlock,
+			Description:  v.Desc,
+			VariableType: exprSource(files, v.Ty),
+			Default:      def,
+			Sensitive:    v.Sensitive,
+		}, nil)
+	}
+	for _, local := range pipe.Local {
+		add(ListItem{
+			Address: x.RenderBlock(LocalBlock, local.Key),
+			Type:    LocalBlock,
+		}, local.Value.Range().Ptr())
+	}
+	for _, data := range pipe.Data {
+		add(ListItem{
+			Address:     x.RenderBlock(DataBlock, data.Provider, data.Id),
+			Type:        DataBlock,
+			Description: data.Name,
+		}, nil)
+	}
+	for _, macro := range pipe.Macros {
+		add(ListItem{
+			Address: x.RenderBlock(blocks.MacroBlock, macro.Id),
+			Type:    blocks.MacroBlock,
+			Source:  macro.Source,
+		}, nil)
+	}
+	if pipe.Pre != nil {
+		add(ListItem{
+			Address:     meta.PreStage,
+			Type:        blocks.StageBlock,
+			Description: pipe.Pre.Name,
+		}, nil)
+	}
+	for _, stage := range pipe.Stages {
+		add(ListItem{
+			Address:     x.RenderBlock(blocks.StageBlock, stage.Id),
+			Type:        blocks.StageBlock,
+			Description: stage.Name,
+			Phases:      lifecyclePhases(conductor, files, stage.Lifecycle),
+			Daemon:      stage.IsDaemon(),
+		}, nil)
+	}
+	if pipe.Post != nil {
+		add(ListItem{
+			Address:     meta.PostStage,
+			Type:        blocks.StageBlock,
+			Description: pipe.Post.Name,
+		}, nil)
+	}
+	for _, module := range pipe.Modules {
+		add(ListItem{
+			Address:     x.RenderBlock(blocks.ModuleBlock, module.Id),
+			Type:        blocks.ModuleBlock,
+			Description: module.Name,
+			Phases:      lifecyclePhases(conductor, files, module.Lifecycle),
+			Daemon:      module.Daemon != nil && module.Daemon.Enabled,
+			Source:      exprSource(files, module.Source),
+		}, nil)
+	}
+
+	// the blocks of the pipeline are listed before the blocks of the imports,
+	// which are grouped by the import
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Import < items[j].Import
+	})
+	return items
+}
+
+// HasPhase reports if the block runs in the given lifecycle phase. Stages and modules
+// without phases run in the default phase
+func (item ListItem) HasPhase(phase string) bool {
+	if item.Type != blocks.StageBlock && item.Type != blocks.ModuleBlock {
+		return false
+	}
+	if len(item.Phases) == 0 {
+		return phase == LifecycleDefault.String()
+	}
+	for _, p := range item.Phases {
+		if p == phase {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package ci
+
+import (
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestBlockDefRanges(t *testing.T) {
+	src := `
+variable "name" {}
+data "env" "home" {
+  key = "HOME"
+}
+stage "build" {
+  script = "make"
+}
+pre {
+  script = "true"
+}
+`
+	f, diags := hclsyntax.ParseConfig([]byte(src), "togomak.hcl", hcl.InitialPos)
+	assert.False(t, diags.HasErrors())
+
+	ranges := blockDefRanges(map[string]*hcl.File{"togomak.hcl": f})
+	assert.Equal(t, 2, ranges["var.name"].Start.Line)
+	assert.Equal(t, 3, ranges["data.env.home"].Start.Line)
+	assert.Equal(t, 6, ranges["stage.build"].Start.Line)
+	assert.Equal(t, 9, ranges["togomak.pre"].Start.Line)
+}
+
+func TestListItem_HasPhase(t *testing.T) {
+	stage := ListItem{Type: "stage"}
+	assert.True(t, stage.HasPhase("default"))
+	assert.False(t, stage.HasPhase("deploy"))
+
+	stage.Phases = []string{"build", "deploy"}
+	assert.True(t, stage.HasPhase("deploy"))
+	assert.False(t, stage.HasPhase("default"))
+
+	variable := ListItem{Type: "variable"}
+	assert.False(t, variable.HasPhase("default"))
+}
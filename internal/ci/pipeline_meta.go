@@ -107,6 +107,14 @@ func Merge(pipelines MetaList) (*Pipeline, hcl.Diagnostics) {
 			})
 		}
 
+		if pipe.Outputs.CheckIfDistinct(p.pipe.Outputs).HasErrors() {
+			return nil, diags.Append(&hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "duplicate output",
+				Detail:   fmt.Sprintf("duplicate output definition in %s", p.filename),
+			})
+		}
+
 		if p.pipe.Pre != nil {
 			if pre != nil {
 				return nil, diags.Append(&hcl.Diagnostic{
@@ -129,6 +137,13 @@ func Merge(pipelines MetaList) (*Pipeline, hcl.Diagnostics) {
 			post = p.pipe.Post
 		}
 
+		if p.pipe.Builder.Logging != nil {
+			if pipe.Builder.Logging == nil {
+				pipe.Builder.Logging = &Logging{}
+			}
+			pipe.Builder.Logging.Sinks = append(pipe.Builder.Logging.Sinks, p.pipe.Builder.Logging.Sinks...)
+		}
+
 		pipe.Stages = append(pipe.Stages, p.pipe.Stages...)
 		pipe.Data = append(pipe.Data, p.pipe.Data...)
 		pipe.DataProviders = append(pipe.DataProviders, p.pipe.DataProviders...)
@@ -138,6 +153,7 @@ func Merge(pipelines MetaList) (*Pipeline, hcl.Diagnostics) {
 		pipe.Locals = append(pipe.Locals, p.pipe.Locals...)
 		pipe.Imports = append(pipe.Imports, p.pipe.Imports...)
 		pipe.Vars = append(pipe.Vars, p.pipe.Vars...)
+		pipe.Outputs = append(pipe.Outputs, p.pipe.Outputs...)
 
 	}
 	pipe.Pre = pre
@@ -3,9 +3,15 @@ package ci
 import (
 	"context"
 	"github.com/hashicorp/hcl/v2"
+	"github.com/srevinsaju/togomak/v1/internal/blocks"
 	"github.com/srevinsaju/togomak/v1/internal/c"
 	"github.com/srevinsaju/togomak/v1/internal/dg"
+	"github.com/srevinsaju/togomak/v1/internal/lockfile"
+	"github.com/srevinsaju/togomak/v1/internal/profile"
+	"github.com/srevinsaju/togomak/v1/internal/runlog"
 	"github.com/srevinsaju/togomak/v1/internal/runnable"
+	"github.com/srevinsaju/togomak/v1/internal/ui"
+	"time"
 )
 
 func StartHandlers(conductor *Conductor) *Handler {
@@ -32,16 +38,79 @@ func (pipe *Pipeline) Run(conductor *Conductor) (*Handler, dg.AbstractDiagnostic
 	defer cancel()
 	defer h.WriteDiagnostics()
 
+	// --> the span of the run is the root of the trace, see profile.Profiler.Trace
+	if conductor.parent == nil {
+		start := time.Now()
+		runSpan := conductor.Profiler().Start(profile.CategoryRun, profile.TrackOrchestra, "run").
+			SetArg("pipeline", cfg.Paths.Pipeline).
+			SetArg("filters", cfg.Pipeline.Filtered.Marshall())
+		defer func() {
+			failed := h.Diags.HasErrors()
+			runSpan.SetArg("failed", failed).End()
+			conductor.Metrics().Run(failed, start, time.Now())
+		}()
+	}
+
+	// --> record the output of the stages in .togomak/runs, the modules and
+	// the child processes write to the run of their parent
+	if conductor.parent == nil && !cfg.Pipeline.DryRun && !cfg.Behavior.Child.Enabled {
+		runLog, err := runlog.Start(runlog.Dir(cfg.Paths.Cwd), cfg.Paths.Pipeline)
+		if err != nil {
+			logger.Warnf("failed to record the run: %s", err)
+		} else {
+			conductor.Update(ConductorWithRunLog(runLog))
+			defer func() {
+				failed := h.Diags.HasErrors()
+				if err := runLog.Close(failed); err != nil {
+					logger.Warnf("failed to record the run: %s", err)
+				}
+				if failed {
+					logger.Infof("the output of the stages was recorded, see %s", ui.Bold("togomak logs "+runLog.Id()))
+				}
+			}()
+		}
+	}
+
+	// --> verify the remote sources against the lock file, the modules share the lock file
+	// of their parent, and the child processes do not lock their sources. The run does not
+	// write the lock file, see togomak lock
+	if conductor.parent == nil && !cfg.Behavior.Child.Enabled {
+		lock, d := lockfile.Load(LockFile(cfg.Paths), cfg.Pipeline.Upgrade)
+		h.Diags.Extend(d)
+		if h.Diags.HasErrors() {
+			return h, h.Diags
+		}
+		conductor.Update(ConductorWithLock(lock))
+	}
+
 	// --> expand imports
+	span := conductor.Profiler().Start(profile.CategoryImport, profile.TrackOrchestra, "expand imports")
 	pipe, d = ExpandImports(conductor, pipe, conductor.Config.Paths)
+	span.End()
 	h.Diags.Extend(d)
 	if h.Diags.HasErrors() {
 		return h, h.Diags
 	}
 
+	// --> read the variable files, the modules get their variables from the module block
+	if conductor.parent == nil {
+		h.Diags.Extend(ReadVarFiles(conductor, pipe))
+		if h.Diags.HasErrors() {
+			return h, h.Diags
+		}
+	}
+	if conductor.module != nil {
+		h.Diags.Extend(conductor.module.checkInputs(pipe.Vars, conductor.Variables()))
+		if h.Diags.HasErrors() {
+			return h, h.Diags
+		}
+	}
+
 	/// we will first expand all local blocks
 	logger.Debugf("expanding local blocks")
+	span = conductor.Profiler().Start(profile.CategoryLocals, profile.TrackOrchestra, "expand locals")
 	locals, d := pipe.Locals.Expand()
+	span.End()
 	h.Diags.Extend(d)
 	if d.HasErrors() {
 		return h, h.Diags
@@ -57,11 +126,32 @@ func (pipe *Pipeline) Run(conductor *Conductor) (*Handler, dg.AbstractDiagnostic
 	// we will now generate a dependency graph from the pipeline
 	// this will be used to generate the pipeline
 	logger.Debugf("generating dependency graph")
+	span = conductor.Profiler().Start(profile.CategoryGraph, profile.TrackOrchestra, "generate dependency graph")
 	depGraph, d := GraphTopoSort(conductor, pipe)
+	span.End()
 	h.Diags.Extend(d)
 	if h.Diags.HasErrors() {
 		return h, h.Diags
 	}
+	h = h.Update(WithGraph(depGraph))
+
+	// --> skip the stages and modules whose paths did not change
+	d = pipe.expandChanges(conductor, depGraph)
+	h.Diags.Extend(d)
+	if h.Diags.HasErrors() {
+		return h, h.Diags
+	}
+
+	// the stages and modules are pending until they run, or are skipped
+	for _, runnableId := range depGraph.TopoSorted() {
+		ty := graphNodeType(runnableId)
+		if ty != blocks.StageBlock && ty != blocks.ModuleBlock {
+			continue
+		}
+		if block, skip, d := pipe.Resolve(runnableId); !skip && !d.HasErrors() {
+			conductor.observe(runnableId, block, runnable.StatusPending, 0)
+		}
+	}
 
 	// endregion: interrupt h
 	opts := []runnable.Option{
@@ -82,7 +172,7 @@ func (pipe *Pipeline) Run(conductor *Conductor) (*Handler, dg.AbstractDiagnostic
 
 		for _, runnableId := range layer {
 
-			runnable, skip, d := pipe.Resolve(runnableId)
+			block, skip, d := pipe.Resolve(runnableId)
 			if skip {
 				continue
 			}
@@ -91,7 +181,7 @@ func (pipe *Pipeline) Run(conductor *Conductor) (*Handler, dg.AbstractDiagnostic
 				break
 			}
 
-			ok, overridden, d := BlockCanRun(runnable, conductor, runnableId, depGraph, opts...)
+			ok, overridden, d := BlockCanRun(block, conductor, runnableId, depGraph, opts...)
 			h.Diags.Extend(d)
 			if d.HasErrors() {
 				break
@@ -99,7 +189,7 @@ func (pipe *Pipeline) Run(conductor *Conductor) (*Handler, dg.AbstractDiagnostic
 
 			// prepare step needs to pipeline.Run before the runnable is pipeline.Run
 			// we will also need to prompt the user with the information saying that it has been skipped
-			d = runnable.Prepare(conductor, !ok, overridden)
+			d = block.Prepare(conductor, !ok, overridden)
 			h.Diags.Extend(d)
 			if d.HasErrors() {
 				break
@@ -107,18 +197,20 @@ func (pipe *Pipeline) Run(conductor *Conductor) (*Handler, dg.AbstractDiagnostic
 
 			if !ok {
 				logger.Debugf("skipping runnable %s, condition evaluated to false", runnableId)
+				conductor.observe(runnableId, block, runnable.StatusSkipped, 0)
 				continue
 			}
 
-			logger.Debugf("runnable %s is %T", runnableId, runnable)
+			logger.Debugf("runnable %s is %T", runnableId, block)
 
-			if runnable.IsDaemon() {
-				h.Tracker.AppendDaemon(runnable)
+			if block.IsDaemon() {
+				h.Tracker.AppendDaemon(block)
 			} else {
-				h.Tracker.AppendRunnable(runnable)
+				h.Tracker.AppendRunnable(block)
 			}
 
-			go BlockRunWithRetries(conductor, runnableId, runnable, h, conductor.Logger(), opts...)
+			conductor.observe(runnableId, block, runnable.StatusRunning, 0)
+			go BlockRunWithRetries(conductor, runnableId, block, h, conductor.Logger(), opts...)
 
 			if cfg.Pipeline.DryRun {
 				// TODO: implement --concurrency option
@@ -149,6 +241,43 @@ func (pipe *Pipeline) Run(conductor *Conductor) (*Handler, dg.AbstractDiagnostic
 		}
 	}
 
+	// --> evaluate the outputs, once all the stages and modules ran
+	if !h.Diags.HasErrors() && len(pipe.Outputs) != 0 && !cfg.Pipeline.DryRun {
+		d = pipe.expandOutputValues(conductor)
+		h.Diags.Extend(d)
+	}
+
 	h.Tracker.DaemonWait()
 	return h, h.Diags
 }
+
+// expandOutputValues evaluates the output blocks, and records them with the run. The outputs
+// may refer to stages which did not run because of the filters of the run, in which case they
+// are not evaluated, and a warning is reported instead of an error
+func (pipe *Pipeline) expandOutputValues(conductor *Conductor) hcl.Diagnostics {
+	logger := conductor.Logger().WithField("orchestra", "outputs")
+	span := conductor.Profiler().Start(profile.CategoryOrchestra, profile.TrackOrchestra, "evaluate outputs")
+	defer span.End()
+
+	// the stages of the last layer may have written to the TOGOMAK_ENV file
+	diags := ExpandOutputs(conductor)
+	if diags.HasErrors() {
+		return diags
+	}
+	values, d := pipe.Outputs.Eval(conductor)
+	if len(conductor.Config.Pipeline.Filtered) != 0 {
+		for _, diag := range d {
+			diag.Severity = hcl.DiagWarning
+		}
+	}
+	diags = diags.Extend(d)
+	conductor.outputValues = values
+
+	outputs, err := values.Record()
+	if err != nil {
+		logger.Warnf("failed to record the outputs: %s", err)
+	} else if err := conductor.RunLog().SetOutputs(outputs); err != nil {
+		logger.Warnf("failed to record the outputs: %s", err)
+	}
+	return diags
+}
@@ -0,0 +1,115 @@
+package ci
+
+import (
+	"fmt"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/kendru/darwin/go/depgraph"
+	"github.com/srevinsaju/togomak/v1/internal/blocks"
+	"github.com/srevinsaju/togomak/v1/internal/runnable"
+	"strings"
+)
+
+const (
+	PlanDecisionRun        = "run"
+	PlanDecisionSkip       = "skip"
+	PlanDecisionOverridden = "overridden"
+	PlanDecisionDaemon     = "daemon"
+)
+
+// PlanEntry is the decision on whether a single runnable would run, and the rule which
+// produced the decision
+type PlanEntry struct {
+	Id       string `json:"id"`
+	Decision string `json:"decision"`
+	Rule     string `json:"rule"`
+}
+
+// conditionDependencies returns the runnables referenced by the condition of a stage or a module.
+// Such conditions can only be evaluated after the referenced runnables have run
+func conditionDependencies(block Block) []string {
+	var traversals []hcl.Traversal
+	switch b := block.(type) {
+	case *Stage:
+		traversals = append(traversals, b.Condition.Variables()...)
+		if b.Use != nil && b.Use.Parameters != nil {
+			traversals = append(traversals, b.Use.Parameters.Variables()...)
+		}
+	case *Module:
+		traversals = append(traversals, b.Condition.Variables()...)
+	}
+
+	var deps []string
+	for _, traversal := range traversals {
+		parent, d := ResolveFromTraversal(traversal)
+		if d.HasErrors() || parent == "" {
+			continue
+		}
+		deps = append(deps, parent)
+	}
+	return deps
+}
+
+// Plan resolves which runnables of the pipeline would run with the filters, queries and lifecycle
+// phases in the conductor configuration, without running any of them. Conditions which depend
+// on other runnables cannot be evaluated before the pipeline runs, and are assumed to be true.
+func (pipe *Pipeline) Plan(conductor *Conductor, depGraph *depgraph.Graph, opts ...runnable.Option) ([]PlanEntry, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	var plan []PlanEntry
+
+	diags = diags.Extend(pipe.expandChanges(conductor, depGraph))
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	for _, layer := range depGraph.TopoSortedLayers() {
+		for _, runnableId := range layer {
+			block, skip, d := pipe.Resolve(runnableId)
+			if skip {
+				continue
+			}
+			diags = diags.Extend(d)
+			if d.HasErrors() {
+				continue
+			}
+
+			if block.Type() == blocks.MacroBlock {
+				plan = append(plan, PlanEntry{
+					Id:       runnableId,
+					Decision: PlanDecisionSkip,
+					Rule:     "macros are expanded by the stages which use them",
+				})
+				continue
+			}
+
+			var ok bool
+			var condition string
+			if deps := conditionDependencies(block); len(deps) != 0 {
+				ok = true
+				condition = fmt.Sprintf("if depends on %s, assumed true", strings.Join(deps, ", "))
+			} else {
+				ok, d = block.CanRun(conductor, opts...)
+				if d.HasErrors() {
+					ok = true
+					condition = "if could not be evaluated, assumed true"
+				} else {
+					condition = fmt.Sprintf("if evaluated to %t", ok)
+				}
+			}
+
+			ok, overridden, rule, d := BlockFilterExplain(block, conductor, runnableId, depGraph, ok, condition)
+			diags = diags.Extend(d)
+
+			decision := PlanDecisionRun
+			switch {
+			case !ok:
+				decision = PlanDecisionSkip
+			case block.IsDaemon():
+				decision = PlanDecisionDaemon
+			case overridden:
+				decision = PlanDecisionOverridden
+			}
+			plan = append(plan, PlanEntry{Id: runnableId, Decision: decision, Rule: rule})
+		}
+	}
+	return plan, diags
+}
@@ -0,0 +1,51 @@
+package ci
+
+import (
+	"github.com/srevinsaju/togomak/v1/internal/rules"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPipeline_Plan(t *testing.T) {
+	filtered, diags := rules.Unmarshal([]string{"+stage.docker", "deploy"})
+	assert.False(t, diags.HasErrors())
+	conductor := newTestConductor(ConductorConfig{Pipeline: ConfigPipeline{Filtered: filtered}})
+
+	src := `
+togomak {
+  version = 2
+}
+stage "normal" {
+  script = "true"
+}
+stage "docker" {
+  lifecycle {
+    phase = ["build"]
+  }
+  script = "true"
+}
+stage "deploy" {
+  if = stage.docker.id == "docker"
+  lifecycle {
+    phase = ["deploy"]
+  }
+  script = "true"
+}
+`
+	pipe := &Pipeline{}
+	decodeConfig(t, src, pipe)
+	depGraph, diags := GraphTopoSort(conductor, pipe)
+	assert.False(t, diags.HasErrors())
+
+	plan, diags := pipe.Plan(conductor, depGraph)
+	assert.False(t, diags.HasErrors())
+
+	decisions := make(map[string]PlanEntry)
+	for _, entry := range plan {
+		decisions[entry.Id] = entry
+	}
+	assert.Equal(t, PlanDecisionSkip, decisions["stage.normal"].Decision)
+	assert.Equal(t, PlanDecisionOverridden, decisions["stage.docker"].Decision)
+	assert.Equal(t, PlanDecisionRun, decisions["stage.deploy"].Decision)
+	assert.Contains(t, decisions["stage.deploy"].Rule, "assumed true")
+}
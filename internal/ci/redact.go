@@ -0,0 +1,295 @@
+package ci
+
+import (
+	"bytes"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/sirupsen/logrus"
+	"github.com/srevinsaju/togomak/v1/internal/third-party/hashicorp/terraform/lang/funcs"
+	"github.com/srevinsaju/togomak/v1/internal/third-party/hashicorp/terraform/lang/marks"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// sensitiveValue replaces the sensitive values in the output of the stages, the logs,
+// the diagnostics, togomak describe and the JSON reports
+const sensitiveValue = "(sensitive value)"
+
+// Redactions are the sensitive values of a run, like the values of the variables with
+// sensitive = true, or the values passed to the sensitive function. They are replaced with
+// (sensitive value) in the output of the stages, the logs and the diagnostics. The modules
+// share the redactions of their parent, a nil *Redactions redacts nothing
+type Redactions struct {
+	mu       sync.RWMutex
+	values   map[string]bool
+	replacer *strings.Replacer
+}
+
+// Add adds values to the redactions, the empty strings are ignored
+func (r *Redactions) Add(values ...string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.values == nil {
+		r.values = make(map[string]bool)
+	}
+	changed := false
+	for _, v := range values {
+		if v == "" || r.values[v] {
+			continue
+		}
+		r.values[v] = true
+		changed = true
+	}
+	if !changed {
+		return
+	}
+
+	// the longest values are replaced first, so that a value which contains
+	// another value is redacted as a whole
+	sorted := make([]string, 0, len(r.values))
+	for v := range r.values {
+		sorted = append(sorted, v)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if len(sorted[i]) != len(sorted[j]) {
+			return len(sorted[i]) > len(sorted[j])
+		}
+		return sorted[i] < sorted[j]
+	})
+	oldnew := make([]string, 0, 2*len(sorted))
+	for _, v := range sorted {
+		oldnew = append(oldnew, v, sensitiveValue)
+	}
+	r.replacer = strings.NewReplacer(oldnew...)
+}
+
+// AddValue adds the strings of the parts of v marked as sensitive to the redactions
+func (r *Redactions) AddValue(v cty.Value) {
+	if r == nil || !v.ContainsMarked() {
+		return
+	}
+	unmarked, pvm := v.UnmarkDeepWithPaths()
+	for _, pv := range pvm {
+		if _, ok := pv.Marks[marks.Sensitive]; !ok {
+			continue
+		}
+		sensitive, err := pv.Path.Apply(unmarked)
+		if err != nil {
+			continue
+		}
+		_ = cty.Walk(sensitive, func(_ cty.Path, v cty.Value) (bool, error) {
+			if v.IsKnown() && !v.IsNull() && v.Type() == cty.String {
+				r.Add(v.AsString())
+			}
+			return true, nil
+		})
+	}
+}
+
+// Empty reports if there are no values to redact
+func (r *Redactions) Empty() bool {
+	if r == nil {
+		return true
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.replacer == nil
+}
+
+// Redact replaces the sensitive values in s with (sensitive value)
+func (r *Redactions) Redact(s string) string {
+	if r == nil {
+		return s
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.replacer == nil {
+		return s
+	}
+	return r.replacer.Replace(s)
+}
+
+// Writer returns a writer which redacts what is written to out. The writer buffers
+// the output until the end of each line, so that a value split across two writes is
+// still redacted, the last line is written by Close. The values are read on every
+// write, so that the values added once the writer was created are redacted as well
+func (r *Redactions) Writer(out io.Writer) io.WriteCloser {
+	return &redactWriter{redactions: r, out: out}
+}
+
+type redactWriter struct {
+	redactions *Redactions
+	out        io.Writer
+
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (w *redactWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf.Write(p)
+	i := bytes.LastIndexByte(w.buf.Bytes(), '\n')
+	if i < 0 {
+		return len(p), nil
+	}
+	lines := string(w.buf.Next(i + 1))
+	if _, err := io.WriteString(w.out, w.redactions.Redact(lines)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *redactWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	rest := w.buf.String()
+	w.buf.Reset()
+	_, err := io.WriteString(w.out, w.redactions.Redact(rest))
+	return err
+}
+
+// redactHook redacts the sensitive values from the messages of the log entries, it
+// is the first hook of the logger, so that the log sinks receive the redacted entries
+type redactHook struct {
+	redactions *Redactions
+}
+
+func (h redactHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h redactHook) Fire(entry *logrus.Entry) error {
+	entry.Message = h.redactions.Redact(entry.Message)
+	return nil
+}
+
+// addRedactHook adds a redactHook before the other hooks of logger
+func addRedactHook(logger *logrus.Logger, redactions *Redactions) {
+	hooks := make(logrus.LevelHooks)
+	hooks.Add(redactHook{redactions: redactions})
+	for level, levelHooks := range logger.Hooks {
+		hooks[level] = append(hooks[level], levelHooks...)
+	}
+	logger.ReplaceHooks(hooks)
+}
+
+// redactDiagWriter redacts the sensitive values from the details of the diagnostics. The values
+// of the expressions shown by the diagnostics are also redacted, hcl cannot render marked values
+type redactDiagWriter struct {
+	writer    hcl.DiagnosticWriter
+	conductor *Conductor
+}
+
+func (w redactDiagWriter) WriteDiagnostic(diag *hcl.Diagnostic) error {
+	redacted := *diag
+	redacted.Detail = w.conductor.redactions.Redact(diag.Detail)
+	redacted.EvalContext = redactEvalContext(diag.EvalContext)
+	return w.writer.WriteDiagnostic(&redacted)
+}
+
+func (w redactDiagWriter) WriteDiagnostics(diags hcl.Diagnostics) error {
+	for _, diag := range diags {
+		if err := w.WriteDiagnostic(diag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// redactEvalContext returns a copy of ctx, and of its parents, where the sensitive values are
+// replaced with (sensitive value)
+func redactEvalContext(ctx *hcl.EvalContext) *hcl.EvalContext {
+	if ctx == nil {
+		return nil
+	}
+	var chain []*hcl.EvalContext
+	for c := ctx; c != nil; c = c.Parent() {
+		chain = append([]*hcl.EvalContext{c}, chain...)
+	}
+
+	var redacted *hcl.EvalContext
+	for _, c := range chain {
+		if redacted == nil {
+			redacted = &hcl.EvalContext{}
+		} else {
+			redacted = redacted.NewChild()
+		}
+		redacted.Functions = c.Functions
+		if c.Variables == nil {
+			continue
+		}
+		redacted.Variables = make(map[string]cty.Value, len(c.Variables))
+		for name, v := range c.Variables {
+			redacted.Variables[name] = redactValue(v)
+		}
+	}
+	return redacted
+}
+
+// redactValue replaces the parts of v marked as sensitive with (sensitive value), or with
+// an unknown value if they are not strings
+func redactValue(v cty.Value) cty.Value {
+	if !v.ContainsMarked() {
+		return v
+	}
+	unmarked, pvm := v.UnmarkDeepWithPaths()
+	var sensitive []cty.Path
+	for _, pv := range pvm {
+		if _, ok := pv.Marks[marks.Sensitive]; ok {
+			sensitive = append(sensitive, pv.Path)
+		}
+	}
+	redacted, err := cty.Transform(unmarked, func(path cty.Path, v cty.Value) (cty.Value, error) {
+		for _, p := range sensitive {
+			if !p.Equals(path) {
+				continue
+			}
+			if v.Type() == cty.String {
+				return cty.StringVal(sensitiveValue), nil
+			}
+			return cty.UnknownVal(v.Type()), nil
+		}
+		return v, nil
+	})
+	if err != nil {
+		return cty.DynamicVal
+	}
+	return redacted
+}
+
+// sensitiveFunc is funcs.SensitiveFunc, which also adds the values it marks to redactions
+func sensitiveFunc(redactions *Redactions) function.Function {
+	return function.New(&function.Spec{
+		Description: funcs.SensitiveFunc.Description(),
+		Params:      funcs.SensitiveFunc.Params(),
+		Type: func(args []cty.Value) (cty.Type, error) {
+			return funcs.SensitiveFunc.ReturnTypeForValues(args)
+		},
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			v, err := funcs.SensitiveFunc.Call(args)
+			if err == nil {
+				redactions.AddValue(v)
+			}
+			return v, err
+		},
+	})
+}
+
+// unmark removes the marks of v, so that it can be converted to Go values, like strings.
+// The sensitive parts of v are added to the redactions of the run first, so that the values
+// derived from a sensitive value, like upper(var.token), are redacted as well
+func (c *Conductor) unmark(v cty.Value) cty.Value {
+	c.redactions.AddValue(v)
+	v, _ = v.UnmarkDeep()
+	return v
+}
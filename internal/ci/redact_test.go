@@ -0,0 +1,100 @@
+package ci
+
+import (
+	"bytes"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/srevinsaju/togomak/v1/internal/blocks"
+	"github.com/srevinsaju/togomak/v1/internal/third-party/hashicorp/terraform/lang/marks"
+	"github.com/stretchr/testify/assert"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+	"testing"
+)
+
+func TestRedactions(t *testing.T) {
+	var nilRedactions *Redactions
+	assert.Equal(t, "token", nilRedactions.Redact("token"))
+	assert.True(t, nilRedactions.Empty())
+
+	r := &Redactions{}
+	assert.True(t, r.Empty())
+	r.AddValue(cty.ObjectVal(map[string]cty.Value{
+		"user":  cty.StringVal("admin"),
+		"token": cty.StringVal("s3cr3t").Mark(marks.Sensitive),
+		"keys":  cty.ListVal([]cty.Value{cty.StringVal("s3cr3t-key")}).Mark(marks.Sensitive),
+	}))
+	r.Add("")
+	assert.False(t, r.Empty())
+	assert.Equal(t, "admin (sensitive value) (sensitive value)", r.Redact("admin s3cr3t s3cr3t-key"))
+
+	var buf bytes.Buffer
+	w := r.Writer(&buf)
+	_, _ = w.Write([]byte("token=s3c"))
+	assert.Empty(t, buf.String())
+	_, _ = w.Write([]byte("r3t\nkey=s3cr"))
+	assert.Equal(t, "token=(sensitive value)\n", buf.String())
+	_, _ = w.Write([]byte("3t-key"))
+	assert.NoError(t, w.Close())
+	assert.Equal(t, "token=(sensitive value)\nkey=(sensitive value)", buf.String())
+
+	// the values added once the writer was created are redacted as well
+	buf.Reset()
+	r = &Redactions{}
+	w = r.Writer(&buf)
+	_, _ = w.Write([]byte("before\n"))
+	r.AddValue(cty.StringVal("l4t3r").Mark(marks.Sensitive))
+	_, _ = w.Write([]byte("after l4t3r\n"))
+	assert.NoError(t, w.Close())
+	assert.Equal(t, "before\nafter (sensitive value)\n", buf.String())
+}
+
+func TestRedactEvalContext(t *testing.T) {
+	parent := &hcl.EvalContext{Variables: map[string]cty.Value{
+		"var": cty.ObjectVal(map[string]cty.Value{
+			"token":    cty.StringVal("s3cr3t").Mark(marks.Sensitive),
+			"replicas": cty.NumberIntVal(3).Mark(marks.Sensitive),
+			"region":   cty.StringVal("eu"),
+		}),
+	}}
+	child := parent.NewChild()
+	child.Variables = map[string]cty.Value{"each": cty.StringVal("key")}
+
+	redacted := redactEvalContext(child)
+	assert.Equal(t, cty.StringVal("key"), redacted.Variables["each"])
+	assert.Equal(t, cty.ObjectVal(map[string]cty.Value{
+		"token":    cty.StringVal(sensitiveValue),
+		"replicas": cty.UnknownVal(cty.Number),
+		"region":   cty.StringVal("eu"),
+	}), redacted.Parent().Variables["var"])
+	assert.True(t, parent.Variables["var"].ContainsMarked())
+}
+
+func TestSensitiveFunc(t *testing.T) {
+	r := &Redactions{}
+	expr, diags := hclsyntax.ParseExpression([]byte(`"Bearer ${sensitive("s3cr3t")}"`), "test.hcl", hcl.InitialPos)
+	assert.False(t, diags.HasErrors())
+	v, diags := expr.Value(&hcl.EvalContext{Functions: map[string]function.Function{"sensitive": sensitiveFunc(r)}})
+	assert.False(t, diags.HasErrors())
+	assert.True(t, v.HasMark(marks.Sensitive))
+	assert.Equal(t, "Bearer (sensitive value)", r.Redact("Bearer s3cr3t"))
+}
+
+func TestConductor_Unmark(t *testing.T) {
+	conductor := newTestConductor(ConductorConfig{})
+	conductor.Eval().Context().Variables[blocks.VarBlock] = cty.ObjectVal(map[string]cty.Value{
+		"token": cty.StringVal("s3cr3t").Mark(marks.Sensitive),
+	})
+
+	// the values derived from a sensitive value are redacted once they are unmarked
+	for _, src := range []string{`upper(var.token)`, `base64encode(var.token)`} {
+		expr, diags := hclsyntax.ParseExpression([]byte(src), "<test>", hcl.InitialPos)
+		assert.False(t, diags.HasErrors())
+		v, diags := expr.Value(conductor.Eval().Context())
+		assert.False(t, diags.HasErrors())
+		v = conductor.unmark(v)
+		assert.False(t, v.IsMarked())
+		assert.Equal(t, "token="+sensitiveValue, conductor.Redactions().Redact("token="+v.AsString()))
+	}
+	assert.Equal(t, "S3CR3T", conductor.unmark(cty.StringVal("S3CR3T")).AsString())
+}
@@ -1,25 +1,37 @@
 package ci
 
 import (
+	"fmt"
 	"github.com/hashicorp/hcl/v2"
 	"github.com/kendru/darwin/go/depgraph"
 	"github.com/sirupsen/logrus"
 	"github.com/srevinsaju/togomak/v1/internal/blocks"
+	"github.com/srevinsaju/togomak/v1/internal/profile"
 	"github.com/srevinsaju/togomak/v1/internal/rules"
 	"github.com/srevinsaju/togomak/v1/internal/runnable"
 	"github.com/zclconf/go-cty/cty"
+	"strings"
 	"time"
 )
 
 func BlockRunWithRetries(conductor *Conductor, runnableId string, runnable Block, handler *Handler, togomakLogger logrus.Ext1FieldLogger, opts ...runnable.Option) {
 	logger := togomakLogger.WithField("orchestra", "run")
 	logger.Debug("starting runnable with retries ", runnableId)
+	span := conductor.Profiler().Start(profile.CategoryRunnable, runnableId, runnableId)
+	if phased, ok := runnable.(PhasedBlock); ok && span != nil {
+		if phases := lifecyclePhases(conductor, conductor.Parser.Files(), phased.LifecycleConfig()); len(phases) != 0 {
+			span.SetArg("phases", phases)
+		}
+	}
+
 	stageDiags := runnable.Run(conductor, opts...)
 
 	handler.Tracker.AppendCompleted(runnable)
 	logger.Tracef("signaling runnable %s", runnableId)
 
 	if !stageDiags.HasErrors() {
+		span.SetArg("status", string(resultStatus(runnable, false))).End()
+		conductor.observeResult(runnableId, runnable, false, 0)
 		if runnable.IsDaemon() {
 			handler.Tracker.DaemonDone()
 		} else {
@@ -27,11 +39,11 @@ func BlockRunWithRetries(conductor *Conductor, runnableId string, runnable Block
 		}
 		return
 	}
+	retryCount := 0
 	if !runnable.CanRetry() {
 		logger.Debug("runnable cannot be retried")
 	} else {
 		logger.Infof("retrying runnable %s", runnableId)
-		retryCount := 0
 		retryMinBackOff := time.Duration(runnable.MinRetryBackoff()) * time.Second
 		retryMaxBackOff := time.Duration(runnable.MaxRetryBackoff()) * time.Second
 		retrySuccess := false
@@ -50,7 +62,10 @@ func BlockRunWithRetries(conductor *Conductor, runnableId string, runnable Block
 			}
 			logger.Warnf("runnable %s failed, retrying in %s", runnableId, sleepDuration)
 			time.Sleep(sleepDuration)
+			conductor.observeRetry(runnableId, runnable, retryCount)
+			retrySpan := conductor.Profiler().Start(profile.CategoryRetry, runnableId, fmt.Sprintf("retry %d", retryCount))
 			sDiags := runnable.Run(conductor, opts...)
+			retrySpan.SetArg("success", !sDiags.HasErrors()).End()
 			stageDiags = append(stageDiags, sDiags...)
 
 			if !sDiags.HasErrors() {
@@ -62,9 +77,12 @@ func BlockRunWithRetries(conductor *Conductor, runnableId string, runnable Block
 		if !retrySuccess {
 			logger.Warnf("runnable %s failed after %d retries", runnableId, retryCount)
 		}
+		span.SetArg("retries", retryCount)
 
 	}
 	handler.Diags.Extend(stageDiags)
+	span.SetArg("status", string(resultStatus(runnable, stageDiags.HasErrors()))).SetArg("failed", stageDiags.HasErrors()).End()
+	conductor.observeResult(runnableId, runnable, stageDiags.HasErrors(), retryCount)
 	if runnable.IsDaemon() {
 		handler.Tracker.DaemonDone()
 	} else {
@@ -73,18 +91,52 @@ func BlockRunWithRetries(conductor *Conductor, runnableId string, runnable Block
 }
 
 func BlockCanRun(runnable Block, conductor *Conductor, runnableId string, depGraph *depgraph.Graph, opts ...runnable.Option) (ok bool, overridden bool, diags hcl.Diagnostics) {
-
-	filterList := conductor.Config.Pipeline.Filtered
-	filterQuery := conductor.Config.Pipeline.FilterQuery
 	ok, d := runnable.CanRun(conductor, opts...)
 	if d.HasErrors() {
 		diags = diags.Extend(d)
 		return false, false, diags
 	}
+	return BlockFilter(runnable, conductor, runnableId, depGraph, ok)
+}
+
+// BlockFilter applies the filters (rules.Operations) and the --query engines passed on the command line
+// to a runnable, whose own condition evaluated to ok.
+func BlockFilter(runnable Block, conductor *Conductor, runnableId string, depGraph *depgraph.Graph, ok bool) (bool, bool, hcl.Diagnostics) {
+	ok, overridden, _, diags := BlockFilterExplain(runnable, conductor, runnableId, depGraph, ok, fmt.Sprintf("if evaluated to %t", ok))
+	return ok, overridden, diags
+}
+
+// BlockFilterExplain is BlockFilter, which additionally returns a human-readable reason
+// describing the rule which decided if the runnable runs. condition describes how ok was
+// determined, and is included in the reason. It is used by togomak plan.
+// Stages and modules whose paths did not change since ConfigPipeline.ChangedSince are skipped,
+// unless they are explicitly added with a "+" filter
+func BlockFilterExplain(runnable Block, conductor *Conductor, runnableId string, depGraph *depgraph.Graph, ok bool, condition string) (bool, bool, string, hcl.Diagnostics) {
+	ok, overridden, reason, diags := blockFilterExplain(runnable, conductor, runnableId, depGraph, ok, condition)
+	if !ok || !conductor.Unchanged(runnableId) {
+		return ok, overridden, reason, diags
+	}
+	for _, rule := range conductor.Config.Pipeline.Filtered {
+		if rule.RunnableId() == runnableId && rule.Operation() == rules.OperationTypeAdd {
+			return ok, overridden, reason, diags
+		}
+	}
+	return false, false, fmt.Sprintf("unchanged since %s", conductor.Config.Pipeline.ChangedSince), diags
+}
+
+func blockFilterExplain(runnable Block, conductor *Conductor, runnableId string, depGraph *depgraph.Graph, ok bool, condition string) (bool, bool, string, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	var d hcl.Diagnostics
+	var overridden bool
+
+	filterList := conductor.Config.Pipeline.Filtered
+	filterQuery := conductor.Config.Pipeline.FilterQuery
+
+	reason := condition
 
 	if runnable.Type() != blocks.StageBlock && runnable.Type() != blocks.ModuleBlock {
 		// TODO: optimize, PipelineRun only required data blocks
-		return ok, false, diags
+		return ok, false, fmt.Sprintf("%s blocks are not filtered", runnable.Type()), diags
 	}
 
 	runnable.Set(StageContextChildStatuses, filterList.Children(runnableId).Marshall())
@@ -93,8 +145,9 @@ func BlockCanRun(runnable Block, conductor *Conductor, runnableId string, depGra
 		ok, overridden, d = filterQuery.Eval(conductor, ok, runnable.(PhasedBlock))
 		if d.HasErrors() {
 			diags = diags.Extend(d)
-			return false, false, diags
+			return false, false, "--query failed to evaluate", diags
 		}
+		reason = fmt.Sprintf("--query evaluated to %t", ok)
 	}
 
 	if len(filterList) == 0 {
@@ -104,13 +157,15 @@ func BlockCanRun(runnable Block, conductor *Conductor, runnableId string, depGra
 
 	for _, rule := range filterList {
 		if rule.RunnableId() == "all" {
-			return ok, false, diags
+			return ok, false, fmt.Sprintf("rule %q, %s", rule.String(), reason), diags
 		}
 	}
 
 	oldOk := ok
+	oldReason := reason
 	ok = false
 	overridden = false
+	reason = fmt.Sprintf("not selected by any of the rules %s", strings.Join(filterList.Marshall(), ", "))
 
 	// if the list is empty, we will assume that the runnable is not overridden,
 	// and we will run all module blocks. This is so that the child processoe
@@ -130,34 +185,38 @@ func BlockCanRun(runnable Block, conductor *Conductor, runnableId string, depGra
 		conductor.Eval().Mutex().RUnlock()
 		if d.HasErrors() {
 			diags = diags.Extend(d)
-			return false, false, diags
+			return false, false, "lifecycle phase failed to evaluate", diags
 		}
 		phasesDefined = !phaseHcl.IsNull() || len(phases) > 0
 		phases = append(phases, phaseHcl.AsValueSlice()...)
 	}
 
-	if runnable.Type() == blocks.ModuleBlock && len(phases) == 0 && !phasesDefined {
+	if runnable.Type() == blocks.ModuleBlock && len(phases) == 0 && !phasesDefined && !conductor.Config.Pipeline.Exact {
 		ok = oldOk
 		overridden = false
-		return ok, overridden, diags
+		return ok, overridden, fmt.Sprintf("modules without lifecycle phases are not filtered, %s", oldReason), diags
 	}
 
 	for _, rule := range filterList {
 		if rule.RunnableId() == runnableId && rule.Operation() == rules.OperationTypeAdd {
 			ok = true
 			overridden = true
+			reason = fmt.Sprintf("rule %q", rule.String())
 		}
 		if rule.RunnableId() == runnableId && rule.Operation() == rules.OperationTypeSub {
 			ok = false
 			overridden = true
+			reason = fmt.Sprintf("rule %q", rule.String())
 		}
 		if rule.RunnableId() == runnableId && rule.Operation() == rules.OperationTypeAnd {
 			ok = oldOk
 			overridden = true
+			reason = fmt.Sprintf("rule %q, %s", rule.String(), oldReason)
 		}
-		if rule.Operation() == rules.OperationTypeAnd && depGraph.DependsOn(rule.RunnableId(), runnableId) {
+		if rule.Operation() == rules.OperationTypeAnd && !conductor.Config.Pipeline.Exact && depGraph.DependsOn(rule.RunnableId(), runnableId) {
 			ok = oldOk
 			overridden = true
+			reason = fmt.Sprintf("rule %q depends on it, %s", rule.String(), oldReason)
 		}
 		if runnable.Type() == blocks.StageBlock || runnable.Type() == blocks.ModuleBlock {
 			if phasesDefined {
@@ -165,19 +224,22 @@ func BlockCanRun(runnable Block, conductor *Conductor, runnableId string, depGra
 					if rule.RunnableId() == phase.AsString() {
 						overridden = false
 						ok = oldOk
+						reason = fmt.Sprintf("rule %q matches lifecycle phase %q, %s", rule.String(), phase.AsString(), oldReason)
 					}
 				}
 				if len(phases) == 0 && rule.RunnableId() == "default" {
 					ok = oldOk
 					overridden = false
+					reason = fmt.Sprintf("rule %q, no lifecycle phases, %s", rule.String(), oldReason)
 				}
 			} else {
 				if rule.RunnableId() == "default" {
 					ok = oldOk
 					overridden = false
+					reason = fmt.Sprintf("rule %q, no lifecycle phases, %s", rule.String(), oldReason)
 				}
 			}
 		}
 	}
-	return ok, overridden, diags
+	return ok, overridden, reason, diags
 }
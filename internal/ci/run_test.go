@@ -4,9 +4,16 @@ import (
 	"context"
 	"github.com/hashicorp/hcl/v2"
 	"github.com/srevinsaju/togomak/v1/internal/behavior"
+	"github.com/srevinsaju/togomak/v1/internal/meta"
+	"github.com/srevinsaju/togomak/v1/internal/metrics"
 	"github.com/srevinsaju/togomak/v1/internal/path"
+	"github.com/srevinsaju/togomak/v1/internal/profile"
 	"github.com/srevinsaju/togomak/v1/internal/rules"
+	"github.com/srevinsaju/togomak/v1/internal/runnable"
+	"github.com/stretchr/testify/assert"
 	"github.com/zclconf/go-cty/cty"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -245,3 +252,66 @@ func TestCanRun(t *testing.T) {
 	//	return
 	//}
 }
+
+// runModule runs a module with an empty pipeline through BlockRunWithRetries, like the
+// orchestrator does, with the given options of the conductor
+func runModule(t *testing.T, opts ...ConductorOption) *Conductor {
+	owd, err := os.Getwd()
+	assert.NoError(t, err)
+	defer os.Chdir(owd)
+
+	dir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "api"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "api", meta.ConfigFileName), []byte("togomak {\n  version = 2\n}\n"), 0644))
+	src := `
+togomak {
+  version = 2
+}
+module "api" {
+  source = "./api"
+}
+`
+	pipe := &Pipeline{}
+	decodeConfig(t, src, pipe)
+
+	conductor := newTestConductor(ConductorConfig{
+		Paths: &path.Path{
+			Pipeline: filepath.Join(dir, meta.ConfigFileName),
+			Owd:      dir,
+			Cwd:      dir,
+			Module:   dir,
+		},
+	}, opts...)
+	handler := NewHandler()
+	m := &pipe.Modules[0]
+	handler.Tracker.AppendRunnable(m)
+	BlockRunWithRetries(conductor, "module.api", m, handler, conductor.Logger(),
+		runnable.WithPaths(conductor.Config.Paths),
+		runnable.WithBehavior(conductor.Config.Behavior),
+	)
+	assert.False(t, handler.Diags.HasErrors(), handler.Diags.Error())
+	return conductor
+}
+
+func TestBlockRunWithRetries_ModuleStatus(t *testing.T) {
+	conductor := runModule(t, ConductorWithProfiler(profile.New()))
+	var status any
+	for _, event := range conductor.Profiler().Events() {
+		if event.Cat == profile.CategoryRunnable && event.Name == "module.api" {
+			status = event.Args["status"]
+		}
+	}
+	assert.Equal(t, string(runnable.StatusSuccess), status)
+}
+
+func TestBlockRunWithRetries_ModuleMetrics(t *testing.T) {
+	m := metrics.New("togomak.hcl")
+	runModule(t, ConductorWithMetrics(m))
+
+	path := filepath.Join(t.TempDir(), "togomak.prom")
+	assert.NoError(t, m.WriteTextfile(path))
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `togomak_stage_runs_total{pipeline="togomak.hcl",stage="module.api",status="success"} 1`)
+	assert.NotContains(t, string(data), `status="terminated"`)
+}
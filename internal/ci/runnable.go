@@ -180,43 +180,60 @@ func Resolve(pipe *Pipeline, id string) (Block, hcl.Diagnostics) {
 	})
 }
 
+// traversalAttrs returns the names of the n attributes following the root of the traversal,
+// for example, stage.build.id returns [build] for n = 1
+func traversalAttrs(variable hcl.Traversal, n int) ([]string, hcl.Diagnostics) {
+	var names []string
+	for i := 1; i <= n; i++ {
+		if len(variable) <= i {
+			break
+		}
+		attr, ok := variable[i].(hcl.TraverseAttr)
+		if !ok {
+			break
+		}
+		names = append(names, attr.Name)
+	}
+	if len(names) != n {
+		return nil, hcl.Diagnostics{
+			{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid reference",
+				Detail:   fmt.Sprintf("A reference to a %s block must be followed by %d attribute name(s)", variable.RootName(), n),
+				Subject:  variable.SourceRange().Ptr(),
+			},
+		}
+	}
+	return names, nil
+}
+
 func ResolveFromTraversal(variable hcl.Traversal) (string, hcl.Diagnostics) {
 	blockType := variable.RootName()
-	var parent string
-	var diags hcl.Diagnostics
 	switch blockType {
 	case DataBlock:
 		// the data block has the provider type as well as the name
-		provider := variable[1].(hcl.TraverseAttr).Name
-		name := variable[2].(hcl.TraverseAttr).Name
-		parent = x.RenderBlock(DataBlock, provider, name)
-	case b.StageBlock:
-		// the stage block has the name
-		name := variable[1].(hcl.TraverseAttr).Name
-		parent = x.RenderBlock(b.StageBlock, name)
-	case LocalBlock:
-		// the local block has the name
-		name := variable[1].(hcl.TraverseAttr).Name
-		parent = x.RenderBlock(LocalBlock, name)
-	case b.MacroBlock:
-		// the local block has the name
-		name := variable[1].(hcl.TraverseAttr).Name
-		parent = x.RenderBlock(b.MacroBlock, name)
-	case b.ModuleBlock:
-		// the module block has the name
-		name := variable[1].(hcl.TraverseAttr).Name
-		parent = x.RenderBlock(b.ModuleBlock, name)
+		names, diags := traversalAttrs(variable, 2)
+		if diags.HasErrors() {
+			return "", diags
+		}
+		return x.RenderBlock(DataBlock, names[0], names[1]), nil
+	case b.StageBlock, LocalBlock, b.MacroBlock, b.ModuleBlock:
+		// the stage, local, macro and module blocks have the name
+		names, diags := traversalAttrs(variable, 1)
+		if diags.HasErrors() {
+			return "", diags
+		}
+		return x.RenderBlock(blockType, names[0]), nil
 	case b.VarBlock, b.VariableBlock:
 		// the variable block has the name
-		name := variable[1].(hcl.TraverseAttr).Name
-		parent = x.RenderBlock(b.VarBlock, name)
-		parent = x.RenderBlock(b.VarBlock, name)
+		names, diags := traversalAttrs(variable, 1)
+		if diags.HasErrors() {
+			return "", diags
+		}
+		return x.RenderBlock(b.VarBlock, names[0]), nil
 	case b.ParamBlock, ThisBlock, BuilderBlock:
 		return "", nil
 	default:
 		return "", nil
-
 	}
-	return parent, diags
-
 }
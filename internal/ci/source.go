@@ -0,0 +1,325 @@
+package ci
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hashicorp/go-getter"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/srevinsaju/togomak/v1/internal/cache"
+	"github.com/srevinsaju/togomak/v1/internal/lockfile"
+	"github.com/srevinsaju/togomak/v1/internal/meta"
+	"github.com/srevinsaju/togomak/v1/internal/path"
+	"github.com/zclconf/go-cty/cty"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// VendorDir is the directory next to the pipeline to which togomak vendor copies the
+	// remote sources of the imports and the modules. The vendored sources are used instead
+	// of fetching them
+	VendorDir = "togomak_vendor"
+
+	// VendorManifestFileName is the file in VendorDir which lists the vendored sources
+	VendorManifestFileName = "sources.json"
+)
+
+// RemoteSource is a remote source fetched by the pipeline, or by one of its modules
+type RemoteSource struct {
+	// Source is the source, as detected by go-getter
+	Source string `json:"source"`
+
+	// Resolved is the source pinned to the commit it resolved to, see lockfile.Resolve
+	Resolved string `json:"resolved"`
+
+	// Dir is the directory of the files of the source
+	Dir string `json:"-"`
+}
+
+// Key returns the name of the entry of the source in the cache, and of its directory in VendorDir,
+// see cache.Key
+func (s RemoteSource) Key() string {
+	return cache.Key(s.Source)
+}
+
+// VendorManifest lists the sources in VendorDir, by the name of their directory
+type VendorManifest map[string]RemoteSource
+
+// ReadVendorManifest reads the manifest of the vendored sources in dir, an empty
+// manifest is returned if there are no vendored sources
+func ReadVendorManifest(dir string) (VendorManifest, error) {
+	manifest := make(VendorManifest)
+	data, err := os.ReadFile(filepath.Join(dir, VendorDir, VendorManifestFileName))
+	if os.IsNotExist(err) {
+		return manifest, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return manifest, json.Unmarshal(data, &manifest)
+}
+
+// sources are the remote sources fetched by a run, shared by the pipeline and its modules, so
+// that each source is fetched once
+type sources struct {
+	mu      sync.Mutex
+	fetched map[string]*fetchedSource
+
+	// releases release the locks on the copies in the cache used by the run, see Release
+	releases []func()
+}
+
+type fetchedSource struct {
+	once   sync.Once
+	source RemoteSource
+	diags  hcl.Diagnostics
+}
+
+// Remote returns the remote sources fetched by the run, sorted by source
+func (s *sources) Remote() []RemoteSource {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var remote []RemoteSource
+	for _, f := range s.fetched {
+		if f.source.Dir != "" {
+			remote = append(remote, f.source)
+		}
+	}
+	sort.Slice(remote, func(i, j int) bool {
+		return remote[i].Source < remote[j].Source
+	})
+	return remote
+}
+
+// hold keeps the lock on a copy in the cache, released by release, until the run ends
+func (s *sources) hold(release func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.releases = append(s.releases, release)
+}
+
+// Release releases the locks on the copies in the cache used by the run, so that they
+// may be pruned, see cache.RLock
+func (s *sources) Release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, release := range s.releases {
+		release()
+	}
+	s.releases = nil
+}
+
+// FetchedSources returns the remote sources fetched by the pipeline and its modules
+func (c *Conductor) FetchedSources() []RemoteSource {
+	return c.sources.Remote()
+}
+
+// fetchSource fetches src, relative to pwd, and returns the directory of its files. The sources
+// on the local filesystem are fetched to dst. The remote sources are read from VendorDir if they
+// were vendored, or fetched to the cache of the user otherwise, see fetchRemoteSource. The remote
+// sources are verified against the lock file of the run
+func (c *Conductor) fetchSource(src string, pwd string, dst string, subject *hcl.Range) (string, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	logger := c.Logger().WithField("source", src)
+	detected, err := getter.Detect(src, pwd, getter.Detectors)
+	if err != nil {
+		return "", diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "failed to download source",
+			Detail:   err.Error(),
+			Subject:  subject,
+		})
+	}
+	if strings.HasPrefix(detected, "file://") {
+		get := &getter.Client{Ctx: c.Context(), Src: src, Dst: dst, Pwd: pwd, Dir: true}
+		if err := get.Get(); err != nil {
+			return "", diags.Append(&hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "failed to download source",
+				Detail:   err.Error(),
+				Subject:  subject,
+			})
+		}
+		return dst, diags
+	}
+
+	c.sources.mu.Lock()
+	f, ok := c.sources.fetched[detected]
+	if !ok {
+		f = &fetchedSource{}
+		c.sources.fetched[detected] = f
+	}
+	c.sources.mu.Unlock()
+
+	f.once.Do(func() {
+		f.source = RemoteSource{Source: detected, Resolved: detected}
+		key := f.source.Key()
+
+		manifest, err := ReadVendorManifest(c.Config.Paths.Cwd)
+		if err != nil {
+			logger.Warnf("failed to read the vendored sources: %s", err)
+		}
+		if vendored, ok := manifest[key]; ok && !c.Config.Pipeline.IgnoreVendor {
+			logger.Debugf("using the vendored source")
+			f.source.Resolved = vendored.Resolved
+			f.source.Dir = filepath.Join(c.Config.Paths.Cwd, VendorDir, key)
+		} else {
+			f.source.Dir, f.source.Resolved, f.diags = c.fetchRemoteSource(detected, pwd, key, subject)
+			if f.diags.HasErrors() {
+				f.source.Dir = ""
+				return
+			}
+		}
+		f.diags = f.diags.Extend(c.verifySource(f.source, subject))
+	})
+	return f.source.Dir, f.diags
+}
+
+// fetchRemoteSource fetches the remote source detected to the cache of the user, see cache.SourcesDir,
+// and returns the directory of its copy and the source pinned to its commit. The copy in the cache
+// is used instead if it is fresh, see cache.Entry.Fresh, unless the lock file is upgraded, or if
+// the source cannot be fetched, like when the network is not available. The source is locked while
+// it is fetched, so that the pipelines which run in parallel do not fetch it over each other, and
+// the copy is fetched to a new directory, named after the commit it resolved to, instead of
+// replacing the copy the other pipelines use. The run holds a shared lock on the copy until it
+// ends, so that it is not pruned, see cache.PruneSources
+func (c *Conductor) fetchRemoteSource(detected string, pwd string, key string, subject *hcl.Range) (string, string, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	logger := c.Logger().WithField("source", detected)
+	dir := cache.SourcesDir()
+	fail := func(err error) (string, string, hcl.Diagnostics) {
+		return "", "", diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "failed to download source",
+			Detail:   err.Error(),
+			Subject:  subject,
+		})
+	}
+	if err := os.MkdirAll(cache.ContentDir(dir), 0755); err != nil {
+		return fail(err)
+	}
+	unlock, err := cache.Lock(dir, key)
+	if err != nil {
+		return fail(err)
+	}
+	defer unlock()
+
+	entry, err := cache.ReadEntry(dir, key)
+	if err != nil {
+		logger.Warnf("failed to read the copy of the source in the cache: %s", err)
+		entry = nil
+	}
+	hold := func(content string) error {
+		release, err := cache.RLock(cache.ContentDir(dir), content)
+		if err != nil {
+			return err
+		}
+		c.sources.hold(release)
+		return nil
+	}
+	use := func() (string, string, hcl.Diagnostics) {
+		entry.UsedAt = time.Now()
+		entry.Pipeline = c.RootParent().Config.Paths.Pipeline
+		if err := cache.WriteEntry(dir, entry); err != nil {
+			logger.Warnf("failed to update the copy of the source in the cache: %s", err)
+		}
+		return entry.Dir(dir), entry.Resolved, diags
+	}
+	if entry != nil && entry.Fresh(c.Config.Pipeline.SourcesTTL) && !c.Config.Pipeline.Upgrade {
+		logger.Debugf("using the copy in the cache, fetched at %s", entry.FetchedAt)
+		if err := hold(entry.Content); err != nil {
+			return fail(err)
+		}
+		return use()
+	}
+
+	tmp, err := cache.TmpDir(dir, key)
+	if err == nil {
+		get := &getter.Client{Ctx: c.Context(), Src: detected, Dst: tmp, Pwd: pwd, Dir: true}
+		err = get.Get()
+	}
+	var hash string
+	if err == nil {
+		hash, err = lockfile.HashDir(tmp)
+	}
+	if err != nil {
+		_ = os.RemoveAll(tmp)
+		if entry != nil {
+			logger.Warnf("failed to fetch the source, using the copy in the cache: %s", err)
+			if err := hold(entry.Content); err != nil {
+				return fail(err)
+			}
+			return use()
+		}
+		return fail(err)
+	}
+
+	resolved := lockfile.Resolve(detected, tmp)
+	entry = &cache.Entry{
+		Key:       key,
+		Content:   cache.ContentKey(resolved, hash),
+		Source:    detected,
+		Resolved:  resolved,
+		Immutable: cache.Immutable(detected, tmp),
+		FetchedAt: time.Now(),
+	}
+	if err := hold(entry.Content); err != nil {
+		_ = os.RemoveAll(tmp)
+		return fail(err)
+	}
+	if err := cache.Store(dir, tmp, entry.Content); err != nil {
+		_ = os.RemoveAll(tmp)
+		return fail(err)
+	}
+	return use()
+}
+
+// FetchSources fetches the remote sources of the imports and the modules of the pipeline, and
+// of the pipelines of the modules, see fetchSource. The sources of the modules which refer to
+// other blocks are only known when the pipeline runs, and are fetched then
+func FetchSources(conductor *Conductor, pipe *Pipeline) hcl.Diagnostics {
+	pipe, diags := ExpandImports(conductor, pipe, conductor.Config.Paths)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	for _, m := range pipe.Modules {
+		source, d := m.Source.Value(nil)
+		if d.HasErrors() || source.IsNull() || source.Type() != cty.String {
+			diags = diags.Append(&hcl.Diagnostic{
+				Severity: hcl.DiagWarning,
+				Summary:  "Module source not fetched",
+				Detail:   fmt.Sprintf("The source of module %s refers to other blocks, it is fetched when the pipeline runs.", m.Id),
+				Subject:  m.Source.Range().Ptr(),
+			})
+			continue
+		}
+
+		dir, d := conductor.fetchSource(source.AsString(), conductor.Config.Paths.Module, filepath.Join(conductor.TempDir(), "modules", m.Id), m.Source.Range().Ptr())
+		diags = diags.Extend(d)
+		if d.HasErrors() {
+			continue
+		}
+
+		// the modules of the module, like Module.run, the paths are those of the parent
+		childCfg := conductor.Config
+		childCfg.Paths = &path.Path{
+			Pipeline: filepath.Join(dir, meta.ConfigFileName),
+			Owd:      conductor.Config.Paths.Owd,
+			Cwd:      conductor.Config.Paths.Cwd,
+			Module:   dir,
+		}
+		childConductor := conductor.Child(ConductorWithConfig(childCfg), ConductorWithParser(conductor.Parser))
+		childPipe, d := ReadDirFromPath(childConductor, dir)
+		diags = diags.Extend(d)
+		if d.HasErrors() {
+			continue
+		}
+		diags = diags.Extend(FetchSources(childConductor, childPipe))
+	}
+	return diags
+}
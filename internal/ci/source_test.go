@@ -0,0 +1,109 @@
+package ci
+
+import (
+	"encoding/json"
+	"github.com/srevinsaju/togomak/v1/internal/behavior"
+	"github.com/srevinsaju/togomak/v1/internal/cache"
+	"github.com/srevinsaju/togomak/v1/internal/lockfile"
+	"github.com/srevinsaju/togomak/v1/internal/path"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestConductor_FetchSource(t *testing.T) {
+	owd, err := os.Getwd()
+	assert.NoError(t, err)
+	defer os.Chdir(owd)
+
+	dir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(dir, "cache"))
+	src := "git::file:///nonexistent/remote?ref=main"
+	vendored := RemoteSource{Source: src, Resolved: "git::file:///nonexistent/remote?ref=d5f6b19"}
+
+	key := vendored.Key()
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, VendorDir, key), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, VendorDir, key, "togomak.hcl"), []byte("togomak {}"), 0644))
+	data, err := json.Marshal(VendorManifest{key: vendored})
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, VendorDir, VendorManifestFileName), data, 0644))
+
+	cfg := ConductorConfig{
+		Paths:     &path.Path{Pipeline: filepath.Join(dir, "togomak.hcl"), Cwd: dir},
+		Interface: Interface{JSONLogging: true, Verbosity: -1},
+		Behavior:  behavior.NewDefaultBehavior(),
+	}
+	lock := lockfile.New(filepath.Join(dir, "togomak.lock.hcl"))
+	conductor := NewConductor(cfg, ConductorWithLock(lock))
+	defer conductor.Destroy()
+
+	// the vendored sources are not fetched
+	fetched, diags := conductor.fetchSource(src, dir, filepath.Join(dir, "local"), nil)
+	assert.False(t, diags.HasErrors(), diags.Error())
+	assert.Equal(t, filepath.Join(dir, VendorDir, key), fetched)
+	assert.Len(t, conductor.FetchedSources(), 1)
+	assert.Equal(t, vendored.Resolved, lock.Sources()[0].Resolved)
+
+	// the modules share the fetched sources
+	child := conductor.Child()
+	fetched, diags = child.fetchSource(src, dir, filepath.Join(dir, "local"), nil)
+	assert.False(t, diags.HasErrors(), diags.Error())
+	assert.Equal(t, filepath.Join(dir, VendorDir, key), fetched)
+
+	cfg.Pipeline.IgnoreVendor = true
+	conductor = NewConductor(cfg)
+	defer conductor.Destroy()
+	_, diags = conductor.fetchSource(src, dir, filepath.Join(dir, "local"), nil)
+	assert.True(t, diags.HasErrors())
+	assert.Empty(t, conductor.FetchedSources())
+}
+
+func TestConductor_FetchRemoteSource(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(dir, "cache"))
+	repo := filepath.Join(dir, "repo")
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", repo, "-c", "user.name=togomak", "-c", "user.email=togomak@example.com"}, args...)...)
+		out, err := cmd.CombinedOutput()
+		assert.NoError(t, err, string(out))
+	}
+	commit := func(content string) {
+		assert.NoError(t, os.WriteFile(filepath.Join(repo, "togomak.hcl"), []byte(content), 0644))
+		git("add", "togomak.hcl")
+		git("commit", "-q", "-m", content)
+	}
+	assert.NoError(t, os.MkdirAll(repo, 0755))
+	git("init", "-q", "-b", "main")
+	commit("v1")
+
+	src := "git::file://" + repo + "?ref=main"
+	// the sources which may move are fetched again on every run, without a ttl
+	cfg := ConductorConfig{}
+	first := newTestConductor(cfg)
+	fetched, resolved, diags := first.fetchRemoteSource(src, dir, cache.Key(src), nil)
+	assert.False(t, diags.HasErrors(), diags.Error())
+	assert.NotEqual(t, src, resolved)
+
+	// the branch moved, it is fetched to another copy, and the copy of the first run is not replaced
+	commit("v2")
+	second := newTestConductor(cfg)
+	refetched, _, diags := second.fetchRemoteSource(src, dir, cache.Key(src), nil)
+	assert.False(t, diags.HasErrors(), diags.Error())
+	assert.NotEqual(t, fetched, refetched)
+	data, err := os.ReadFile(filepath.Join(fetched, "togomak.hcl"))
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", string(data))
+
+	// the copy of the first run is not pruned until the run ends
+	_, err = cache.PruneSources(cache.SourcesDir(), 0, 1)
+	assert.NoError(t, err)
+	assert.DirExists(t, fetched)
+	first.Destroy()
+	_, err = cache.PruneSources(cache.SourcesDir(), 0, 1)
+	assert.NoError(t, err)
+	assert.NoDirExists(t, fetched)
+	assert.DirExists(t, refetched)
+	second.Destroy()
+}
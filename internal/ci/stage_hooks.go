@@ -3,7 +3,10 @@ package ci
 import (
 	"fmt"
 	"github.com/hashicorp/hcl/v2"
+	"github.com/srevinsaju/togomak/v1/internal/blocks"
+	"github.com/srevinsaju/togomak/v1/internal/profile"
 	"github.com/srevinsaju/togomak/v1/internal/runnable"
+	"github.com/srevinsaju/togomak/v1/internal/x"
 )
 
 func (s *Stage) BeforeRun(conductor *Conductor, opts ...runnable.Option) hcl.Diagnostics {
@@ -14,9 +17,11 @@ func (s *Stage) BeforeRun(conductor *Conductor, opts ...runnable.Option) hcl.Dia
 	}
 	var diags hcl.Diagnostics
 
+	span := conductor.Profiler().Start(profile.CategoryHook, x.RenderBlock(blocks.StageBlock, s.Id), "pre hooks")
+	defer span.End()
 	for _, hook := range s.PreHook {
 		diags = diags.Extend(
-			(&Stage{fmt.Sprintf("%s.pre", s.Id), nil, hook.Stage, nil}).Run(conductor, opts...),
+			(&Stage{Id: fmt.Sprintf("%s.pre", s.Id), CoreStage: hook.Stage}).Run(conductor, opts...),
 		)
 	}
 	return diags
@@ -30,9 +35,11 @@ func (s *Stage) AfterRun(conductor *Conductor, opts ...runnable.Option) hcl.Diag
 	}
 	var diags hcl.Diagnostics
 
+	span := conductor.Profiler().Start(profile.CategoryHook, x.RenderBlock(blocks.StageBlock, s.Id), "post hooks")
+	defer span.End()
 	for _, hook := range s.PostHook {
 		diags = diags.Extend(
-			(&Stage{fmt.Sprintf("%s.post", s.Id), nil, hook.Stage, nil}).Run(conductor, opts...),
+			(&Stage{Id: fmt.Sprintf("%s.post", s.Id), CoreStage: hook.Stage}).Run(conductor, opts...),
 		)
 	}
 	return diags
@@ -0,0 +1,298 @@
+package ci
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/sirupsen/logrus"
+	"github.com/srevinsaju/togomak/v1/internal/logging"
+	"github.com/srevinsaju/togomak/v1/internal/ui"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OutputMode is how the output of the stages is written, while they run in parallel
+type OutputMode string
+
+const (
+	// OutputModeAuto groups the output in CI, when the CI provider supports folding,
+	// and streams it otherwise
+	OutputModeAuto OutputMode = ""
+
+	// OutputModeStream logs each line of the output as the stage writes it, the lines of
+	// the stages which run in parallel are interleaved
+	OutputModeStream OutputMode = "stream"
+
+	// OutputModePrefix writes each line of the output as the stage writes it,
+	// prefixed with the address of the stage
+	OutputModePrefix OutputMode = "prefix"
+
+	// OutputModeGroup buffers the output of each stage, and writes it as a
+	// contiguous block when the stage finishes
+	OutputModeGroup OutputMode = "group"
+)
+
+// OutputModes are the output modes accepted by --output
+var OutputModes = []OutputMode{OutputModeStream, OutputModePrefix, OutputModeGroup}
+
+// ParseOutputMode parses the value of --output, an empty value is OutputModeAuto
+func ParseOutputMode(s string) (OutputMode, hcl.Diagnostics) {
+	if s == "" || s == "auto" {
+		return OutputModeAuto, nil
+	}
+	var names []string
+	for _, mode := range OutputModes {
+		if string(mode) == s {
+			return mode, nil
+		}
+		names = append(names, string(mode))
+	}
+	return OutputModeAuto, hcl.Diagnostics{{
+		Severity: hcl.DiagError,
+		Summary:  "invalid output mode",
+		Detail:   fmt.Sprintf("%q is not an output mode, expected one of auto, %s", s, strings.Join(names, ", ")),
+	}}
+}
+
+// Folding is the syntax of a CI provider to fold a group of lines in its logs
+type Folding struct {
+	// Name is the name of the CI provider
+	Name string
+
+	// Start returns the line which starts a group with the given id and title
+	Start func(id string, title string, now time.Time) string
+
+	// End returns the line which ends the group with the given id
+	End func(id string, now time.Time) string
+}
+
+var gitlabSectionName = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+
+var teamcityEscaper = strings.NewReplacer("|", "||", "'", "|'", "\n", "|n", "\r", "|r", "[", "|[", "]", "|]")
+
+var (
+	githubFolding = &Folding{
+		Name: "github",
+		Start: func(id string, title string, now time.Time) string {
+			return fmt.Sprintf("::group::%s", title)
+		},
+		End: func(id string, now time.Time) string {
+			return "::endgroup::"
+		},
+	}
+	gitlabFolding = &Folding{
+		Name: "gitlab",
+		Start: func(id string, title string, now time.Time) string {
+			name := gitlabSectionName.ReplaceAllString(id, "_")
+			return fmt.Sprintf("\x1b[0Ksection_start:%d:%s[collapsed=true]\r\x1b[0K%s", now.Unix(), name, title)
+		},
+		End: func(id string, now time.Time) string {
+			name := gitlabSectionName.ReplaceAllString(id, "_")
+			return fmt.Sprintf("\x1b[0Ksection_end:%d:%s\r\x1b[0K", now.Unix(), name)
+		},
+	}
+	teamcityFolding = &Folding{
+		Name: "teamcity",
+		Start: func(id string, title string, now time.Time) string {
+			return fmt.Sprintf("##teamcity[blockOpened name='%s']", teamcityEscaper.Replace(title))
+		},
+		End: func(id string, now time.Time) string {
+			return fmt.Sprintf("##teamcity[blockClosed name='%s']", teamcityEscaper.Replace(id))
+		},
+	}
+	azureFolding = &Folding{
+		Name: "azure",
+		Start: func(id string, title string, now time.Time) string {
+			return fmt.Sprintf("##[group]%s", title)
+		},
+		End: func(id string, now time.Time) string {
+			return "##[endgroup]"
+		},
+	}
+)
+
+// DetectFolding returns the folding syntax of the CI provider detected from the
+// environment variables, or nil if the provider is unknown
+func DetectFolding(getenv func(string) string) *Folding {
+	switch {
+	case getenv("GITHUB_ACTIONS") == "true":
+		return githubFolding
+	case getenv("GITLAB_CI") == "true":
+		return gitlabFolding
+	case getenv("TEAMCITY_VERSION") != "":
+		return teamcityFolding
+	case strings.EqualFold(getenv("TF_BUILD"), "true"):
+		return azureFolding
+	}
+	return nil
+}
+
+// folding returns the folding syntax of the CI provider, if togomak runs in CI
+func (c *Conductor) folding() *Folding {
+	if c.Config.Behavior == nil || !c.Config.Behavior.Ci {
+		return nil
+	}
+	return DetectFolding(os.Getenv)
+}
+
+// OutputMode returns the output mode of the stages, resolving OutputModeAuto
+func (c *Conductor) OutputMode() OutputMode {
+	cfg := c.Config
+	if cfg.Interface.JSONLogging {
+		return OutputModeStream
+	}
+	// a child process is run by a stage of the parent process, which
+	// decides how the output of the child process is written
+	if cfg.Behavior != nil && cfg.Behavior.Child.Enabled && c.parent == nil {
+		return OutputModeStream
+	}
+	if cfg.Interface.QuietSuccess {
+		return OutputModeGroup
+	}
+	if cfg.Interface.Output == OutputModeAuto {
+		if c.folding() != nil {
+			return OutputModeGroup
+		}
+		return OutputModeStream
+	}
+	return cfg.Interface.Output
+}
+
+// output returns the writer where the grouped and prefixed output of the stages is
+// written, and the mutex which keeps the blocks of output of the stages contiguous.
+// The modules share the writer of the root conductor
+func (c *Conductor) output() (io.Writer, *sync.Mutex) {
+	root := c.RootParent()
+	if root.out != nil {
+		return root.out, &root.outMu
+	}
+	if root.Config.Logging.Stderr {
+		return os.Stderr, &root.outMu
+	}
+	return os.Stdout, &root.outMu
+}
+
+// StageOutput returns the writer of the output of the stage with the given address, according
+// to the OutputMode, and the function which must be called when the stage finishes.
+// The output is also recorded in the log of the run, see runlog.Recorder
+func (c *Conductor) StageOutput(logger *logrus.Entry, id string) (io.Writer, func(failed bool)) {
+	w, finish := c.stageOutput(logger, id)
+	// the output streamed through the logger is already sent to the log sinks
+	if sinks := logging.SinkWriter(logger); sinks != nil && c.OutputMode() != OutputModeStream {
+		w = io.MultiWriter(w, sinks)
+		finishOutput := finish
+		finish = func(failed bool) {
+			finishOutput(failed)
+			_ = sinks.Close()
+		}
+	}
+	file, err := c.runLog.Stage(id)
+	if err != nil {
+		logger.Warnf("failed to record the output of %s: %s", id, err)
+	}
+	if file == nil {
+		return w, finish
+	}
+	return io.MultiWriter(w, file), func(failed bool) {
+		finish(failed)
+		if err := file.Close(); err != nil {
+			logger.Warnf("failed to record the output of %s: %s", id, err)
+		}
+		if err := c.runLog.Finish(id, failed); err != nil {
+			logger.Warnf("failed to record the status of %s: %s", id, err)
+		}
+	}
+}
+
+func (c *Conductor) stageOutput(logger *logrus.Entry, id string) (io.Writer, func(failed bool)) {
+	switch c.OutputMode() {
+	case OutputModePrefix:
+		out, mu := c.output()
+		w := &prefixWriter{prefix: ui.Grey(id + " | "), out: out, mu: mu}
+		return w, func(failed bool) { w.flush() }
+	case OutputModeGroup:
+		w := &OutputStream{}
+		return w, func(failed bool) {
+			if failed || !c.Config.Interface.QuietSuccess {
+				c.writeGroup(id, w.String(), failed)
+			}
+		}
+	}
+	return logger.Writer(), func(failed bool) {}
+}
+
+// writeGroup writes the output of a stage as a contiguous block, folded by the CI provider
+func (c *Conductor) writeGroup(id string, output string, failed bool) {
+	if output == "" {
+		return
+	}
+	if !strings.HasSuffix(output, "\n") {
+		output += "\n"
+	}
+	title := id
+	if failed {
+		title = fmt.Sprintf("%s (failed)", id)
+	}
+
+	out, mu := c.output()
+	mu.Lock()
+	defer mu.Unlock()
+
+	folding := c.folding()
+	if folding == nil {
+		fmt.Fprintln(out, ui.Grey("── ")+ui.Bold(title))
+		fmt.Fprint(out, output)
+		return
+	}
+	fmt.Fprintln(out, folding.Start(id, title, time.Now()))
+	fmt.Fprint(out, output)
+	fmt.Fprintln(out, folding.End(id, time.Now()))
+}
+
+// prefixWriter writes each complete line prefixed, so that the lines of the stages
+// which run in parallel are not mixed
+type prefixWriter struct {
+	prefix string
+	out    io.Writer
+	mu     *sync.Mutex
+
+	bufMu sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.bufMu.Lock()
+	defer w.bufMu.Unlock()
+	w.buf.Write(p)
+	for {
+		i := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if i < 0 {
+			break
+		}
+		w.writeLine(w.buf.Next(i + 1))
+	}
+	return len(p), nil
+}
+
+func (w *prefixWriter) writeLine(line []byte) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	fmt.Fprint(w.out, w.prefix)
+	_, _ = w.out.Write(line)
+}
+
+// flush writes the last line, if it does not end with a newline
+func (w *prefixWriter) flush() {
+	w.bufMu.Lock()
+	defer w.bufMu.Unlock()
+	if w.buf.Len() == 0 {
+		return
+	}
+	line := append(w.buf.Bytes(), '\n')
+	w.buf.Reset()
+	w.writeLine(line)
+}
@@ -0,0 +1,82 @@
+package ci
+
+import (
+	"bytes"
+	"github.com/acarl005/stripansi"
+	"github.com/srevinsaju/togomak/v1/internal/behavior"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestDetectFolding(t *testing.T) {
+	env := func(vars map[string]string) func(string) string {
+		return func(name string) string { return vars[name] }
+	}
+	assert.Nil(t, DetectFolding(env(nil)))
+	assert.Equal(t, "github", DetectFolding(env(map[string]string{"GITHUB_ACTIONS": "true"})).Name)
+	assert.Equal(t, "gitlab", DetectFolding(env(map[string]string{"GITLAB_CI": "true"})).Name)
+	assert.Equal(t, "teamcity", DetectFolding(env(map[string]string{"TEAMCITY_VERSION": "2023.05"})).Name)
+	assert.Equal(t, "azure", DetectFolding(env(map[string]string{"TF_BUILD": "True"})).Name)
+
+	now := time.Unix(1700000000, 0)
+	assert.Equal(t, "::group::stage.build", githubFolding.Start("stage.build", "stage.build", now))
+	assert.Equal(t, "\x1b[0Ksection_start:1700000000:stage.build_0_[collapsed=true]\r\x1b[0Kstage.build[0]",
+		gitlabFolding.Start("stage.build[0]", "stage.build[0]", now))
+	assert.Equal(t, "##teamcity[blockClosed name='stage.build|[0|]']", teamcityFolding.End("stage.build[0]", now))
+}
+
+func TestParseOutputMode(t *testing.T) {
+	mode, diags := ParseOutputMode("auto")
+	assert.False(t, diags.HasErrors())
+	assert.Equal(t, OutputModeAuto, mode)
+
+	mode, diags = ParseOutputMode("prefix")
+	assert.False(t, diags.HasErrors())
+	assert.Equal(t, OutputModePrefix, mode)
+
+	_, diags = ParseOutputMode("lines")
+	assert.True(t, diags.HasErrors())
+}
+
+func TestConductor_StageOutput(t *testing.T) {
+	var out bytes.Buffer
+	conductor := &Conductor{
+		Config: ConductorConfig{
+			Interface: Interface{Output: OutputModePrefix},
+			Behavior:  &behavior.Behavior{},
+		},
+		out: &out,
+	}
+
+	w, finish := conductor.StageOutput(nil, "stage.build")
+	_, _ = w.Write([]byte("compiling\nlin"))
+	_, _ = w.Write([]byte("king\ndone"))
+	finish(false)
+	assert.Equal(t, "stage.build | compiling\nstage.build | linking\nstage.build | done\n", stripansi.Strip(out.String()))
+
+	out.Reset()
+	conductor.Config.Interface = Interface{Output: OutputModeGroup}
+	build, finishBuild := conductor.StageOutput(nil, "stage.build")
+	test, finishTest := conductor.StageOutput(nil, "stage.test")
+	_, _ = build.Write([]byte("compiling\n"))
+	_, _ = test.Write([]byte("testing\n"))
+	_, _ = build.Write([]byte("done"))
+	finishTest(true)
+	finishBuild(false)
+	assert.Equal(t, "── stage.test (failed)\ntesting\n── stage.build\ncompiling\ndone\n", stripansi.Strip(out.String()))
+
+	out.Reset()
+	conductor.Config.Interface = Interface{QuietSuccess: true}
+	assert.Equal(t, OutputModeGroup, conductor.OutputMode())
+	build, finishBuild = conductor.StageOutput(nil, "stage.build")
+	test, finishTest = conductor.StageOutput(nil, "stage.test")
+	_, _ = build.Write([]byte("compiling\n"))
+	_, _ = test.Write([]byte("testing\n"))
+	finishBuild(false)
+	finishTest(true)
+	assert.Equal(t, "── stage.test (failed)\ntesting\n", stripansi.Strip(out.String()))
+
+	conductor.Config.Interface = Interface{QuietSuccess: true, JSONLogging: true}
+	assert.Equal(t, OutputModeStream, conductor.OutputMode())
+}
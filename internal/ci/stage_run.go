@@ -1,7 +1,6 @@
 package ci
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -18,9 +17,10 @@ import (
 	"github.com/google/uuid"
 	"github.com/hashicorp/hcl/v2"
 	"github.com/imdario/mergo"
-	"github.com/sirupsen/logrus"
 	"github.com/srevinsaju/togomak/v1/internal/c"
 	"github.com/srevinsaju/togomak/v1/internal/meta"
+	"github.com/srevinsaju/togomak/v1/internal/metrics"
+	"github.com/srevinsaju/togomak/v1/internal/profile"
 	"github.com/srevinsaju/togomak/v1/internal/runnable"
 	"github.com/srevinsaju/togomak/v1/internal/ui"
 	"github.com/zclconf/go-cty/cty"
@@ -30,6 +30,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 )
 
 const TogomakParamEnvVarPrefix = "TOGOMAK__param__"
@@ -46,6 +47,9 @@ func (s *Stage) Prepare(conductor *Conductor, skip bool, overridden bool) hcl.Di
 		id = ""
 	} else {
 		id = fmt.Sprintf("%s", ui.Grey("skipped"))
+		if conductor.Unchanged(x.RenderBlock(s.Type(), s.Id)) {
+			id = fmt.Sprintf("%s", ui.Grey("skipped, unchanged"))
+		}
 	}
 	if overridden {
 		id = fmt.Sprintf("%s", ui.Blue("overridden"))
@@ -71,6 +75,8 @@ func (s *Stage) expandMacros(conductor *Conductor, opts ...runnable.Option) (*St
 	tmpDir := conductor.TempDir()
 
 	logger.Debugf("running %s.%s", s.Identifier(), blocks.MacroBlock)
+	span := conductor.Profiler().Start(profile.CategoryMacro, x.RenderBlock(blocks.StageBlock, s.Id), "expand macro")
+	defer span.End()
 
 	var diags hcl.Diagnostics
 	var err error
@@ -91,6 +97,7 @@ func (s *Stage) expandMacros(conductor *Conductor, opts ...runnable.Option) (*St
 		conductor.Eval().Mutex().RLock()
 		source, d := s.Use.Macro.Value(hclContext)
 		conductor.Eval().Mutex().RUnlock()
+		source = conductor.unmark(source)
 
 		if d.HasErrors() {
 			return s, diags.Extend(d)
@@ -128,6 +135,7 @@ func (s *Stage) expandMacros(conductor *Conductor, opts ...runnable.Option) (*St
 	conductor.Eval().Mutex().RLock()
 	chdirRaw, d := s.Use.Chdir.Value(hclContext)
 	conductor.Eval().Mutex().RUnlock()
+	chdirRaw = conductor.unmark(chdirRaw)
 	if d.HasErrors() {
 		return s, diags.Extend(d)
 	}
@@ -152,6 +160,7 @@ func (s *Stage) expandMacros(conductor *Conductor, opts ...runnable.Option) (*St
 		conductor.Eval().Mutex().RLock()
 		stageDir, d := s.Dir.Value(hclContext)
 		conductor.Eval().Mutex().RUnlock()
+		stageDir = conductor.unmark(stageDir)
 		if d.HasErrors() {
 			return s, diags.Extend(d)
 		}
@@ -218,6 +227,7 @@ func (s *Stage) expandMacros(conductor *Conductor, opts ...runnable.Option) (*St
 		conductor.Eval().Mutex().RLock()
 		f, d := macro.Files.Value(hclContext)
 		conductor.Eval().Mutex().RUnlock()
+		f = conductor.unmark(f)
 		if d.HasErrors() {
 			return s, diags.Extend(d)
 		}
@@ -354,6 +364,7 @@ func (s *Stage) Run(conductor *Conductor, options ...runnable.Option) (diags hcl
 	conductor.Eval().Mutex().RLock()
 	forEachItems, d := s.ForEach.Value(evalCtx)
 	conductor.Eval().Mutex().RUnlock()
+	forEachItems = conductor.unmark(forEachItems)
 
 	diags = diags.Extend(d)
 	if d.HasErrors() {
@@ -416,11 +427,16 @@ func (s *Stage) run(conductor *Conductor, evalCtx *hcl.EvalContext, options ...r
 	status := runnable.StatusRunning
 	cfg := runnable.NewConfig(options...)
 	stream := conductor.NewOutputMemoryStream(s.String())
+	output, finish := conductor.StageOutput(logger, s.String())
+	redacted := conductor.Redactions().Writer(io.MultiWriter(output, stream))
 	diags := &dg.Diagnostics{}
+	s.conductor = conductor
 
-	defer func(stream *bytes.Buffer) {
+	defer func(stream *OutputStream) {
 		logger.Debug("running post hooks")
 		success := !diags.HasErrors()
+		_ = redacted.Close()
+		finish(!success)
 		if !success {
 			status = runnable.StatusFailure
 		} else {
@@ -440,6 +456,72 @@ func (s *Stage) run(conductor *Conductor, evalCtx *hcl.EvalContext, options ...r
 	d := s.executePreHooks(conductor, status, options...)
 	diags.Extend(d)
 
+	evalCtx, paramsGo, d := s.evalContext(conductor, evalCtx, cfg)
+	diags.Extend(d)
+
+	environment, d := s.parseEnvironmentVariables(conductor, evalCtx)
+	diags.Extend(d)
+	if diags.HasErrors() {
+		return diags.Diagnostics()
+	}
+
+	envStrings := s.processEnvironmentVariables(conductor, environment, cfg, tmpDir, paramsGo)
+
+	cmd, d := s.parseExecCommand(conductor, evalCtx, cfg, redacted)
+	diags.Extend(d)
+	if diags.HasErrors() {
+		return diags.Diagnostics()
+	}
+	logger.Trace("command parsed")
+	logger.Tracef("script: %.30s... ", cmd.String())
+
+	if s.Container == nil {
+		cmd.Env = append(os.Environ(), envStrings...)
+		s.process = cmd
+		logger.Tracef("running command: %.30s...", cmd.String())
+		if !cfg.Behavior.DryRun {
+			span := conductor.Profiler().Start(profile.CategoryScript, x.RenderBlock(blocks.StageBlock, s.Id), "script")
+			err = cmd.Run()
+			if cmd.ProcessState != nil {
+				span.SetArg("exit_code", cmd.ProcessState.ExitCode())
+			}
+			span.End()
+
+			if err != nil && err.Error() == "signal: terminated" && s.Terminated() {
+				logger.Warnf("command terminated with signal: %s", cmd.ProcessState.String())
+				err = nil
+			}
+			if err != nil && errors.Is(context.Cause(conductor.Context()), ErrWatchIterationStopped) {
+				// the run was stopped by togomak watch, and the process was killed with it
+				logger.Warnf("command stopped: %s", ErrWatchIterationStopped)
+				err = nil
+			}
+		} else {
+			fmt.Println(conductor.Redactions().Redact(cmd.String()))
+		}
+	} else {
+		cmd.Env = envStrings
+		d := s.executeDocker(conductor, evalCtx, cmd, cfg)
+		diags.Extend(d)
+	}
+
+	if err != nil {
+		diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf("failed to run command (%s)", s.Identifier()),
+			Detail:   err.Error(),
+		})
+	}
+
+	return diags.Diagnostics()
+}
+
+// evalContext creates the evaluation context the attributes of the stage are evaluated in,
+// which includes this, each and the parameters passed to the macro. The parameters are
+// also returned, as they are forwarded to the stage as environment variables
+func (s *Stage) evalContext(conductor *Conductor, evalCtx *hcl.EvalContext, cfg *runnable.Config) (*hcl.EvalContext, map[string]cty.Value, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	logger := conductor.Logger().WithField("stage", s.Id)
 	paramsGo := map[string]cty.Value{}
 
 	logger.Debugf("expanding global macro parameters")
@@ -481,7 +563,8 @@ func (s *Stage) run(conductor *Conductor, evalCtx *hcl.EvalContext, options ...r
 		conductor.Eval().Mutex().RLock()
 		parameters, d := s.Use.Parameters.Value(evalCtx)
 		conductor.Eval().Mutex().RUnlock()
-		diags.Extend(d)
+		parameters = conductor.unmark(parameters)
+		diags = diags.Extend(d)
 		if !parameters.IsNull() {
 			for k, v := range parameters.AsValueMap() {
 				paramsGo[k] = v
@@ -489,52 +572,45 @@ func (s *Stage) run(conductor *Conductor, evalCtx *hcl.EvalContext, options ...r
 		}
 	}
 	evalCtx.Variables[blocks.ParamBlock] = cty.ObjectVal(paramsGo)
+	return evalCtx, paramsGo, diags
+}
 
-	environment, d := s.parseEnvironmentVariables(conductor, evalCtx)
-	diags.Extend(d)
-	if diags.HasErrors() {
-		return diags.Diagnostics()
-	}
-
-	envStrings := s.processEnvironmentVariables(conductor, environment, cfg, tmpDir, paramsGo)
+const (
+	// ContainerLabelRun is the label of the containers of the stages with the id of their run
+	ContainerLabelRun = "togomak.run"
 
-	cmd, d := s.parseExecCommand(conductor, evalCtx, cfg, stream)
-	diags.Extend(d)
-	if diags.HasErrors() {
-		return diags.Diagnostics()
-	}
-	logger.Trace("command parsed")
-	logger.Tracef("script: %.30s... ", cmd.String())
+	// ContainerLabelRunDir is the label of the containers of the stages with the directory
+	// of their run, see runlog.Recorder.Dir. It is empty if the run is not recorded
+	ContainerLabelRunDir = "togomak.run.dir"
 
-	if s.Container == nil {
-		cmd.Env = append(os.Environ(), envStrings...)
-		s.process = cmd
-		logger.Tracef("running command: %.30s...", cmd.String())
-		if !cfg.Behavior.DryRun {
-			err = cmd.Run()
+	// ContainerLabelStage is the label of the containers of the stages with the stage
+	ContainerLabelStage = "togomak.stage"
+)
 
-			if err != nil && err.Error() == "signal: terminated" && s.Terminated() {
-				logger.Warnf("command terminated with signal: %s", cmd.ProcessState.String())
-				err = nil
-			}
-		} else {
-			fmt.Println(cmd.String())
-		}
-	} else {
-		cmd.Env = envStrings
-		d := s.executeDocker(conductor, evalCtx, cmd, cfg)
-		diags.Extend(d)
+// copyContainerLogs copies the logs of a container to stdout and stderr, which are the writers
+// of the stage, so that the output of the container is redacted and recorded like the output
+// of a script. The logs of a container with a tty are not multiplexed, and are copied to stdout
+func copyContainerLogs(stdout io.Writer, stderr io.Writer, tty bool, logs io.Reader) error {
+	if tty {
+		_, err := io.Copy(stdout, logs)
+		return err
 	}
+	_, err := stdcopy.StdCopy(stdout, stderr, logs)
+	return err
+}
 
-	if err != nil {
-		diags.Append(&hcl.Diagnostic{
-			Severity: hcl.DiagError,
-			Summary:  fmt.Sprintf("failed to run command (%s)", s.Identifier()),
-			Detail:   err.Error(),
-		})
+// containerLabels returns the labels of the container of the stage, so that the containers
+// left behind by a run which was killed can be found, see ContainerLabelRun
+func (s *Stage) containerLabels(conductor *Conductor) map[string]string {
+	runId := conductor.RunLog().Id()
+	if runId == "" {
+		runId = conductor.RootParent().Process.Id.String()
+	}
+	return map[string]string{
+		ContainerLabelRun:    runId,
+		ContainerLabelRunDir: conductor.RunLog().Dir(),
+		ContainerLabelStage:  x.RenderBlock(blocks.StageBlock, s.Id),
 	}
-
-	return diags.Diagnostics()
 }
 
 func (s *Stage) executeDocker(conductor *Conductor, evalCtx *hcl.EvalContext, cmd *exec.Cmd, cfg *runnable.Config) hcl.Diagnostics {
@@ -542,6 +618,7 @@ func (s *Stage) executeDocker(conductor *Conductor, evalCtx *hcl.EvalContext, cm
 	logger := conductor.Logger().WithField("stage", s.Id)
 
 	ctx := conductor.Context()
+	track := x.RenderBlock(blocks.StageBlock, s.Id)
 
 	image, d := s.hclImage(conductor, evalCtx)
 	diags = diags.Extend(d)
@@ -569,10 +646,14 @@ func (s *Stage) executeDocker(conductor *Conductor, evalCtx *hcl.EvalContext, cm
 	// check if image exists
 	logger.Debugf("checking if image %s exists", image)
 	_, _, err = cli.ImageInspectWithRaw(ctx, image)
+	conductor.Metrics().Cache(metrics.CacheImage, err == nil)
 	if err != nil {
 		logger.Infof("image %s does not exist, pulling...", image)
+		pullStart := time.Now()
+		span := conductor.Profiler().Start(profile.CategoryContainer, track, "container pull").SetArg("image", image)
 		reader, err := cli.ImagePull(ctx, image, types.ImagePullOptions{})
 		if err != nil {
+			span.End()
 			return diags.Append(&hcl.Diagnostic{
 				Severity:    hcl.DiagError,
 				Summary:     "could not pull image",
@@ -586,6 +667,8 @@ func (s *Stage) executeDocker(conductor *Conductor, evalCtx *hcl.EvalContext, cm
 		defer pb.Close()
 		defer reader.Close()
 		io.Copy(pb, reader)
+		span.End()
+		conductor.Metrics().ContainerPull(image, time.Since(pullStart))
 	}
 
 	logger.Trace("parsing container arguments")
@@ -599,11 +682,13 @@ func (s *Stage) executeDocker(conductor *Conductor, evalCtx *hcl.EvalContext, cm
 		conductor.Eval().Mutex().RLock()
 		source, d := m.Source.Value(evalCtx)
 		conductor.Eval().Mutex().RUnlock()
+		source = conductor.unmark(source)
 		diags = diags.Extend(d)
 
 		conductor.Eval().Mutex().RLock()
 		dest, d := m.Destination.Value(evalCtx)
 		conductor.Eval().Mutex().RUnlock()
+		dest = conductor.unmark(dest)
 		diags = diags.Extend(d)
 		if diags.HasErrors() {
 			continue
@@ -617,11 +702,11 @@ func (s *Stage) executeDocker(conductor *Conductor, evalCtx *hcl.EvalContext, cm
 
 	logger.Trace("dry run check")
 	if cfg.Behavior.DryRun {
-		fmt.Println(ui.Blue("# docker:run.image"), ui.Green(image))
+		fmt.Println(ui.Blue("# docker:run.image"), ui.Green(conductor.Redactions().Redact(image)))
 		fmt.Println(ui.Blue("# docker:run.workdir"), ui.Green("/workspace"))
 		fmt.Println(ui.Blue("# docker:run.volume"), ui.Green(cmd.Dir+":/workspace"))
 		fmt.Println(ui.Blue("# docker:run.stdin"), ui.Green(s.Container.Stdin))
-		fmt.Println(ui.Blue("# docker:run.args"), ui.Green(cmd.String()))
+		fmt.Println(ui.Blue("# docker:run.args"), ui.Green(conductor.Redactions().Redact(cmd.String())))
 		return diags
 	}
 
@@ -633,6 +718,7 @@ func (s *Stage) executeDocker(conductor *Conductor, evalCtx *hcl.EvalContext, cm
 	}
 
 	logger.Trace("creating container")
+	span := conductor.Profiler().Start(profile.CategoryContainer, track, "container create").SetArg("image", image)
 	resp, err := cli.ContainerCreate(conductor.Context(), &dockerContainer.Config{
 		Image:        image,
 		WorkingDir:   "/workspace",
@@ -646,11 +732,13 @@ func (s *Stage) executeDocker(conductor *Conductor, evalCtx *hcl.EvalContext, cm
 		Entrypoint:   entrypoint,
 		Env:          cmd.Env,
 		ExposedPorts: exposedPorts,
+		Labels:       s.containerLabels(conductor),
 		// User: s.Container.User,
 	}, &dockerContainer.HostConfig{
 		Binds:        binds,
 		PortBindings: bindings,
 	}, nil, nil, "")
+	span.End()
 	if err != nil {
 		return diags.Append(&hcl.Diagnostic{
 			Severity:    hcl.DiagError,
@@ -662,7 +750,10 @@ func (s *Stage) executeDocker(conductor *Conductor, evalCtx *hcl.EvalContext, cm
 	}
 
 	logger.Trace("starting container")
-	if err := cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
+	span = conductor.Profiler().Start(profile.CategoryContainer, track, "container start").SetArg("image", image)
+	err = cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{})
+	span.End()
+	if err != nil {
 		return diags.Append(&hcl.Diagnostic{
 			Severity: hcl.DiagError,
 			Summary:  "could not start container",
@@ -679,6 +770,8 @@ func (s *Stage) executeDocker(conductor *Conductor, evalCtx *hcl.EvalContext, cm
 	}
 
 	logger.Trace("getting container logs")
+	span = conductor.Profiler().Start(profile.CategoryScript, track, "script").SetArg("container", resp.ID)
+	defer span.End()
 	responseBody, err := cli.ContainerLogs(ctx, resp.ID, types.ContainerLogsOptions{
 		ShowStdout: true, ShowStderr: true,
 		Follow: true,
@@ -694,11 +787,7 @@ func (s *Stage) executeDocker(conductor *Conductor, evalCtx *hcl.EvalContext, cm
 	defer responseBody.Close()
 
 	logger.Tracef("copying container logs on container: %s", resp.ID)
-	if container.Config.Tty {
-		_, err = io.Copy(logger.Writer(), responseBody)
-	} else {
-		_, err = stdcopy.StdCopy(logger.Writer(), logger.WriterLevel(logrus.WarnLevel), responseBody)
-	}
+	err = copyContainerLogs(cmd.Stdout, cmd.Stderr, container.Config.Tty, responseBody)
 
 	logger.Trace("waiting for container to finish")
 	if err != nil && err != io.EOF {
@@ -741,6 +830,7 @@ func (s *Stage) parseEnvironmentVariables(conductor *Conductor, evalCtx *hcl.Eva
 		conductor.Eval().Mutex().RLock()
 		v, d := env.Value.Value(evalCtx)
 		conductor.Eval().Mutex().RUnlock()
+		v = conductor.unmark(v)
 
 		diags = diags.Extend(d)
 		if v.IsNull() {
@@ -766,7 +856,7 @@ func (s *Stage) parseEnvironmentVariables(conductor *Conductor, evalCtx *hcl.Eva
 	return environment, diags
 }
 
-func (s *Stage) parseExecCommand(conductor *Conductor, evalCtx *hcl.EvalContext, cfg *runnable.Config, outputBuffer io.Writer) (*exec.Cmd, hcl.Diagnostics) {
+func (s *Stage) parseExecCommand(conductor *Conductor, evalCtx *hcl.EvalContext, cfg *runnable.Config, output io.Writer) (*exec.Cmd, hcl.Diagnostics) {
 	var diags hcl.Diagnostics
 	logger := conductor.Logger().WithField("stage", s.Id)
 
@@ -774,6 +864,7 @@ func (s *Stage) parseExecCommand(conductor *Conductor, evalCtx *hcl.EvalContext,
 	conductor.Eval().Mutex().RLock()
 	script, d := s.Script.Value(evalCtx)
 	conductor.Eval().Mutex().RUnlock()
+	script = conductor.unmark(script)
 
 	if d.HasErrors() && cfg.Behavior.DryRun {
 		script = cty.StringVal(ui.Italic(ui.Yellow("(will be evaluated later)")))
@@ -785,6 +876,7 @@ func (s *Stage) parseExecCommand(conductor *Conductor, evalCtx *hcl.EvalContext,
 	conductor.Eval().Mutex().RLock()
 	shellRaw, d := s.Shell.Value(evalCtx)
 	conductor.Eval().Mutex().RUnlock()
+	shellRaw = conductor.unmark(shellRaw)
 
 	shell := ""
 	if d.HasErrors() {
@@ -801,6 +893,7 @@ func (s *Stage) parseExecCommand(conductor *Conductor, evalCtx *hcl.EvalContext,
 	conductor.Eval().Mutex().RLock()
 	args, d := s.Args.Value(evalCtx)
 	conductor.Eval().Mutex().RUnlock()
+	args = conductor.unmark(args)
 	diags = diags.Extend(d)
 
 	cmdHcl, d := s.parseCommand(evalCtx, shell, script, args)
@@ -814,6 +907,7 @@ func (s *Stage) parseExecCommand(conductor *Conductor, evalCtx *hcl.EvalContext,
 	conductor.Eval().Mutex().RLock()
 	dirParsed, d := s.Dir.Value(evalCtx)
 	conductor.Eval().Mutex().RUnlock()
+	dirParsed = conductor.unmark(dirParsed)
 
 	if d.HasErrors() {
 		diags = diags.Extend(d)
@@ -825,13 +919,13 @@ func (s *Stage) parseExecCommand(conductor *Conductor, evalCtx *hcl.EvalContext,
 			dir = filepath.Join(cfg.Paths.Cwd, dir)
 		}
 		if cfg.Behavior.DryRun {
-			fmt.Println(ui.Blue("cd"), dir)
+			fmt.Println(ui.Blue("cd"), conductor.Redactions().Redact(dir))
 		}
 	}
 
 	cmd := exec.CommandContext(conductor.Context(), cmdHcl.command, cmdHcl.args...)
-	cmd.Stdout = io.MultiWriter(logger.Writer(), outputBuffer)
-	cmd.Stderr = io.MultiWriter(logger.Writer(), outputBuffer)
+	cmd.Stdout = output
+	cmd.Stderr = output
 	cmd.Dir = dir
 	return cmd, diags
 }
@@ -902,7 +996,7 @@ func (s *Stage) processEnvironmentVariables(conductor *Conductor, environment ma
 	for k, v := range environment {
 		envParsed := fmt.Sprintf("%s=%s", k, v.AsString())
 		if cfg.Behavior.DryRun {
-			fmt.Println(ui.Blue("export"), envParsed)
+			fmt.Println(ui.Blue("export"), conductor.Redactions().Redact(envParsed))
 		}
 
 		envStrings[envCounter] = envParsed
@@ -912,11 +1006,20 @@ func (s *Stage) processEnvironmentVariables(conductor *Conductor, environment ma
 	logger.Tracef("exporting %s", togomakEnvExport)
 	envStrings = append(envStrings, togomakEnvExport)
 
+	// the togomak processes run by the stage join its trace
+	envStrings = append(envStrings, conductor.Profiler().Environ(s.String())...)
+	if trace := conductor.Config.Pipeline.Trace; trace.Endpoint != "" {
+		envStrings = append(envStrings, fmt.Sprintf("TOGOMAK_OTEL_ENDPOINT=%s", trace.Endpoint))
+		if trace.Protocol != "" {
+			envStrings = append(envStrings, fmt.Sprintf("TOGOMAK_OTEL_PROTOCOL=%s", trace.Protocol))
+		}
+	}
+
 	if s.Use != nil && s.Use.Parameters != nil {
 		for k, v := range paramsGo {
 			envParsed := fmt.Sprintf("%s%s=%s", TogomakParamEnvVarPrefix, k, v.AsString())
 			if cfg.Behavior.DryRun {
-				fmt.Println(ui.Blue("export"), envParsed)
+				fmt.Println(ui.Blue("export"), conductor.Redactions().Redact(envParsed))
 			}
 
 			envStrings = append(envStrings, envParsed)
@@ -944,6 +1047,7 @@ func (s *Stage) hclImage(conductor *Conductor, evalCtx *hcl.EvalContext) (image
 	conductor.Eval().Mutex().RLock()
 	imageRaw, d := s.Container.Image.Value(evalCtx)
 	conductor.Eval().Mutex().RUnlock()
+	imageRaw = conductor.unmark(imageRaw)
 
 	if d.HasErrors() {
 		diags = diags.Extend(d)
@@ -967,6 +1071,7 @@ func (s *Stage) hclEndpoint(conductor *Conductor, evalCtx *hcl.EvalContext) ([]s
 	conductor.Eval().Mutex().RLock()
 	entrypointRaw, d := s.Container.Entrypoint.Value(evalCtx)
 	conductor.Eval().Mutex().RUnlock()
+	entrypointRaw = conductor.unmark(entrypointRaw)
 
 	var entrypoint []string
 
@@ -1028,6 +1133,7 @@ func (s *Stage) CanRun(conductor *Conductor, options ...runnable.Option) (ok boo
 		conductor.Eval().Mutex().RLock()
 		parameters, d := s.Use.Parameters.Value(evalCtx)
 		conductor.Eval().Mutex().RUnlock()
+		parameters = conductor.unmark(parameters)
 
 		diags = diags.Extend(d)
 		if !parameters.IsNull() {
@@ -1040,6 +1146,7 @@ func (s *Stage) CanRun(conductor *Conductor, options ...runnable.Option) (ok boo
 	conductor.Eval().Mutex().RLock()
 	v, d := s.Condition.Value(evalCtx)
 	conductor.Eval().Mutex().RUnlock()
+	v = conductor.unmark(v)
 	if d.HasErrors() {
 		return false, diags.Extend(d)
 	}
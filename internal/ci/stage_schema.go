@@ -131,8 +131,20 @@ type StagePreHook struct {
 // scripts, docker containers, etc. A Stage receives all properties as that of CoreStage
 // along with an Id which is used by Stages to uniquely identify a stage.
 type Stage struct {
-	Id        string         `hcl:"id,label" json:"id" expr:"id"`
-	ForEach   hcl.Expression `hcl:"for_each,optional" json:"for_each"`
+	Id      string         `hcl:"id,label" json:"id" expr:"id"`
+	ForEach hcl.Expression `hcl:"for_each,optional" json:"for_each"`
+
+	// Watch accepts a list of glob patterns, relative to the working directory, of the files
+	// the stage depends on. togomak watch reruns the stage, and the stages which depend on it,
+	// when a matching file changes. A "**" segment matches any number of directories, and
+	// patterns without a "/" match the name of the file in any directory
+	Watch hcl.Expression `hcl:"watch,optional" json:"watch"`
+
+	// Paths accepts a list of glob patterns, in the same format as Watch, of the files the
+	// stage builds. When togomak runs with --changed-since, the stage is skipped unless one
+	// of the changed files matches, or a stage it depends on runs because of a change
+	Paths hcl.Expression `hcl:"paths,optional" json:"paths"`
+
 	CoreStage `hcl:",remain"`
 
 	// Lifecycle rules tell the termination policy of a daemon stage
@@ -211,6 +223,7 @@ type CoreStage struct {
 	PostHook []*StagePostHook `hcl:"post_hook,block" json:"post_hook"`
 
 	process                 *exec.Cmd
+	conductor               *Conductor
 	macroWhitelistedStages  []string
 	dependsOnVariablesMacro []hcl.Traversal
 	ContainerId             string
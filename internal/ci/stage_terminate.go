@@ -12,6 +12,15 @@ import (
 )
 
 func (s *Stage) Terminate(conductor *Conductor, safe bool) hcl.Diagnostics {
+	// the handlers terminate the stages without a conductor, the
+	// stage is terminated with the conductor it was run with
+	if conductor == nil {
+		conductor = s.conductor
+	}
+	if conductor == nil {
+		// the stage was never run
+		return nil
+	}
 	logger := conductor.Logger().WithField("stage", s.Id)
 	logger.Debug("terminating stage")
 	ctx := context.Background()
@@ -1,7 +1,11 @@
 package ci
 
 import (
+	"bytes"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/srevinsaju/togomak/v1/internal/third-party/hashicorp/terraform/lang/marks"
 	"github.com/stretchr/testify/assert"
+	"github.com/zclconf/go-cty/cty"
 	"testing"
 )
 
@@ -20,3 +24,23 @@ func TestStage_Get(t *testing.T) {
 	stage := Stage{}
 	assert.Equal(t, stage.Get("key"), nil)
 }
+
+func TestCopyContainerLogs(t *testing.T) {
+	r := &Redactions{}
+	r.AddValue(cty.StringVal("s3cr3t").Mark(marks.Sensitive))
+
+	// the stderr of the container is written to the writers of the stage, like its stdout
+	var logs, out bytes.Buffer
+	_, _ = stdcopy.NewStdWriter(&logs, stdcopy.Stdout).Write([]byte("stdout s3cr3t\n"))
+	_, _ = stdcopy.NewStdWriter(&logs, stdcopy.Stderr).Write([]byte("stderr s3cr3t\n"))
+	w := r.Writer(&out)
+	assert.NoError(t, copyContainerLogs(w, w, false, &logs))
+	assert.NoError(t, w.Close())
+	assert.Equal(t, "stdout (sensitive value)\nstderr (sensitive value)\n", out.String())
+
+	out.Reset()
+	w = r.Writer(&out)
+	assert.NoError(t, copyContainerLogs(w, w, true, bytes.NewBufferString("tty s3cr3t\n")))
+	assert.NoError(t, w.Close())
+	assert.Equal(t, "tty (sensitive value)\n", out.String())
+}
@@ -0,0 +1,320 @@
+package ci
+
+import (
+	"fmt"
+	"github.com/hashicorp/go-getter"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/typeexpr"
+	dataBlock "github.com/srevinsaju/togomak/v1/internal/blocks/data"
+	"github.com/srevinsaju/togomak/v1/internal/logging"
+	"github.com/srevinsaju/togomak/v1/internal/x"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"net/url"
+	"strings"
+)
+
+// exprIsSet reports if an optional attribute was specified in the configuration.
+// gohcl substitutes missing hcl.Expression attributes with a static null expression
+func exprIsSet(expr hcl.Expression) bool {
+	if expr == nil {
+		return false
+	}
+	v, d := expr.Value(nil)
+	return d.HasErrors() || !v.IsNull()
+}
+
+// validateConstant evaluates expr if it does not reference any other block, and
+// checks if the value is convertible to ty. Expressions which reference other blocks
+// can only be checked at runtime, and are ignored
+func validateConstant(conductor *Conductor, expr hcl.Expression, ty cty.Type, name string) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	if !exprIsSet(expr) || len(expr.Variables()) != 0 {
+		return diags
+	}
+
+	conductor.Eval().Mutex().RLock()
+	v, d := expr.Value(conductor.Eval().Context())
+	conductor.Eval().Mutex().RUnlock()
+	diags = diags.Extend(d)
+	if d.HasErrors() || v.IsNull() || !v.IsWhollyKnown() {
+		return diags
+	}
+
+	_, err := convert.Convert(v, ty)
+	if err != nil {
+		diags = diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Incorrect attribute value type",
+			Detail:   fmt.Sprintf("Inappropriate value for attribute %q: %s.", name, err.Error()),
+			Subject:  expr.Range().Ptr(),
+		})
+	}
+	return diags
+}
+
+func (s *Lifecycle) validate(conductor *Conductor) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	diags = diags.Extend(validateConstant(conductor, s.Timeout, cty.Number, "timeout"))
+	diags = diags.Extend(validateConstant(conductor, s.Phase, cty.List(cty.String), "phase"))
+	if diags.HasErrors() || !exprIsSet(s.Phase) || len(s.Phase.Variables()) != 0 {
+		return diags
+	}
+
+	conductor.Eval().Mutex().RLock()
+	phases, _ := s.Phase.Value(conductor.Eval().Context())
+	conductor.Eval().Mutex().RUnlock()
+	phases, err := convert.Convert(phases, cty.List(cty.String))
+	if err != nil || phases.IsNull() || !phases.IsWhollyKnown() {
+		return diags
+	}
+
+	var known []string
+	for _, ly := range Lifecycles {
+		known = append(known, ly.String())
+	}
+	for _, phase := range phases.AsValueSlice() {
+		if _, ok := LifecycleUnmarshall(phase.AsString()); ok {
+			continue
+		}
+		diags = diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagWarning,
+			Summary:  "Unknown lifecycle phase",
+			Detail: fmt.Sprintf("%q is not one of the standard lifecycle phases (%s), it will only run when requested explicitly.",
+				phase.AsString(), strings.Join(known, ", ")),
+			Subject: s.Phase.Range().Ptr(),
+		})
+	}
+	return diags
+}
+
+func (s *CoreStage) validate(conductor *Conductor) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	if exprIsSet(s.Script) && exprIsSet(s.Args) {
+		diags = diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Conflicting configuration arguments",
+			Detail:   "script and args are mutually exclusive, only one of them can be specified.",
+			Subject:  s.Args.Range().Ptr(),
+		})
+	}
+
+	diags = diags.Extend(validateConstant(conductor, s.Condition, cty.Bool, "if"))
+	diags = diags.Extend(validateConstant(conductor, s.Script, cty.String, "script"))
+	diags = diags.Extend(validateConstant(conductor, s.Shell, cty.String, "shell"))
+	diags = diags.Extend(validateConstant(conductor, s.Args, cty.List(cty.String), "args"))
+	diags = diags.Extend(validateConstant(conductor, s.Dir, cty.String, "dir"))
+
+	for _, env := range s.Environment {
+		diags = diags.Extend(validateConstant(conductor, env.Value, cty.String, "value"))
+	}
+	if s.Use != nil {
+		diags = diags.Extend(validateConstant(conductor, s.Use.Chdir, cty.Bool, "chdir"))
+	}
+	if s.Container != nil {
+		diags = diags.Extend(validateConstant(conductor, s.Container.Image, cty.String, "image"))
+		diags = diags.Extend(validateConstant(conductor, s.Container.Entrypoint, cty.List(cty.String), "entrypoint"))
+	}
+	for _, hook := range s.PreHook {
+		diags = diags.Extend(hook.Stage.validate(conductor))
+	}
+	for _, hook := range s.PostHook {
+		diags = diags.Extend(hook.Stage.validate(conductor))
+	}
+	return diags
+}
+
+func (s *Stage) validate(conductor *Conductor) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	diags = diags.Extend(s.CoreStage.validate(conductor))
+	diags = diags.Extend(validateConstant(conductor, s.Watch, cty.List(cty.String), "watch"))
+	diags = diags.Extend(validateConstant(conductor, s.Paths, cty.List(cty.String), "paths"))
+	if s.Lifecycle != nil {
+		diags = diags.Extend(s.Lifecycle.validate(conductor))
+	}
+	return diags
+}
+
+func (m *Module) validate(conductor *Conductor) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	diags = diags.Extend(validateConstant(conductor, m.Source, cty.String, "source"))
+	diags = diags.Extend(validateConstant(conductor, m.Condition, cty.Bool, "if"))
+	diags = diags.Extend(validateConstant(conductor, m.Paths, cty.List(cty.String), "paths"))
+	if m.Lifecycle != nil {
+		diags = diags.Extend(m.Lifecycle.validate(conductor))
+	}
+	return diags
+}
+
+func (s *Data) validate() hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	provider := dataBlock.DefaultProviders.Get(s.Provider)
+	if provider == nil {
+		return diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Unknown data provider",
+			Detail:   fmt.Sprintf("%s is not a data provider, built-in providers are %s", s.Provider, dataBlock.DefaultProviders),
+			Subject:  s.Body.MissingItemRange().Ptr(),
+		})
+	}
+	_, d := s.Body.Content(provider.Schema())
+	return diags.Extend(d)
+}
+
+func (v *Variable) validate(conductor *Conductor) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	ty := cty.DynamicPseudoType
+	if exprIsSet(v.Ty) {
+		t, _, d := typeexpr.TypeConstraintWithDefaults(v.Ty)
+		diags = diags.Extend(d)
+		if d.HasErrors() {
+			return diags
+		}
+		ty = t
+	}
+	diags = diags.Extend(validateConstant(conductor, v.Default, ty, "default"))
+	for _, validation := range v.Validations {
+		diags = diags.Extend(validateConstant(conductor, validation.Condition, cty.Bool, "condition"))
+		diags = diags.Extend(validateConstant(conductor, validation.ErrorMessage, cty.String, "error_message"))
+	}
+	return diags
+}
+
+func (l *Local) validate(conductor *Conductor) hcl.Diagnostics {
+	return validateConstant(conductor, l.Value, cty.DynamicPseudoType, l.Key)
+}
+
+func (o *Output) validate(conductor *Conductor) hcl.Diagnostics {
+	return validateConstant(conductor, o.Value, cty.DynamicPseudoType, "value")
+}
+
+func (s *LoggingSink) validate() hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	for _, name := range logging.SinkNames() {
+		if name == s.Name {
+			attrs, d := s.Body.JustAttributes()
+			diags = diags.Extend(d)
+			return diags.Extend(sinkReferences(attrs))
+		}
+	}
+	return diags.Append(&hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  "Unknown logging sink",
+		Detail:   fmt.Sprintf("%s is not a logging sink, the sinks are %s", s.Name, strings.Join(logging.SinkNames(), ", ")),
+		Subject:  s.Body.MissingItemRange().Ptr(),
+	})
+}
+
+// Validate statically checks the schema of the blocks, and the constant expressions in the
+// pipeline, without running anything. It is expected that the imports and the locals are
+// expanded before Validate is called. References and dependency cycles are checked by GraphTopoSort.
+func (pipe *Pipeline) Validate(conductor *Conductor) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	for _, stage := range pipe.Stages {
+		diags = diags.Extend(stage.validate(conductor))
+	}
+	if pipe.Pre != nil {
+		diags = diags.Extend(pipe.Pre.CoreStage.validate(conductor))
+	}
+	if pipe.Post != nil {
+		diags = diags.Extend(pipe.Post.CoreStage.validate(conductor))
+	}
+	for _, macro := range pipe.Macros {
+		if macro.Stage != nil {
+			diags = diags.Extend(macro.Stage.validate(conductor))
+		}
+	}
+	for _, module := range pipe.Modules {
+		diags = diags.Extend(module.validate(conductor))
+	}
+	for _, data := range pipe.Data {
+		diags = diags.Extend(data.validate())
+	}
+	for _, variable := range pipe.Vars {
+		diags = diags.Extend(variable.validate(conductor))
+	}
+	for _, local := range pipe.Local {
+		diags = diags.Extend(local.validate(conductor))
+	}
+	for _, output := range pipe.Outputs {
+		diags = diags.Extend(output.validate(conductor))
+	}
+	if pipe.Builder.Logging != nil {
+		for _, sink := range pipe.Builder.Logging.Sinks {
+			diags = diags.Extend(sink.validate())
+		}
+	}
+	return diags
+}
+
+// localImportPath returns the path of the import on the local filesystem, and
+// false if the import needs to be fetched from a remote source
+func localImportPath(src string, pwd string) (string, bool) {
+	detected, err := getter.Detect(src, pwd, getter.Detectors)
+	if err != nil || !strings.HasPrefix(detected, "file://") {
+		return "", false
+	}
+	u, err := url.Parse(detected)
+	if err != nil {
+		return "", false
+	}
+	return u.Path, true
+}
+
+// ExpandLocalImports is similar to ExpandImports, but reads the imports available on the local
+// filesystem in place, and does not fetch remote imports. It is used by validate, which should not
+// access the network.
+func ExpandLocalImports(conductor *Conductor, pipe *Pipeline, pwd string) (*Pipeline, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	if len(pipe.Imports) == 0 {
+		return pipe, diags
+	}
+
+	d := pipe.Imports.PopulateProperties(conductor)
+	diags = diags.Extend(d)
+	if d.HasErrors() {
+		return pipe, diags
+	}
+
+	var pipes MetaList
+	pipes = pipes.Append(NewMeta(pipe, nil, "memory"))
+	for _, im := range pipe.Imports {
+		dir, ok := localImportPath(im.Identifier(), pwd)
+		if !ok {
+			diags = diags.Append(&hcl.Diagnostic{
+				Severity: hcl.DiagWarning,
+				Summary:  "Remote import not validated",
+				Detail:   fmt.Sprintf("%s is not available locally, and was not fetched. References to blocks in this import may be reported as undefined.", im.Identifier()),
+				Subject:  im.Source.Range().Ptr(),
+			})
+			continue
+		}
+		if !x.IsDir(dir) {
+			diags = diags.Append(&hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "import failed",
+				Detail:   fmt.Sprintf("%s does not exist, or is not a directory", dir),
+				Subject:  im.Source.Range().Ptr(),
+			})
+			continue
+		}
+
+		p, d := ReadDirFromPath(conductor, dir)
+		diags = diags.Extend(d)
+		if d.HasErrors() {
+			continue
+		}
+		p, d = ExpandLocalImports(conductor, p, dir)
+		diags = diags.Extend(d)
+		pipes = pipes.Append(NewMeta(p, nil, im.Identifier()))
+	}
+
+	p, d := Merge(pipes)
+	diags = diags.Extend(d)
+	if d.HasErrors() {
+		return pipe, diags
+	}
+	return p, diags
+}
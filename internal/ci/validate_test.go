@@ -0,0 +1,72 @@
+package ci
+
+import (
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func validatePipeline(t *testing.T, src string) hcl.Diagnostics {
+	conductor := newTestConductor(ConductorConfig{})
+	pipe := &Pipeline{}
+	decodeConfig(t, "togomak {\n  version = 2\n}\n"+src, pipe)
+	locals, diags := pipe.Locals.Expand()
+	pipe.Local = locals
+	diags = diags.Extend(pipe.Validate(conductor))
+	_, d := GraphTopoSort(conductor, pipe)
+	return diags.Extend(d)
+}
+
+func TestPipeline_Validate(t *testing.T) {
+	diags := validatePipeline(t, `
+stage "build" {
+  script = "make"
+}
+stage "test" {
+  depends_on = [stage.build]
+  script = "make test"
+  lifecycle {
+    phase = ["test"]
+  }
+}
+`)
+	assert.Empty(t, diags)
+}
+
+func TestPipeline_ValidateErrors(t *testing.T) {
+	diags := validatePipeline(t, `
+data "unknown" "x" {}
+stage "build" {
+  script = "make"
+  args = ["make"]
+}
+stage "test" {
+  if = "yes"
+  depends_on = [stage.missing]
+  script = "make test"
+  lifecycle {
+    phase = ["custom"]
+  }
+}
+`)
+	summaries := diagSummaries(diags)
+	assert.Contains(t, summaries, "Conflicting configuration arguments")
+	assert.Contains(t, summaries, "Incorrect attribute value type")
+	assert.Contains(t, summaries, "Unknown data provider")
+	assert.Contains(t, summaries, "Stage not found")
+	assert.Contains(t, summaries, "Unknown lifecycle phase")
+}
+
+func TestPipeline_ValidateCycle(t *testing.T) {
+	diags := validatePipeline(t, `
+stage "a" {
+  depends_on = [stage.b]
+  script = "true"
+}
+stage "b" {
+  depends_on = [stage.a]
+  script = "true"
+}
+`)
+	assert.Contains(t, diagSummaries(diags), "Invalid dependency")
+}
@@ -0,0 +1,113 @@
+package ci
+
+import (
+	"fmt"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/srevinsaju/togomak/v1/internal/parse"
+	"github.com/zclconf/go-cty/cty"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// VarFileExtension is the extension of the variable files in the HCL syntax. The
+	// variable files in the JSON syntax have the .json extension
+	VarFileExtension = ".togomakvars"
+
+	// AutoVarFileSuffix is the suffix of the variable files next to the pipeline which
+	// are read without being passed with --var-file
+	AutoVarFileSuffix = ".auto" + VarFileExtension
+)
+
+// readVarFile reads the values of the variables set in the variable file at path. The
+// values are typed, and cannot reference other blocks or call functions
+func readVarFile(parser *Parser, path string) (map[string]*hcl.Attribute, map[string]cty.Value, hcl.Diagnostics) {
+	var f *hcl.File
+	var diags hcl.Diagnostics
+	if _, err := os.Stat(path); err != nil {
+		return nil, nil, diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Failed to read variable file",
+			Detail:   fmt.Sprintf("The variable file %s could not be read: %s", path, err),
+		})
+	}
+	if strings.HasSuffix(path, ".json") {
+		f, diags = parser.ParseJSONFile(path)
+	} else {
+		f, diags = parser.ParseHCLFile(path)
+	}
+	if diags.HasErrors() {
+		return nil, nil, diags
+	}
+
+	attrs, d := f.Body.JustAttributes()
+	diags = diags.Extend(d)
+	values := make(map[string]cty.Value, len(attrs))
+	for name, attr := range attrs {
+		v, d := attr.Expr.Value(nil)
+		diags = diags.Extend(d)
+		if !d.HasErrors() {
+			values[name] = v
+		}
+	}
+	return attrs, values, diags
+}
+
+// autoVarFiles returns the *.auto.togomakvars and *.auto.togomakvars.json files in dir, in lexical order
+func autoVarFiles(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !(strings.HasSuffix(name, AutoVarFileSuffix) || strings.HasSuffix(name, AutoVarFileSuffix+".json")) {
+			continue
+		}
+		files = append(files, filepath.Join(dir, name))
+	}
+	sort.Strings(files)
+	return files
+}
+
+// ReadVarFiles reads the values of the variables from the variable files next to the pipeline,
+// see AutoVarFileSuffix, and then from the files passed with --var-file, in order. The values of
+// the files which are read later override the values of the files read before them.
+//
+// A variable is resolved from, in order of precedence: the TOGOMAK_VAR_<name> environment
+// variable, the variable files, the --var flags, and its default value
+func ReadVarFiles(conductor *Conductor, pipe *Pipeline) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	files := autoVarFiles(parse.ConfigFileDir(conductor.Config.Paths))
+	files = append(files, conductor.Config.VarFiles...)
+	if len(files) == 0 {
+		return diags
+	}
+
+	declared := make(map[string]bool)
+	for _, v := range pipe.Vars {
+		declared[v.Id] = true
+	}
+	values := make(map[string]cty.Value)
+	for _, path := range files {
+		attrs, v, d := readVarFile(conductor.Parser, path)
+		diags = diags.Extend(d)
+		for name, value := range v {
+			values[name] = value
+			if declared[name] {
+				continue
+			}
+			diags = diags.Append(&hcl.Diagnostic{
+				Severity: hcl.DiagWarning,
+				Summary:  "Value for undeclared variable",
+				Detail:   fmt.Sprintf("The variable file sets a value for %s, which is not declared by a variable block.", name),
+				Subject:  attrs[name].NameRange.Ptr(),
+			})
+		}
+	}
+	conductor.Update(ConductorWithVarFileValues(values))
+	return diags
+}
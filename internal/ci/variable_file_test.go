@@ -0,0 +1,77 @@
+package ci
+
+import (
+	"github.com/hashicorp/hcl/v2"
+	"github.com/srevinsaju/togomak/v1/internal/path"
+	"github.com/stretchr/testify/assert"
+	"github.com/zclconf/go-cty/cty"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const deployVariables = `
+togomak {
+  version = 2
+}
+variable "environment" {
+  type = string
+}
+variable "replicas" {
+  type = number
+}
+variable "regions" {
+  type = list(string)
+}
+`
+
+func TestReadVarFiles(t *testing.T) {
+	owd, err := os.Getwd()
+	assert.NoError(t, err)
+	defer os.Chdir(owd)
+
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		p := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(p, []byte(content), 0644))
+		return p
+	}
+	write("togomak.hcl", deployVariables)
+	write("a.auto.togomakvars", "environment = \"dev\"\nreplicas = 1\n")
+	write("b.auto.togomakvars.json", `{"regions": ["us-east1"]}`)
+	write("ignored.togomakvars", `environment = "ignored"`)
+	prod := write("prod.togomakvars", "replicas = 3\nteam = \"platform\"\n")
+
+	pipe := &Pipeline{}
+	decodeConfig(t, deployVariables, pipe)
+
+	cli, _ := ParseVariableShell("environment=staging")
+	conductor := newTestConductor(ConductorConfig{
+		Paths:     &path.Path{Pipeline: filepath.Join(dir, "togomak.hcl"), Cwd: dir},
+		Variables: Variables{cli},
+		VarFiles:  []string{prod},
+	})
+	diags := ReadVarFiles(conductor, pipe)
+	assert.Len(t, diags, 1)
+	assert.Equal(t, "Value for undeclared variable", diags[0].Summary)
+	assert.Equal(t, hcl.DiagWarning, diags[0].Severity)
+
+	// the variable files take precedence over --var
+	value, diags := pipe.Vars[0].resolveVarTypedWithDefaults(conductor)
+	assert.Empty(t, diags)
+	assert.Equal(t, cty.StringVal("dev"), value)
+
+	// the files passed with --var-file override the auto-loaded files
+	value, diags = pipe.Vars[1].resolveVarTypedWithDefaults(conductor)
+	assert.Empty(t, diags)
+	assert.True(t, value.RawEquals(cty.NumberIntVal(3)), value.GoString())
+
+	value, diags = pipe.Vars[2].resolveVarTypedWithDefaults(conductor)
+	assert.Empty(t, diags)
+	assert.Equal(t, cty.ListVal([]cty.Value{cty.StringVal("us-east1")}), value)
+
+	conductor.Config.VarFiles = []string{filepath.Join(dir, "missing.togomakvars")}
+	diags = ReadVarFiles(conductor, pipe)
+	assert.True(t, diags.HasErrors())
+	assert.Equal(t, "Failed to read variable file", diags[0].Summary)
+}
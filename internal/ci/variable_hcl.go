@@ -1,10 +1,34 @@
 package ci
 
-import "github.com/hashicorp/hcl/v2"
+import (
+	"github.com/hashicorp/hcl/v2"
+	"github.com/srevinsaju/togomak/v1/internal/blocks"
+)
 
 func (v *Variable) Variables() []hcl.Traversal {
 	var traversal []hcl.Traversal
 	traversal = append(traversal, v.Value.Variables()...)
+
+	// the validations reference the variable itself, which is not a dependency
+	for _, validation := range v.Validations {
+		for _, expr := range []hcl.Expression{validation.Condition, validation.ErrorMessage} {
+			for _, t := range expr.Variables() {
+				if v.isSelf(t) {
+					continue
+				}
+				traversal = append(traversal, t)
+			}
+		}
+	}
 	return traversal
 
 }
+
+// isSelf reports if t references the variable v
+func (v *Variable) isSelf(t hcl.Traversal) bool {
+	if t.RootName() != blocks.VarBlock || len(t) < 2 {
+		return false
+	}
+	attr, ok := t[1].(hcl.TraverseAttr)
+	return ok && attr.Name == v.Id
+}
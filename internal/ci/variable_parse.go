@@ -3,10 +3,14 @@ package ci
 import (
 	"fmt"
 	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
 	"github.com/zclconf/go-cty/cty"
 	"strings"
 )
 
+// ParseVariableShell parses a variable set with --var, like key=value. The value is raw
+// text, which is parsed as an HCL expression if the type of the variable is not a
+// primitive type, see parseVariableValue
 func ParseVariableShell(raw string) (*Variable, hcl.Diagnostics) {
 	var diags hcl.Diagnostics
 	eq := strings.Index(raw, "=")
@@ -31,6 +35,24 @@ func ParseVariableShell(raw string) (*Variable, hcl.Diagnostics) {
 	return &Variable{
 		Id:    name,
 		Value: hcl.StaticExpr(cty.StringVal(rawVal), hcl.Range{}),
+		shell: true,
 	}, diags
 
 }
+
+// parseVariableValue parses the raw text value of the variable id, set with --var, TOGOMAK_VAR_<id>
+// or the prompt. Like Terraform, the values of variables with a primitive type, or without a type,
+// are used as strings, and the values of the other variables, like list(string), are parsed as
+// HCL expressions, like ["linux", "darwin"]
+func parseVariableValue(id string, raw string, ty cty.Type) (cty.Value, hcl.Diagnostics) {
+	if ty.IsPrimitiveType() || ty == cty.DynamicPseudoType {
+		return cty.StringVal(raw), nil
+	}
+	filename := fmt.Sprintf("<value for var.%s>", id)
+	expr, diags := hclsyntax.ParseExpression([]byte(raw), filename, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return cty.NilVal, diags
+	}
+	// the values set on the command line cannot reference other values or call functions
+	return expr.Value(nil)
+}
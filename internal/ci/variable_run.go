@@ -9,6 +9,7 @@ import (
 	"github.com/srevinsaju/togomak/v1/internal/blocks"
 	"github.com/srevinsaju/togomak/v1/internal/global"
 	"github.com/srevinsaju/togomak/v1/internal/runnable"
+	"github.com/srevinsaju/togomak/v1/internal/third-party/hashicorp/terraform/lang/marks"
 	"github.com/zclconf/go-cty/cty"
 	"github.com/zclconf/go-cty/cty/convert"
 	"os"
@@ -18,18 +19,23 @@ func (v *Variable) Prepare(conductor *Conductor, skip bool, overridden bool) hcl
 	return nil // no-op
 }
 
-func (v *Variable) resolveVar(conductor *Conductor) (cty.Value, hcl.Diagnostics) {
+// resolveVar returns the value of the variable, and if the value is raw text which still
+// needs to be parsed by parseVariableValue, once the type of the variable is known
+func (v *Variable) resolveVar(conductor *Conductor) (cty.Value, bool, hcl.Diagnostics) {
 	var diags hcl.Diagnostics
 	osEnvValue := os.Getenv(fmt.Sprintf("TOGOMAK_VAR_%s", v.Id))
 	if osEnvValue != "" {
-		return cty.StringVal(osEnvValue), nil
+		return cty.StringVal(osEnvValue), true, nil
+	}
+	if value, ok := conductor.VarFileValue(v.Id); ok {
+		return value, false, nil
 	}
 	for _, cliVariable := range conductor.Variables() {
 		if cliVariable.Id == v.Id {
 			conductor.Eval().Mutex().RLock()
 			b, d := cliVariable.Value.Value(conductor.Eval().Context())
 			conductor.Eval().Mutex().RUnlock()
-			return b, diags.Extend(d)
+			return b, cliVariable.shell, diags.Extend(d)
 		}
 	}
 	if v.Default != nil {
@@ -37,49 +43,64 @@ func (v *Variable) resolveVar(conductor *Conductor) (cty.Value, hcl.Diagnostics)
 		def, d := v.Default.Value(conductor.Eval().Context())
 		conductor.Eval().Mutex().RUnlock()
 		if d.HasErrors() {
-			return cty.NilVal, d
+			return cty.NilVal, false, d
 		}
 		if !def.IsNull() && def.IsKnown() {
-			return def, nil
+			return def, false, nil
 		}
 	}
 	var resp string
 	conductor.StdinLock()
 	defer conductor.StdinUnlock()
-	err := survey.AskOne(&survey.Input{
+	var prompt survey.Prompt = &survey.Input{
 		Message: fmt.Sprintf("%s.%s", blocks.VarBlock, v.Id),
 		Default: "",
 		Help:    v.Desc,
-	}, &resp)
+	}
+	if v.Sensitive {
+		prompt = &survey.Password{
+			Message: fmt.Sprintf("%s.%s", blocks.VarBlock, v.Id),
+			Help:    v.Desc,
+		}
+	}
+	err := survey.AskOne(prompt, &resp)
 	if err != nil || resp == "" {
-		return cty.NilVal, diags.Append(&hcl.Diagnostic{
+		return cty.NilVal, false, diags.Append(&hcl.Diagnostic{
 			Severity: hcl.DiagError,
 			Summary:  "No value for required variable",
 			Detail:   fmt.Sprintf("The root module input variable \"%s\" is not set, and has no default value. Use a -var, -var-file or a TOGOMAK_VAR_%s command line argument to provide a value for this variable.", v.Id, v.Id),
 		})
 	} else {
-		return cty.StringVal(resp), diags
+		return cty.StringVal(resp), true, diags
 	}
 }
 
+// typeConstraint returns the type of the variable, with its defaults. A variable
+// without a type accepts any value
+func (v *Variable) typeConstraint() (cty.Type, *typeexpr.Defaults, hcl.Diagnostics) {
+	// the type constraints, like string or list(string), are keywords and
+	// cannot be evaluated, so only a missing type evaluates to null
+	uType, d := v.Ty.Value(nil)
+	if !d.HasErrors() && uType.IsNull() {
+		return cty.DynamicPseudoType, nil, nil
+	}
+	return typeexpr.TypeConstraintWithDefaults(v.Ty)
+}
+
 func (v *Variable) resolveVarTypedWithDefaults(conductor *Conductor) (cty.Value, hcl.Diagnostics) {
 	var diags hcl.Diagnostics
-	value, d := v.resolveVar(conductor)
+	value, raw, d := v.resolveVar(conductor)
 	diags = diags.Extend(d)
 
-	// the user specified type, we will check
-	// if this type is null, or undefined, and include
-	// a fallback type
-	conductor.Eval().Mutex().RLock()
-	uType, d := v.Ty.Value(conductor.Eval().Context())
-	conductor.Eval().Mutex().RUnlock()
-
-	ty := cty.DynamicPseudoType
-	var def *typeexpr.Defaults
+	ty, def, d := v.typeConstraint()
+	diags = diags.Extend(d)
 
-	if !d.HasErrors() && !uType.IsNull() {
-		ty, def, d = typeexpr.TypeConstraintWithDefaults(v.Ty)
+	if raw && !diags.HasErrors() {
+		value, d = parseVariableValue(v.Id, value.AsString(), ty)
 		diags = diags.Extend(d)
+		if d.HasErrors() {
+			return cty.NilVal, diags
+		}
 	}
 
 	// we will first apply the default type constraints
@@ -102,6 +123,75 @@ func (v *Variable) resolveVarTypedWithDefaults(conductor *Conductor) (cty.Value,
 	return value, diags
 }
 
+// checkValidations evaluates the conditions of the validation blocks of the variable, with
+// var.<id> set to value, and the other variables set to their resolved values. Each condition which is false is reported with its error message
+func (v *Variable) checkValidations(conductor *Conductor, value cty.Value) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	if len(v.Validations) == 0 {
+		return diags
+	}
+
+	// the conditions may refer to the other variables, which are resolved before this one,
+	// see Variable.Variables, so var.<id> is the only value which is overridden
+	vars := map[string]cty.Value{}
+	conductor.Eval().Mutex().RLock()
+	evalCtx := conductor.Eval().Context().NewChild()
+	if data, ok := conductor.Eval().Context().Variables[blocks.VarBlock]; ok {
+		for k, val := range data.AsValueMap() {
+			vars[k] = val
+		}
+	}
+	conductor.Eval().Mutex().RUnlock()
+	vars[v.Id] = value
+	evalCtx.Variables = map[string]cty.Value{
+		blocks.VarBlock: cty.ObjectVal(vars),
+	}
+
+	for _, validation := range v.Validations {
+		conductor.Eval().Mutex().RLock()
+		result, d := validation.Condition.Value(evalCtx)
+		conductor.Eval().Mutex().RUnlock()
+		diags = diags.Extend(d)
+		if d.HasErrors() {
+			continue
+		}
+		result, _ = result.Unmark()
+		result, err := convert.Convert(result, cty.Bool)
+		if err != nil || result.IsNull() || !result.IsKnown() {
+			diags = diags.Append(&hcl.Diagnostic{
+				Severity:    hcl.DiagError,
+				Summary:     "Invalid validation result",
+				Detail:      fmt.Sprintf("The condition of the validation of variable %s must evaluate to true or false.", v.Id),
+				Subject:     validation.Condition.Range().Ptr(),
+				Expression:  validation.Condition,
+				EvalContext: evalCtx,
+			})
+			continue
+		}
+		if result.True() {
+			continue
+		}
+
+		conductor.Eval().Mutex().RLock()
+		msg, d := validation.ErrorMessage.Value(evalCtx)
+		conductor.Eval().Mutex().RUnlock()
+		detail := fmt.Sprintf("The value of variable %s failed its validation.", v.Id)
+		msg = conductor.unmark(msg)
+		if msg, err := convert.Convert(msg, cty.String); !d.HasErrors() && err == nil && !msg.IsNull() && msg.IsKnown() {
+			detail = msg.AsString()
+		}
+		diags = diags.Append(&hcl.Diagnostic{
+			Severity:    hcl.DiagError,
+			Summary:     "Invalid value for variable",
+			Detail:      detail,
+			Subject:     validation.Condition.Range().Ptr(),
+			Expression:  validation.Condition,
+			EvalContext: evalCtx,
+		})
+	}
+	return diags
+}
+
 func (v *Variable) Run(conductor *Conductor, options ...runnable.Option) (diags hcl.Diagnostics) {
 	// logger := conductor.Logger().WithField("var", v.Id)
 	// cfg := runnable.NewConfig(options...)
@@ -112,6 +202,14 @@ func (v *Variable) Run(conductor *Conductor, options ...runnable.Option) (diags
 	if diags.HasErrors() {
 		return diags
 	}
+	if v.Sensitive {
+		value = value.Mark(marks.Sensitive)
+		conductor.Redactions().AddValue(value)
+	}
+	diags = diags.Extend(v.checkValidations(conductor, value))
+	if diags.HasErrors() {
+		return diags
+	}
 
 	global.VariableBlockEvalContextMutex.Lock()
 	conductor.Eval().Mutex().RLock()
@@ -10,6 +10,21 @@ type Variable struct {
 	Value     hcl.Expression `hcl:"value,optional" json:"value"`
 	Default   hcl.Expression `hcl:"default,optional" json:"default"`
 	Ty        hcl.Expression `hcl:"type,optional" json:"type"`
+
+	// Sensitive marks the value of the variable as sensitive, see Redactions
+	Sensitive bool `hcl:"sensitive,optional" json:"sensitive"`
+
+	Validations []*VariableValidation `hcl:"validation,block" json:"validations"`
+
+	// shell is set for the variables set with --var, see ParseVariableShell
+	shell bool
+}
+
+// VariableValidation is a condition the value of a variable must satisfy. The variable
+// is rejected with ErrorMessage if Condition evaluates to false
+type VariableValidation struct {
+	Condition    hcl.Expression `hcl:"condition" json:"condition"`
+	ErrorMessage hcl.Expression `hcl:"error_message" json:"error_message"`
 }
 
 type Variables []*Variable
@@ -0,0 +1,130 @@
+package ci
+
+import (
+	"github.com/hashicorp/hcl/v2"
+	"github.com/srevinsaju/togomak/v1/internal/blocks"
+	"github.com/srevinsaju/togomak/v1/internal/third-party/hashicorp/terraform/lang/marks"
+	"github.com/stretchr/testify/assert"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"testing"
+)
+
+const environmentVariable = `
+togomak {
+  version = 2
+}
+variable "environment" {
+  validation {
+    condition     = contains(["dev", "staging", "prod"], var.environment)
+    error_message = "environment must be one of dev, staging or prod, got ${var.environment}."
+  }
+  validation {
+    condition     = length(var.environment) < 5
+    error_message = "environment must be short."
+  }
+}
+`
+
+func runVariable(t *testing.T, value string) hcl.Diagnostics {
+	pipe := &Pipeline{}
+	decodeConfig(t, environmentVariable, pipe)
+	cli, _ := ParseVariableShell("environment=" + value)
+	conductor := newTestConductor(ConductorConfig{Variables: Variables{cli}})
+	return pipe.Vars[0].Run(conductor)
+}
+
+func TestVariable_Validations(t *testing.T) {
+	assert.Empty(t, runVariable(t, "dev"))
+
+	diags := runVariable(t, "qa")
+	assert.Len(t, diags, 1)
+	assert.Equal(t, "Invalid value for variable", diags[0].Summary)
+	assert.Contains(t, diags[0].Detail, "environment must be one of dev, staging or prod, got qa.")
+	assert.Equal(t, 7, diags[0].Subject.Start.Line)
+
+	diags = runVariable(t, "staging")
+	assert.Len(t, diags, 1)
+	assert.Contains(t, diags[0].Detail, "environment must be short.")
+	assert.Equal(t, 11, diags[0].Subject.Start.Line)
+}
+
+func TestVariable_Variables(t *testing.T) {
+	pipe := &Pipeline{}
+	decodeConfig(t, environmentVariable, pipe)
+	for _, traversal := range pipe.Vars[0].Variables() {
+		assert.NotEqual(t, blocks.VarBlock, traversal.RootName())
+	}
+}
+
+func TestVariable_ValidationsOtherVariables(t *testing.T) {
+	src := `
+togomak {
+  version = 2
+}
+variable "region" {}
+variable "environment" {
+  validation {
+    condition     = var.region == "eu" || var.environment != "prod"
+    error_message = "prod is only deployed to eu, got ${var.region}."
+  }
+}
+`
+	run := func(region string) hcl.Diagnostics {
+		pipe := &Pipeline{}
+		decodeConfig(t, src, pipe)
+		regionCli, _ := ParseVariableShell("region=" + region)
+		environmentCli, _ := ParseVariableShell("environment=prod")
+		conductor := newTestConductor(ConductorConfig{Variables: Variables{regionCli, environmentCli}})
+		if diags := pipe.Vars[0].Run(conductor); diags.HasErrors() {
+			return diags
+		}
+		return pipe.Vars[1].Run(conductor)
+	}
+	assert.Empty(t, run("eu"))
+
+	diags := run("us")
+	assert.Len(t, diags, 1)
+	assert.Equal(t, "Invalid value for variable", diags[0].Summary)
+	assert.Contains(t, diags[0].Detail, "prod is only deployed to eu, got us.")
+}
+
+func TestParseVariableValue(t *testing.T) {
+	targets := cty.List(cty.String)
+	v, diags := parseVariableValue("targets", `["linux", "darwin"]`, targets)
+	assert.Empty(t, diags)
+	v, err := convert.Convert(v, targets)
+	assert.NoError(t, err)
+	assert.Equal(t, cty.ListVal([]cty.Value{cty.StringVal("linux"), cty.StringVal("darwin")}), v)
+
+	v, diags = parseVariableValue("name", `["linux"]`, cty.String)
+	assert.Empty(t, diags)
+	assert.Equal(t, cty.StringVal(`["linux"]`), v)
+
+	_, diags = parseVariableValue("targets", `["linux",`, targets)
+	assert.True(t, diags.HasErrors())
+	assert.Equal(t, "<value for var.targets>", diags[0].Subject.Filename)
+
+	_, diags = parseVariableValue("targets", `[upper("linux")]`, targets)
+	assert.True(t, diags.HasErrors())
+}
+
+func TestVariable_Sensitive(t *testing.T) {
+	src := `
+togomak {
+  version = 2
+}
+variable "token" {
+  sensitive = true
+}
+`
+	pipe := &Pipeline{}
+	decodeConfig(t, src, pipe)
+	cli, _ := ParseVariableShell("token=s3cr3t")
+	conductor := newTestConductor(ConductorConfig{Variables: Variables{cli}})
+	assert.Empty(t, pipe.Vars[0].Run(conductor))
+
+	token := conductor.Eval().Context().Variables[blocks.VarBlock].GetAttr("token")
+	assert.True(t, token.HasMark(marks.Sensitive))
+	assert.Equal(t, "token=(sensitive value)", conductor.Redactions().Redact("token=s3cr3t"))
+}
@@ -0,0 +1,152 @@
+package ci
+
+import (
+	"errors"
+	"fmt"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/kendru/darwin/go/depgraph"
+	"github.com/srevinsaju/togomak/v1/internal/blocks"
+	"github.com/srevinsaju/togomak/v1/internal/x"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"path/filepath"
+	"strings"
+)
+
+// ErrWatchIterationStopped is the cause of the cancellation of a run in watch mode, when it is
+// stopped to be run again. The stages which are stopped with it are not failed
+var ErrWatchIterationStopped = errors.New("stopped by a change")
+
+// WatchMatch reports if path, relative to the working directory, matches the watch pattern.
+// A "**" segment matches any number of directories, and patterns without a "/" match the
+// name of the file in any directory
+func WatchMatch(pattern string, path string) bool {
+	pattern = filepath.ToSlash(filepath.Clean(pattern))
+	path = filepath.ToSlash(filepath.Clean(path))
+	if !strings.Contains(pattern, "/") {
+		ok, _ := filepath.Match(pattern, filepath.Base(path))
+		return ok
+	}
+	return watchMatchSegments(strings.Split(pattern, "/"), strings.Split(path, "/"))
+}
+
+func watchMatchSegments(pattern []string, path []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(path); i++ {
+				if watchMatchSegments(pattern[1:], path[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(path) == 0 {
+			return false
+		}
+		ok, err := filepath.Match(pattern[0], path[0])
+		if err != nil || !ok {
+			return false
+		}
+		pattern, path = pattern[1:], path[1:]
+	}
+	return len(path) == 0
+}
+
+// WatchPatterns evaluates the watch patterns of the stage. The patterns are evaluated
+// before the pipeline runs, and may not reference other blocks
+func (s *Stage) WatchPatterns(conductor *Conductor) ([]string, hcl.Diagnostics) {
+	return globPatterns(conductor, s.Watch, "watch")
+}
+
+// globPatterns evaluates an attribute accepting a list of glob patterns, like watch and paths
+func globPatterns(conductor *Conductor, expr hcl.Expression, name string) ([]string, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	if !exprIsSet(expr) {
+		return nil, diags
+	}
+
+	conductor.Eval().Mutex().RLock()
+	v, d := expr.Value(conductor.Eval().Context())
+	conductor.Eval().Mutex().RUnlock()
+	diags = diags.Extend(d)
+	if d.HasErrors() {
+		return nil, diags
+	}
+	v, err := convert.Convert(v, cty.List(cty.String))
+	if err != nil || !v.IsWhollyKnown() {
+		return nil, diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf("Invalid %s patterns", name),
+			Detail:   fmt.Sprintf("%s must be a list of glob patterns: %v", name, err),
+			Subject:  expr.Range().Ptr(),
+		})
+	}
+	if v.IsNull() {
+		return nil, diags
+	}
+
+	var patterns []string
+	for _, pattern := range v.AsValueSlice() {
+		if pattern.IsNull() {
+			continue
+		}
+		patterns = append(patterns, pattern.AsString())
+	}
+	return patterns, diags
+}
+
+// globMatchAny reports if any of the paths matches any of the patterns
+func globMatchAny(patterns []string, paths []string) bool {
+	for _, pattern := range patterns {
+		for _, path := range paths {
+			if WatchMatch(pattern, path) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WatchMatches returns the addresses of the stages which have a watch pattern
+// matching any of the paths
+func (pipe *Pipeline) WatchMatches(conductor *Conductor, paths []string) ([]string, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	var matched []string
+	for _, stage := range pipe.Stages {
+		patterns, d := stage.WatchPatterns(conductor)
+		diags = diags.Extend(d)
+		if globMatchAny(patterns, paths) {
+			matched = append(matched, x.RenderBlock(blocks.StageBlock, stage.Id))
+		}
+	}
+	return matched, diags
+}
+
+// WatchAffected returns the stages and modules which need to be rerun when the matched
+// runnables are, which are the matched runnables, and every stage and module which
+// depends on them, in the order they run
+func WatchAffected(depGraph *depgraph.Graph, matched []string) []string {
+	set := make(map[string]bool)
+	for _, id := range matched {
+		set[id] = true
+	}
+
+	var affected []string
+	for _, node := range depGraph.TopoSorted() {
+		ty := graphNodeType(node)
+		if ty != blocks.StageBlock && ty != blocks.ModuleBlock {
+			continue
+		}
+		if set[node] {
+			affected = append(affected, node)
+			continue
+		}
+		for dep := range depGraph.Dependencies(node) {
+			if set[dep] {
+				affected = append(affected, node)
+				break
+			}
+		}
+	}
+	return affected
+}
@@ -0,0 +1,65 @@
+package ci
+
+import (
+	"github.com/kendru/darwin/go/depgraph"
+	"github.com/srevinsaju/togomak/v1/internal/rules"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestWatchMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "internal/ci/watch.go", true},
+		{"*.go", "main.md", false},
+		{"src/*.ts", "src/index.ts", true},
+		{"src/*.ts", "src/app/index.ts", false},
+		{"src/**/*.ts", "src/index.ts", true},
+		{"src/**/*.ts", "src/app/components/index.ts", true},
+		{"./src/**", "src/app/index.ts", true},
+		{"src/**", "web/index.ts", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, WatchMatch(tt.pattern, tt.path), "%s %s", tt.pattern, tt.path)
+	}
+}
+
+func TestWatchAffected(t *testing.T) {
+	g := depgraph.New()
+	assert.NoError(t, g.DependOn("stage.test", "stage.build"))
+	assert.NoError(t, g.DependOn("stage.deploy", "stage.test"))
+	assert.NoError(t, g.DependOn("stage.build", "local.name"))
+	assert.NoError(t, g.DependOn("stage.docs", "local.name"))
+
+	assert.Equal(t, []string{"stage.build", "stage.test", "stage.deploy"}, WatchAffected(g, []string{"stage.build"}))
+	assert.Equal(t, []string{"stage.docs"}, WatchAffected(g, []string{"stage.docs"}))
+	assert.Empty(t, WatchAffected(g, nil))
+}
+
+func TestBlockFilterExplain_Exact(t *testing.T) {
+	g := depgraph.New()
+	assert.NoError(t, g.DependOn("stage.test", "stage.build"))
+	assert.NoError(t, g.DependOn("module.deploy", "stage.test"))
+
+	conductor := newTestConductor(ConductorConfig{
+		Pipeline: ConfigPipeline{
+			Filtered: rules.Operations{rules.NewOperation(rules.OperationTypeAnd, "stage.test")},
+		},
+	})
+	ok, _, _, diags := BlockFilterExplain(&Stage{Id: "build"}, conductor, "stage.build", g, true, "")
+	assert.False(t, diags.HasErrors())
+	assert.True(t, ok, "the dependencies of the selected stages are selected")
+
+	// togomak watch reruns the selected stages only
+	conductor.Config.Pipeline.Exact = true
+	ok, _, _, _ = BlockFilterExplain(&Stage{Id: "build"}, conductor, "stage.build", g, true, "")
+	assert.False(t, ok)
+	ok, _, _, _ = BlockFilterExplain(&Stage{Id: "test"}, conductor, "stage.test", g, true, "")
+	assert.True(t, ok)
+	ok, _, _, _ = BlockFilterExplain(&Module{Id: "deploy"}, conductor, "module.deploy", g, true, "")
+	assert.False(t, ok)
+}
@@ -0,0 +1,55 @@
+package dg
+
+import (
+	"github.com/hashicorp/hcl/v2"
+)
+
+type JSONPos struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+	Byte   int `json:"byte"`
+}
+
+type JSONRange struct {
+	Filename string  `json:"filename"`
+	Start    JSONPos `json:"start"`
+	End      JSONPos `json:"end"`
+}
+
+// JSONDiagnostic is the machine-readable representation of a hcl.Diagnostic
+type JSONDiagnostic struct {
+	Severity string     `json:"severity"`
+	Summary  string     `json:"summary"`
+	Detail   string     `json:"detail,omitempty"`
+	Range    *JSONRange `json:"range,omitempty"`
+}
+
+func newJSONRange(rng *hcl.Range) *JSONRange {
+	if rng == nil {
+		return nil
+	}
+	return &JSONRange{
+		Filename: rng.Filename,
+		Start:    JSONPos{Line: rng.Start.Line, Column: rng.Start.Column, Byte: rng.Start.Byte},
+		End:      JSONPos{Line: rng.End.Line, Column: rng.End.Column, Byte: rng.End.Byte},
+	}
+}
+
+// NewJSONDiagnostics converts diags to a list of JSONDiagnostic, which can be
+// marshalled with encoding/json
+func NewJSONDiagnostics(diags hcl.Diagnostics) []JSONDiagnostic {
+	result := make([]JSONDiagnostic, 0, len(diags))
+	for _, diag := range diags {
+		severity := "error"
+		if diag.Severity == hcl.DiagWarning {
+			severity = "warning"
+		}
+		result = append(result, JSONDiagnostic{
+			Severity: severity,
+			Summary:  diag.Summary,
+			Detail:   diag.Detail,
+			Range:    newJSONRange(diag.Subject),
+		})
+	}
+	return result
+}
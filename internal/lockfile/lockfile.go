@@ -0,0 +1,269 @@
+// Package lockfile records the remote sources of the imports and the modules of a pipeline in
+// togomak.lock.hcl, with the commit or the URL they resolved to and the hash of their content,
+// and verifies that they did not change on the later runs
+package lockfile
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const header = "# This file is maintained by togomak, with togomak lock.\n# It should be committed with the pipeline, and not edited manually.\n\n"
+
+// Source is a remote source recorded in the lock file
+type Source struct {
+	// Source is the source, as detected by go-getter, like git::https://github.com/org/repo?ref=main
+	Source string `hcl:"source,label"`
+
+	// Resolved is the source pinned to the commit it resolved to, for git sources, or Source otherwise
+	Resolved string `hcl:"resolved"`
+
+	// Hash is the hash of the files of the source, see HashDir
+	Hash string `hcl:"hash"`
+}
+
+type file struct {
+	Sources []*Source `hcl:"source,block"`
+}
+
+// Lock is the lock file of a pipeline. It is shared by the pipeline and its modules,
+// and is safe for concurrent use. A nil Lock is valid, and verifies nothing
+type Lock struct {
+	path    string
+	upgrade bool
+	add     bool
+	exists  bool
+
+	mu      sync.Mutex
+	sources map[string]*Source
+	changed bool
+}
+
+// Load reads the lock file at path, if it exists. The sources which are not in the lock file,
+// or which do not match it, are updated in the lock file, instead of being an error, if upgrade
+// is set
+func Load(path string, upgrade bool) (*Lock, hcl.Diagnostics) {
+	l := &Lock{path: path, upgrade: upgrade, sources: make(map[string]*Source)}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return l, nil
+	}
+	l.exists = true
+	f, diags := hclparse.NewParser().ParseHCLFile(path)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	var content file
+	diags = gohcl.DecodeBody(f.Body, nil, &content)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	for _, source := range content.Sources {
+		l.sources[source.Source] = source
+	}
+	return l, nil
+}
+
+// New returns an empty lock file at path, which records all the sources it verifies,
+// and replaces the lock file when it is written
+func New(path string) *Lock {
+	return &Lock{path: path, upgrade: true, sources: make(map[string]*Source), changed: true}
+}
+
+// AddUnlocked makes Verify add the sources which are not in the lock file, instead of
+// returning a *NotLockedError, for the commands which write the lock file, like togomak get.
+// The sources which do not match the lock file are still an error, unless it is upgraded
+func (l *Lock) AddUnlocked() *Lock {
+	if l != nil {
+		l.add = true
+	}
+	return l
+}
+
+// Exists returns true if the lock file existed when it was loaded
+func (l *Lock) Exists() bool {
+	return l != nil && l.exists
+}
+
+// NotLockedError is returned by Verify if a source is not in the lock file
+type NotLockedError struct {
+	Source string
+}
+
+func (e *NotLockedError) Error() string {
+	return fmt.Sprintf("%s is not locked", e.Source)
+}
+
+// MismatchError is returned by Verify if a source does not match the lock file
+type MismatchError struct {
+	Locked  Source
+	Fetched Source
+}
+
+func (e *MismatchError) Error() string {
+	if e.Locked.Resolved != e.Fetched.Resolved {
+		return fmt.Sprintf("%s was locked at %s, but now resolves to %s", e.Locked.Source, e.Locked.Resolved, e.Fetched.Resolved)
+	}
+	return fmt.Sprintf("the content of %s changed, it was locked with %s, but now has %s", e.Locked.Source, e.Locked.Hash, e.Fetched.Hash)
+}
+
+// Verify compares source, fetched to dir, with the lock file, resolved is the source pinned
+// to its commit, see Resolve. A source which is not in the lock file is a *NotLockedError, and
+// a source which resolved to another commit, or whose content changed, is a *MismatchError,
+// unless the lock file is upgraded, see AddUnlocked
+func (l *Lock) Verify(source string, resolved string, dir string) error {
+	if l == nil {
+		return nil
+	}
+	hash, err := HashDir(dir)
+	if err != nil {
+		return err
+	}
+	fetched := Source{Source: source, Resolved: resolved, Hash: hash}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	locked, ok := l.sources[source]
+	if ok && *locked == fetched {
+		return nil
+	}
+	if ok && !l.upgrade {
+		return &MismatchError{Locked: *locked, Fetched: fetched}
+	}
+	if !ok && !l.upgrade && !l.add {
+		return &NotLockedError{Source: source}
+	}
+	l.sources[source] = &fetched
+	l.changed = true
+	return nil
+}
+
+// Sources returns the sources of the lock file, sorted by source
+func (l *Lock) Sources() []Source {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var sources []Source
+	for _, source := range l.sources {
+		sources = append(sources, *source)
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		return sources[i].Source < sources[j].Source
+	})
+	return sources
+}
+
+// Write writes the lock file, if a source was added or updated since it was read
+func (l *Lock) Write() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	changed := l.changed
+	l.mu.Unlock()
+	if !changed {
+		return nil
+	}
+
+	f := hclwrite.NewEmptyFile()
+	for i, source := range l.Sources() {
+		if i != 0 {
+			f.Body().AppendNewline()
+		}
+		block := f.Body().AppendNewBlock("source", []string{source.Source})
+		block.Body().SetAttributeValue("resolved", cty.StringVal(source.Resolved))
+		block.Body().SetAttributeValue("hash", cty.StringVal(source.Hash))
+	}
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, append([]byte(header), f.Bytes()...), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, l.path); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	l.changed = false
+	l.mu.Unlock()
+	return nil
+}
+
+// Resolve returns source pinned to the commit checked out in dir, if source is a git
+// repository, or source as is otherwise
+func Resolve(source string, dir string) string {
+	if !strings.HasPrefix(source, "git::") {
+		return source
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+		return source
+	}
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return source
+	}
+	u, err := url.Parse(strings.TrimPrefix(source, "git::"))
+	if err != nil {
+		return source
+	}
+	q := u.Query()
+	q.Set("ref", strings.TrimSpace(string(out)))
+	u.RawQuery = q.Encode()
+	return "git::" + u.String()
+}
+
+// HashDir returns the hash of the files in dir, ignoring the .git directory, as
+// h1:<base64 sha256>, which is the format of the hashes of go.sum
+func HashDir(dir string) (string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if d.Type().IsRegular() {
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(files)
+
+	h := sha256.New()
+	for _, name := range files {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			return "", err
+		}
+		fh := sha256.New()
+		_, err = io.Copy(fh, f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%x  %s\n", fh.Sum(nil), name)
+	}
+	return "h1:" + base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
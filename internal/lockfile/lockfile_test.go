@@ -0,0 +1,56 @@
+package lockfile
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLock(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, ".git"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "togomak.hcl"), []byte("v1"), 0644))
+	path := filepath.Join(dir, "togomak.lock.hcl")
+
+	var nilLock *Lock
+	assert.NoError(t, nilLock.Verify("https://example.com/src.zip", "https://example.com/src.zip", src))
+
+	// a source which is not locked is an error, unless it is added
+	lock, diags := Load(path, false)
+	assert.False(t, diags.HasErrors())
+	assert.False(t, lock.Exists())
+	err := lock.Verify("https://example.com/src.zip", "https://example.com/src.zip", src)
+	var notLocked *NotLockedError
+	assert.ErrorAs(t, err, &notLocked)
+	assert.Equal(t, "https://example.com/src.zip is not locked", err.Error())
+	assert.NoError(t, lock.AddUnlocked().Verify("https://example.com/src.zip", "https://example.com/src.zip", src))
+	assert.NoError(t, lock.Write())
+
+	// the .git directory is not a part of the hash
+	assert.NoError(t, os.WriteFile(filepath.Join(src, ".git", "HEAD"), []byte("ref"), 0644))
+	lock, diags = Load(path, false)
+	assert.False(t, diags.HasErrors())
+	assert.True(t, lock.Exists())
+	assert.Len(t, lock.Sources(), 1)
+	assert.NoError(t, lock.Verify("https://example.com/src.zip", "https://example.com/src.zip", src))
+
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "togomak.hcl"), []byte("v2"), 0644))
+	err = lock.Verify("https://example.com/src.zip", "https://example.com/src.zip", src)
+	var mismatch *MismatchError
+	assert.ErrorAs(t, err, &mismatch)
+	assert.Contains(t, err.Error(), "the content of https://example.com/src.zip changed")
+	assert.ErrorAs(t, lock.Verify("https://example.com/other.zip", "https://example.com/other.zip", src), &notLocked)
+	assert.ErrorAs(t, lock.AddUnlocked().Verify("https://example.com/src.zip", "https://example.com/src.zip", src), &mismatch)
+
+	lock, diags = Load(path, true)
+	assert.False(t, diags.HasErrors())
+	assert.NoError(t, lock.Verify("https://example.com/src.zip", "https://example.com/src.zip", src))
+	assert.NoError(t, lock.Write())
+	hash, err := HashDir(src)
+	assert.NoError(t, err)
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), hash)
+}
@@ -0,0 +1,176 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBatchSize     = 100
+	defaultBatchInterval = time.Second
+	defaultBatchRetries  = 3
+	batchRetryBackoff    = 500 * time.Millisecond
+)
+
+// record is an entry queued by a batcher
+type record struct {
+	Time    time.Time
+	Level   logrus.Level
+	Message string
+	Labels  map[string]string
+}
+
+// permanentError is an error of a batch which is not retried, like a rejected request
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+// batcher queues the records of a sink, and sends them in batches when the batch is full,
+// every interval, and when it is closed. A batch which fails to send is retried with an
+// exponential backoff, and dropped after the retries
+type batcher struct {
+	name     string
+	send     func([]record) error
+	size     int
+	interval time.Duration
+	retries  int
+
+	mu      sync.Mutex
+	records []record
+
+	full chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+// batchOptions reads the batch_size, interval and retries options of sink
+func batchOptions(sink SinkConfig) (size int, interval time.Duration, retries int, err error) {
+	size, interval, retries = defaultBatchSize, defaultBatchInterval, defaultBatchRetries
+	if v, ok := sink.Options["batch_size"]; ok {
+		size, err = strconv.Atoi(v)
+		if err != nil || size <= 0 {
+			return 0, 0, 0, fmt.Errorf("%s sink: invalid batch_size %s", sink.Name, v)
+		}
+	}
+	if v, ok := sink.Options["interval"]; ok {
+		interval, err = time.ParseDuration(v)
+		if err != nil || interval <= 0 {
+			return 0, 0, 0, fmt.Errorf("%s sink: invalid interval %s", sink.Name, v)
+		}
+	}
+	if v, ok := sink.Options["retries"]; ok {
+		retries, err = strconv.Atoi(v)
+		if err != nil || retries < 0 {
+			return 0, 0, 0, fmt.Errorf("%s sink: invalid retries %s", sink.Name, v)
+		}
+	}
+	return size, interval, retries, nil
+}
+
+func newBatcher(name string, size int, interval time.Duration, retries int, send func([]record) error) *batcher {
+	b := &batcher{
+		name:     name,
+		send:     send,
+		size:     size,
+		interval: interval,
+		retries:  retries,
+		full:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+func (b *batcher) add(r record) {
+	b.mu.Lock()
+	b.records = append(b.records, r)
+	full := len(b.records) >= b.size
+	b.mu.Unlock()
+	if full {
+		select {
+		case b.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (b *batcher) run() {
+	defer close(b.done)
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+		case <-b.full:
+		}
+		if err := b.flush(); err != nil {
+			b.report(err)
+		}
+	}
+}
+
+// flush sends the queued records, in batches of at most size records
+func (b *batcher) flush() error {
+	b.mu.Lock()
+	records := b.records
+	b.records = nil
+	b.mu.Unlock()
+
+	var errs []error
+	for len(records) != 0 {
+		n := len(records)
+		if n > b.size {
+			n = b.size
+		}
+		if err := b.sendWithRetries(records[:n]); err != nil {
+			errs = append(errs, err)
+		}
+		records = records[n:]
+	}
+	return errors.Join(errs...)
+}
+
+func (b *batcher) sendWithRetries(records []record) error {
+	var err error
+	backoff := batchRetryBackoff
+	for attempt := 0; attempt <= b.retries; attempt++ {
+		if attempt != 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		err = b.send(records)
+		var permanent permanentError
+		if err == nil || errors.As(err, &permanent) {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("dropped %d log entries: %w", len(records), err)
+	}
+	return nil
+}
+
+// report writes the errors of the batches sent in the background to stderr, as the
+// logger which would log them is the one whose entries failed to be sent
+func (b *batcher) report(err error) {
+	fmt.Fprintf(os.Stderr, "%s sink: %s\n", b.name, err)
+}
+
+// Close stops sending the batches in the background, and sends the queued records
+func (b *batcher) Close() error {
+	close(b.stop)
+	<-b.done
+	return b.flush()
+}
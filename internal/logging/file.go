@@ -0,0 +1,37 @@
+package logging
+
+import (
+	"github.com/rifflock/lfshook"
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	Register("file", NewFileSink)
+}
+
+// FileSink writes the entries to a local file as JSON
+type FileSink struct {
+	*lfshook.LfsHook
+	levels []logrus.Level
+}
+
+// NewFileSink creates a FileSink writing to the path option, which defaults to togomak.log
+func NewFileSink(cfg Config, sink SinkConfig) (Sink, error) {
+	path, ok := sink.Options["path"]
+	if !ok || path == "" {
+		path = "togomak.log"
+	}
+	return &FileSink{
+		LfsHook: lfshook.NewHook(path, &logrus.JSONFormatter{}),
+		levels:  levels(sink.Level),
+	}, nil
+}
+
+func (s *FileSink) Levels() []logrus.Level {
+	return s.levels
+}
+
+// Close does nothing, the file is opened and closed for every entry
+func (s *FileSink) Close() error {
+	return nil
+}
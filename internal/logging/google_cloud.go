@@ -2,6 +2,7 @@ package logging
 
 import (
 	"context"
+	"errors"
 	"github.com/acarl005/stripansi"
 	"github.com/sirupsen/logrus"
 	"github.com/srevinsaju/togomak/v1/internal/meta"
@@ -13,6 +14,10 @@ import "cloud.google.com/go/logging"
 
 var hostname string
 
+func init() {
+	Register("google-cloud", NewGoogleCloudSink)
+}
+
 func googleCloudLoggingClient(project string) (*logging.Client, error) {
 	loggerContext := context.Background()
 	hostname = x.MustReturn(os.Hostname()).(string)
@@ -26,11 +31,28 @@ type GoogleCloudLoggerHook struct {
 	client  *logging.Client
 	cfg     Config
 	project string
+	levels  []logrus.Level
+	sink    SinkConfig
 }
 
 func NewGoogleCloudLoggerHook(cfg Config, project string) (*GoogleCloudLoggerHook, error) {
 	client, err := googleCloudLoggingClient(project)
-	return &GoogleCloudLoggerHook{cfg: cfg, client: client, project: project}, err
+	return &GoogleCloudLoggerHook{cfg: cfg, client: client, project: project, levels: levels(logrus.InfoLevel)}, err
+}
+
+// NewGoogleCloudSink creates a GoogleCloudLoggerHook for the project option
+func NewGoogleCloudSink(cfg Config, sink SinkConfig) (Sink, error) {
+	project, ok := sink.Options["project"]
+	if !ok || project == "" {
+		return nil, errors.New("google-cloud sink requires project option")
+	}
+	hook, err := NewGoogleCloudLoggerHook(cfg, project)
+	if err != nil {
+		return nil, err
+	}
+	hook.levels = levels(sink.Level)
+	hook.sink = sink
+	return hook, nil
 }
 
 func (h *GoogleCloudLoggerHook) Fire(entry *logrus.Entry) error {
@@ -65,16 +87,25 @@ func (h *GoogleCloudLoggerHook) Fire(entry *logrus.Entry) error {
 		Resource: &monitoredres.MonitoredResource{Type: "global"},
 		Trace:    "togomak",
 		Severity: severityLevel,
-		Labels: map[string]string{
-			"app":          meta.AppName,
-			"version":      meta.AppVersion,
-			"instanceName": meta.AppName,
-			"instanceId":   h.cfg.CorrelationID,
-		},
+		Labels:   h.labels(entry),
 	})
 	return nil
 }
 
+// labels returns the labels of the entry, with the stage, the module and the run, see labels
+func (h *GoogleCloudLoggerHook) labels(entry *logrus.Entry) map[string]string {
+	l := labels(h.cfg, h.sink, entry)
+	l["version"] = meta.AppVersion
+	l["instanceName"] = meta.AppName
+	l["instanceId"] = h.cfg.CorrelationID
+	return l
+}
+
 func (h *GoogleCloudLoggerHook) Levels() []logrus.Level {
-	return []logrus.Level{logrus.InfoLevel, logrus.WarnLevel, logrus.ErrorLevel, logrus.FatalLevel, logrus.PanicLevel}
+	return h.levels
+}
+
+// Close flushes the entries which were not sent yet
+func (h *GoogleCloudLoggerHook) Close() error {
+	return h.client.Close()
 }
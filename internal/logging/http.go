@@ -0,0 +1,97 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"time"
+)
+
+const httpTimeout = 10 * time.Second
+
+func init() {
+	Register("http", NewHTTPSink)
+}
+
+// HTTPSink sends the entries in batches to a URL as JSON lines, one object per entry
+// with its time, level, message and labels
+type HTTPSink struct {
+	*batcher
+	cfg    Config
+	sink   SinkConfig
+	url    string
+	levels []logrus.Level
+}
+
+// NewHTTPSink creates an HTTPSink posting to the url option. The headers options, like
+// headers.Authorization, are set on the requests. See batchOptions for the batching options
+func NewHTTPSink(cfg Config, sink SinkConfig) (Sink, error) {
+	url := sink.Options["url"]
+	if url == "" {
+		return nil, errors.New("http sink requires url option")
+	}
+	size, interval, retries, err := batchOptions(sink)
+	if err != nil {
+		return nil, err
+	}
+	s := &HTTPSink{cfg: cfg, sink: sink, url: url, levels: levels(sink.Level)}
+	headers := sink.Map("headers")
+	s.batcher = newBatcher(sink.Name, size, interval, retries, func(records []record) error {
+		var body bytes.Buffer
+		enc := json.NewEncoder(&body)
+		for _, r := range records {
+			err := enc.Encode(map[string]any{
+				"time":    r.Time.Format(time.RFC3339Nano),
+				"level":   r.Level.String(),
+				"message": r.Message,
+				"labels":  r.Labels,
+			})
+			if err != nil {
+				return permanentError{err}
+			}
+		}
+		return post(url, "application/x-ndjson", headers, &body)
+	})
+	return s, nil
+}
+
+func (s *HTTPSink) Fire(entry *logrus.Entry) error {
+	s.add(record{Time: entry.Time, Level: entry.Level, Message: message(entry), Labels: labels(s.cfg, s.sink, entry)})
+	return nil
+}
+
+func (s *HTTPSink) Levels() []logrus.Level {
+	return s.levels
+}
+
+// post sends body to url. The requests which are rejected by the server with a
+// client error, other than too many requests, are not retried
+func post(url string, contentType string, headers map[string]string, body io.Reader) error {
+	req, err := http.NewRequest(http.MethodPost, url, body)
+	if err != nil {
+		return permanentError{err}
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	client := &http.Client{Timeout: httpTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 300 {
+		return nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("%s returned %s: %s", url, resp.Status, bytes.TrimSpace(msg))
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+		return permanentError{err}
+	}
+	return err
+}
@@ -1,20 +1,11 @@
 package logging
 
 import (
-	"errors"
-	"github.com/rifflock/lfshook"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
 	"os"
 )
 
-type Sink struct {
-	Name  string
-	Level logrus.Level
-
-	Options map[string]string
-}
-
 type Config struct {
 	Verbosity     int
 	Child         bool
@@ -22,14 +13,18 @@ type Config struct {
 	JSON          bool
 	CorrelationID string
 
-	Sinks []Sink
+	// Stderr writes the logs to stderr instead of stdout, for commands
+	// which write machine-readable output to stdout
+	Stderr bool
+
+	Sinks []SinkConfig
 }
 
-func ParseSinksFromCLI(ctx *cli.Context) []Sink {
-	var sinks []Sink
+func ParseSinksFromCLI(ctx *cli.Context) []SinkConfig {
+	var sinks []SinkConfig
 	file := ctx.Bool("logging.local.file")
 	if file {
-		sinks = append(sinks, Sink{
+		sinks = append(sinks, SinkConfig{
 			Name:  "file",
 			Level: logrus.DebugLevel,
 			Options: map[string]string{
@@ -39,20 +34,44 @@ func ParseSinksFromCLI(ctx *cli.Context) []Sink {
 	}
 	gcloud := ctx.Bool("logging.remote.google-cloud")
 	if gcloud {
-		sinks = append(sinks, Sink{
+		sinks = append(sinks, SinkConfig{
 			Name:  "google-cloud",
-			Level: logrus.DebugLevel,
+			Level: logrus.InfoLevel,
 			Options: map[string]string{
 				"project": ctx.String("logging.remote.google-cloud.project"),
 			},
 		})
 	}
+	if url := ctx.String("logging.remote.loki"); url != "" {
+		sinks = append(sinks, SinkConfig{
+			Name:    "loki",
+			Level:   logrus.DebugLevel,
+			Options: map[string]string{"url": url},
+		})
+	}
+	if url := ctx.String("logging.remote.http"); url != "" {
+		sinks = append(sinks, SinkConfig{
+			Name:    "http",
+			Level:   logrus.DebugLevel,
+			Options: map[string]string{"url": url},
+		})
+	}
+	if address := ctx.String("logging.remote.syslog"); address != "" {
+		sinks = append(sinks, SinkConfig{
+			Name:    "syslog",
+			Level:   logrus.DebugLevel,
+			Options: map[string]string{"address": address},
+		})
+	}
 	return sinks
 }
 
 func New(cfg Config) (*logrus.Logger, error) {
 	logger := logrus.New()
 	logger.SetOutput(os.Stdout)
+	if cfg.Stderr {
+		logger.SetOutput(os.Stderr)
+	}
 	logger.SetFormatter(&logrus.TextFormatter{
 		FullTimestamp:    false,
 		DisableTimestamp: cfg.Child,
@@ -91,27 +110,11 @@ func New(cfg Config) (*logrus.Logger, error) {
 	}
 
 	for _, sink := range cfg.Sinks {
-		switch sink.Name {
-		case "file":
-			path, ok := sink.Options["path"]
-			if !ok {
-				path = "togomak.log"
-			}
-			hook := lfshook.NewHook(path, &logrus.JSONFormatter{})
-			logger.AddHook(hook)
-		case "google-cloud":
-			project, ok := sink.Options["project"]
-			if !ok {
-				return nil, errors.New("google-cloud sink requires project option")
-			}
-			hook, err := NewGoogleCloudLoggerHook(cfg, project)
-			if err != nil {
-				return nil, err
-			}
-			logger.AddHook(hook)
-		default:
-			return nil, errors.New("unknown sink: " + sink.Name)
+		hook, err := NewSink(cfg, sink)
+		if err != nil {
+			return nil, err
 		}
+		logger.AddHook(hook)
 	}
 
 	return logger, nil
@@ -0,0 +1,119 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// lokiPushPath is the path of the push API of Loki, which is appended to the url
+// option if it only has the address of Loki
+const lokiPushPath = "/loki/api/v1/push"
+
+func init() {
+	Register("loki", NewLokiSink)
+}
+
+// LokiSink pushes the entries in batches to Grafana Loki. The labels of the entries,
+// including their level, are the labels of the streams
+type LokiSink struct {
+	*batcher
+	cfg    Config
+	sink   SinkConfig
+	levels []logrus.Level
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+type lokiPush struct {
+	Streams []*lokiStream `json:"streams"`
+}
+
+// NewLokiSink creates a LokiSink for the url option, like http://localhost:3100. The tenant_id
+// option sets the tenant of the entries, and the username and password options authenticate
+// the requests. See batchOptions for the batching options
+func NewLokiSink(cfg Config, sink SinkConfig) (Sink, error) {
+	endpoint := sink.Options["url"]
+	if endpoint == "" {
+		return nil, errors.New("loki sink requires url option")
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("loki sink: invalid url %s: %w", endpoint, err)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = lokiPushPath
+	}
+	endpoint = u.String()
+
+	headers := sink.Map("headers")
+	if tenant := sink.Options["tenant_id"]; tenant != "" {
+		headers["X-Scope-OrgID"] = tenant
+	}
+	if username := sink.Options["username"]; username != "" {
+		credentials := base64.StdEncoding.EncodeToString([]byte(username + ":" + sink.Options["password"]))
+		headers["Authorization"] = "Basic " + credentials
+	}
+
+	size, interval, retries, err := batchOptions(sink)
+	if err != nil {
+		return nil, err
+	}
+	s := &LokiSink{cfg: cfg, sink: sink, levels: levels(sink.Level)}
+	s.batcher = newBatcher(sink.Name, size, interval, retries, func(records []record) error {
+		data, err := json.Marshal(lokiStreams(records))
+		if err != nil {
+			return permanentError{err}
+		}
+		return post(endpoint, "application/json", headers, bytes.NewReader(data))
+	})
+	return s, nil
+}
+
+// lokiStreams groups the records by their labels
+func lokiStreams(records []record) lokiPush {
+	streams := make(map[string]*lokiStream)
+	var push lokiPush
+	for _, r := range records {
+		labels := make(map[string]string, len(r.Labels)+1)
+		for k, v := range r.Labels {
+			labels[k] = v
+		}
+		labels["level"] = r.Level.String()
+
+		keys := make([]string, 0, len(labels))
+		for k, v := range labels {
+			keys = append(keys, k+"\x00"+v)
+		}
+		sort.Strings(keys)
+		key := strings.Join(keys, "\x01")
+
+		stream, ok := streams[key]
+		if !ok {
+			stream = &lokiStream{Stream: labels}
+			streams[key] = stream
+			push.Streams = append(push.Streams, stream)
+		}
+		stream.Values = append(stream.Values, [2]string{strconv.FormatInt(r.Time.UnixNano(), 10), r.Message})
+	}
+	return push
+}
+
+func (s *LokiSink) Fire(entry *logrus.Entry) error {
+	s.add(record{Time: entry.Time, Level: entry.Level, Message: message(entry), Labels: labels(s.cfg, s.sink, entry)})
+	return nil
+}
+
+func (s *LokiSink) Levels() []logrus.Level {
+	return s.levels
+}
@@ -0,0 +1,211 @@
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/acarl005/stripansi"
+	"github.com/sirupsen/logrus"
+	"github.com/srevinsaju/togomak/v1/internal/meta"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sink receives the entries of a logger, like a file or a remote log collector.
+// Sinks are created from a SinkConfig by the factory registered under its name, see Register
+type Sink interface {
+	logrus.Hook
+
+	// Close sends the entries which are still buffered, and releases the resources of the sink
+	Close() error
+}
+
+// SinkConfig is the configuration of a sink
+type SinkConfig struct {
+	Name string
+
+	// Level is the least severe level sent to the sink
+	Level logrus.Level
+
+	// Options are specific to each sink. The options which are maps, like labels
+	// and headers, are flattened to keys like labels.team
+	Options map[string]string
+}
+
+// Map returns the options of the map prefix, like labels, without the prefix
+func (s SinkConfig) Map(prefix string) map[string]string {
+	m := make(map[string]string)
+	for k, v := range s.Options {
+		if key, ok := strings.CutPrefix(k, prefix+"."); ok {
+			m[key] = v
+		}
+	}
+	return m
+}
+
+// SinkFactory creates the sink configured by sink
+type SinkFactory func(cfg Config, sink SinkConfig) (Sink, error)
+
+var sinks = make(map[string]SinkFactory)
+
+// Register makes the sink name available to SinkConfig. It is called by the init
+// functions of the sinks, and panics if the name is registered twice
+func Register(name string, factory SinkFactory) {
+	if _, ok := sinks[name]; ok {
+		panic(fmt.Sprintf("sink %s is registered twice", name))
+	}
+	sinks[name] = factory
+}
+
+// SinkNames returns the names of the registered sinks
+func SinkNames() []string {
+	var names []string
+	for name := range sinks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewSink creates the sink configured by sink
+func NewSink(cfg Config, sink SinkConfig) (Sink, error) {
+	factory, ok := sinks[sink.Name]
+	if !ok {
+		return nil, fmt.Errorf("unknown sink %s, expected one of %s", sink.Name, strings.Join(SinkNames(), ", "))
+	}
+	return factory(cfg, sink)
+}
+
+// levels returns the levels at least as severe as level
+func levels(level logrus.Level) []logrus.Level {
+	var l []logrus.Level
+	for _, lvl := range logrus.AllLevels {
+		if lvl <= level {
+			l = append(l, lvl)
+		}
+	}
+	return l
+}
+
+// labelFields are the fields of the entries which are sent as labels, the stage and the
+// module are set by the loggers of the stages and modules
+var labelFields = []string{"stage", "module"}
+
+// labels returns the labels of entry: the app, the id of the run, the stage and the module
+// which logged it, if any, and the labels of the sink
+func labels(cfg Config, sink SinkConfig, entry *logrus.Entry) map[string]string {
+	l := map[string]string{"app": meta.AppName}
+	if cfg.CorrelationID != "" {
+		l["run"] = cfg.CorrelationID
+	}
+	for _, field := range labelFields {
+		if v, ok := entry.Data[field]; ok {
+			l[field] = fmt.Sprint(v)
+		}
+	}
+	for k, v := range sink.Map("labels") {
+		l[k] = v
+	}
+	return l
+}
+
+// message returns the message of entry without the ANSI escape codes
+func message(entry *logrus.Entry) string {
+	return strings.TrimRight(stripansi.Strip(entry.Message), "\n")
+}
+
+// Close closes the sinks of logger, and removes them from its hooks
+func Close(logger *logrus.Logger) error {
+	if logger == nil {
+		return nil
+	}
+	closed := make(map[Sink]bool)
+	hooks := make(logrus.LevelHooks)
+	var errs []string
+	for level, hs := range logger.Hooks {
+		for _, h := range hs {
+			s, ok := h.(Sink)
+			if !ok {
+				hooks[level] = append(hooks[level], h)
+				continue
+			}
+			if closed[s] {
+				continue
+			}
+			closed[s] = true
+			if err := s.Close(); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+	}
+	logger.ReplaceHooks(hooks)
+	if len(errs) != 0 {
+		return fmt.Errorf("failed to close the log sinks: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// sinkWriter sends the lines written to it to the sinks of a logger, see SinkWriter
+type sinkWriter struct {
+	mu      sync.Mutex
+	entry   *logrus.Entry
+	sinks   []Sink
+	partial []byte
+}
+
+// SinkWriter returns a writer which sends the lines written to it as info entries with the
+// fields of entry to the sinks of its logger, without writing them to the output of the logger.
+// It is used for the output of the stages, which is not written through the logger in every
+// output mode. It returns nil if the logger has no sinks
+func SinkWriter(entry *logrus.Entry) io.WriteCloser {
+	if entry == nil || entry.Logger == nil {
+		return nil
+	}
+	var s []Sink
+	for _, h := range entry.Logger.Hooks[logrus.InfoLevel] {
+		if sink, ok := h.(Sink); ok {
+			s = append(s, sink)
+		}
+	}
+	if len(s) == 0 {
+		return nil
+	}
+	return &sinkWriter{entry: entry, sinks: s}
+}
+
+func (w *sinkWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	data := append(w.partial, p...)
+	i := bytes.LastIndexByte(data, '\n')
+	w.partial = append([]byte(nil), data[i+1:]...)
+	if i >= 0 {
+		for _, line := range strings.Split(string(data[:i]), "\n") {
+			w.fire(line)
+		}
+	}
+	return len(p), nil
+}
+
+func (w *sinkWriter) fire(line string) {
+	entry := w.entry.Dup()
+	entry.Level = logrus.InfoLevel
+	entry.Message = line
+	entry.Time = time.Now()
+	for _, s := range w.sinks {
+		_ = s.Fire(entry)
+	}
+}
+
+// Close sends the last line, if it does not end with a newline
+func (w *sinkWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.partial) != 0 {
+		w.fire(string(w.partial))
+		w.partial = nil
+	}
+	return nil
+}
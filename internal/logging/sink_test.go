@@ -0,0 +1,149 @@
+package logging
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestNewSink(t *testing.T) {
+	assert.Contains(t, SinkNames(), "loki")
+	assert.Contains(t, SinkNames(), "http")
+	assert.Contains(t, SinkNames(), "syslog")
+
+	_, err := NewSink(Config{}, SinkConfig{Name: "does-not-exist"})
+	assert.ErrorContains(t, err, "unknown sink does-not-exist")
+	_, err = NewSink(Config{}, SinkConfig{Name: "loki"})
+	assert.ErrorContains(t, err, "requires url")
+	_, err = NewSink(Config{}, SinkConfig{Name: "http", Options: map[string]string{"url": "http://localhost", "batch_size": "0"}})
+	assert.ErrorContains(t, err, "invalid batch_size")
+}
+
+func newTestLogger(t *testing.T, cfg Config, sink SinkConfig) (*logrus.Logger, Sink) {
+	s, err := NewSink(cfg, sink)
+	assert.NoError(t, err)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	logger.AddHook(s)
+	return logger, s
+}
+
+func TestLokiSink(t *testing.T) {
+	var mu sync.Mutex
+	var pushes []lokiPush
+	var tenant string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, lokiPushPath, r.URL.Path)
+		var push lokiPush
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&push))
+		mu.Lock()
+		pushes = append(pushes, push)
+		tenant = r.Header.Get("X-Scope-OrgID")
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	logger, _ := newTestLogger(t, Config{CorrelationID: "run-1"}, SinkConfig{
+		Name:    "loki",
+		Level:   logrus.InfoLevel,
+		Options: map[string]string{"url": server.URL, "tenant_id": "ci", "labels.team": "platform"},
+	})
+	logger.WithField("stage", "build").Info("\x1b[1mcompiling\x1b[0m")
+	logger.WithField("stage", "build").Info("done")
+	logger.WithField("module", "api").WithField("stage", "test").Warn("flaky")
+	logger.Debug("not sent")
+	assert.NoError(t, Close(logger))
+	assert.Empty(t, logger.Hooks)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Len(t, pushes, 1)
+	assert.Equal(t, "ci", tenant)
+	streams := pushes[0].Streams
+	assert.Len(t, streams, 2)
+	assert.Equal(t, map[string]string{"app": "togomak", "run": "run-1", "stage": "build", "team": "platform", "level": "info"}, streams[0].Stream)
+	assert.Equal(t, "compiling", streams[0].Values[0][1])
+	assert.Equal(t, "done", streams[0].Values[1][1])
+	assert.Equal(t, "api", streams[1].Stream["module"])
+	assert.Equal(t, "warning", streams[1].Stream["level"])
+}
+
+func TestHTTPSink(t *testing.T) {
+	var mu sync.Mutex
+	var lines []map[string]any
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			var line map[string]any
+			assert.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+			lines = append(lines, line)
+		}
+	}))
+	defer server.Close()
+
+	logger, _ := newTestLogger(t, Config{}, SinkConfig{
+		Name:    "http",
+		Level:   logrus.InfoLevel,
+		Options: map[string]string{"url": server.URL, "batch_size": "2", "headers.Authorization": "Bearer token"},
+	})
+	entry := logger.WithField("stage", "build")
+	w := SinkWriter(entry)
+	_, _ = w.Write([]byte("compiling\ndo"))
+	_, _ = w.Write([]byte("ne"))
+	assert.NoError(t, w.Close())
+	assert.NoError(t, Close(logger))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 2, attempts)
+	assert.Len(t, lines, 2)
+	assert.Equal(t, "compiling", lines[0]["message"])
+	assert.Equal(t, "done", lines[1]["message"])
+	assert.Equal(t, "info", lines[1]["level"])
+	assert.Equal(t, map[string]any{"app": "togomak", "stage": "build"}, lines[1]["labels"])
+}
+
+func TestSyslogSink(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	logger, _ := newTestLogger(t, Config{CorrelationID: "run-1"}, SinkConfig{
+		Name:    "syslog",
+		Level:   logrus.InfoLevel,
+		Options: map[string]string{"address": "udp://" + conn.LocalAddr().String(), "facility": "local0"},
+	})
+	logger.WithField("stage", "build").Error(`failed "quoted"`)
+	assert.NoError(t, Close(logger))
+
+	buf := make([]byte, 1024)
+	n, _, err := conn.ReadFrom(buf)
+	assert.NoError(t, err)
+	msg := string(buf[:n])
+	assert.True(t, strings.HasPrefix(msg, "<131>1 "), msg)
+	assert.Contains(t, msg, ` togomak `)
+	assert.Contains(t, msg, `[togomak@32473 app="togomak" run="run-1" stage="build"] failed "quoted"`)
+}
+
+func TestSinkWriter(t *testing.T) {
+	logger := logrus.New()
+	assert.Nil(t, SinkWriter(logrus.NewEntry(logger)))
+}
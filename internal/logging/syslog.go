@@ -0,0 +1,192 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"github.com/srevinsaju/togomak/v1/internal/meta"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// syslogStructuredDataId is the id of the structured data with the labels of the entries,
+// 32473 is the private enterprise number reserved for documentation by RFC 5612
+const syslogStructuredDataId = "togomak@32473"
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+var syslogSeverities = map[logrus.Level]int{
+	logrus.PanicLevel: 0,
+	logrus.FatalLevel: 2,
+	logrus.ErrorLevel: 3,
+	logrus.WarnLevel:  4,
+	logrus.InfoLevel:  6,
+	logrus.DebugLevel: 7,
+	logrus.TraceLevel: 7,
+}
+
+func init() {
+	Register("syslog", NewSyslogSink)
+}
+
+// SyslogSink sends the entries to a syslog server in the RFC 5424 format, with
+// their labels as structured data
+type SyslogSink struct {
+	mu       sync.Mutex
+	conn     net.Conn
+	network  string
+	address  string
+	facility int
+	tag      string
+	hostname string
+
+	cfg    Config
+	sink   SinkConfig
+	levels []logrus.Level
+}
+
+// syslogAddress returns the network and the address of the address option, which is a
+// unix socket, like unix:///dev/log or /dev/log, or a server, like udp://localhost:514
+// or tcp://localhost:514
+func syslogAddress(address string) (string, string, error) {
+	if !strings.Contains(address, "://") {
+		return "unix", address, nil
+	}
+	u, err := url.Parse(address)
+	if err != nil {
+		return "", "", err
+	}
+	switch u.Scheme {
+	case "unix":
+		return "unix", u.Path, nil
+	case "udp", "tcp":
+		return u.Scheme, u.Host, nil
+	}
+	return "", "", fmt.Errorf("unknown network %s, expected unix, udp or tcp", u.Scheme)
+}
+
+// NewSyslogSink creates a SyslogSink for the address option, see syslogAddress. The facility
+// option defaults to user, and the tag option, the name of the app, to togomak
+func NewSyslogSink(cfg Config, sink SinkConfig) (Sink, error) {
+	address := sink.Options["address"]
+	if address == "" {
+		return nil, errors.New("syslog sink requires address option")
+	}
+	network, address, err := syslogAddress(address)
+	if err != nil {
+		return nil, fmt.Errorf("syslog sink: invalid address %s: %w", sink.Options["address"], err)
+	}
+	facility := syslogFacilities["user"]
+	if name, ok := sink.Options["facility"]; ok {
+		facility, ok = syslogFacilities[name]
+		if !ok {
+			return nil, fmt.Errorf("syslog sink: unknown facility %s", name)
+		}
+	}
+	tag := sink.Options["tag"]
+	if tag == "" {
+		tag = meta.AppName
+	}
+	hostname, _ := os.Hostname()
+
+	s := &SyslogSink{
+		network:  network,
+		address:  address,
+		facility: facility,
+		tag:      tag,
+		hostname: hostname,
+		cfg:      cfg,
+		sink:     sink,
+		levels:   levels(sink.Level),
+	}
+	if err := s.connect(); err != nil {
+		return nil, fmt.Errorf("syslog sink: %w", err)
+	}
+	return s, nil
+}
+
+// connect connects to the syslog server. The unix sockets of the local syslog daemons,
+// like /dev/log, are usually datagram sockets
+func (s *SyslogSink) connect() error {
+	var err error
+	if s.network == "unix" {
+		if s.conn, err = net.Dial("unixgram", s.address); err == nil {
+			return nil
+		}
+	}
+	s.conn, err = net.DialTimeout(s.network, s.address, httpTimeout)
+	return err
+}
+
+// syslogEscape escapes the value of a structured data parameter
+func syslogEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(s)
+}
+
+// format returns entry in the RFC 5424 format
+func (s *SyslogSink) format(entry *logrus.Entry) string {
+	l := labels(s.cfg, s.sink, entry)
+	keys := make([]string, 0, len(l))
+	for k := range l {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var data strings.Builder
+	data.WriteString("[" + syslogStructuredDataId)
+	for _, k := range keys {
+		fmt.Fprintf(&data, ` %s="%s"`, k, syslogEscape(l[k]))
+	}
+	data.WriteString("]")
+
+	priority := s.facility*8 + syslogSeverities[entry.Level]
+	msg := fmt.Sprintf("<%d>1 %s %s %s %d - %s %s",
+		priority, entry.Time.Format(time.RFC3339Nano), s.hostname, s.tag, os.Getpid(), data.String(), message(entry))
+	if s.network == "tcp" {
+		msg += "\n"
+	}
+	return msg
+}
+
+// Fire sends entry, it reconnects once if the connection was closed
+func (s *SyslogSink) Fire(entry *logrus.Entry) error {
+	msg := s.format(entry)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		if _, err := s.conn.Write([]byte(msg)); err == nil {
+			return nil
+		}
+		s.conn.Close()
+		s.conn = nil
+	}
+	if err := s.connect(); err != nil {
+		return err
+	}
+	_, err := s.conn.Write([]byte(msg))
+	return err
+}
+
+func (s *SyslogSink) Levels() []logrus.Level {
+	return s.levels
+}
+
+func (s *SyslogSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
@@ -10,6 +10,7 @@ const (
 	AppDescription = "A simple, declarative, and reproducible CI/CD pipeline generator powered by HCL"
 
 	ConfigFileName = "togomak.hcl"
+	LockFileName   = "togomak.lock.hcl"
 	BuildDirPrefix = ".togomak"
 
 	EnvVarPrefix = "TOGOMAK__"
@@ -0,0 +1,261 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"github.com/srevinsaju/togomak/v1/internal/meta"
+	"github.com/srevinsaju/togomak/v1/internal/runnable"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CacheImage is the cache of the container images, the image of a stage is a
+// cache hit if it exists locally, and a cache miss if it is pulled
+const CacheImage = "image"
+
+// Config is where the metrics of the runs are exported. Nothing is exported if it is empty
+type Config struct {
+	// Textfile is the path of the file the metrics are written to at the end of the run,
+	// in the Prometheus exposition format, for the textfile collector of the node exporter
+	Textfile string
+
+	// Pushgateway is the URL of the Prometheus Pushgateway the metrics are pushed to at the end of the run
+	Pushgateway string
+
+	// Listen is the address on which the metrics are served on /metrics while togomak runs,
+	// which is useful for togomak watch and pipelines with daemons
+	Listen string
+}
+
+func (c Config) Enabled() bool {
+	return c.Textfile != "" || c.Pushgateway != "" || c.Listen != ""
+}
+
+// durationBuckets range from 100ms to about half an hour
+var durationBuckets = prometheus.ExponentialBuckets(0.1, 4, 8)
+
+// runnableState is the state of a stage or a module, which is used to compute its queue wait
+// time, the time between the start of the run and the start of the runnable, and its duration
+type runnableState struct {
+	pending time.Time
+	started time.Time
+}
+
+type recorder struct {
+	mu        sync.Mutex
+	pipeline  string
+	runnables map[string]*runnableState
+
+	// registry has the metrics with the pipeline label, and unlabelled the metrics without it,
+	// which are pushed to the Pushgateway, where the pipeline is part of the grouping key
+	registry   *prometheus.Registry
+	unlabelled *prometheus.Registry
+
+	runs            *prometheus.CounterVec
+	lastRunSuccess  prometheus.Gauge
+	lastRunTime     prometheus.Gauge
+	lastRunDuration prometheus.Gauge
+
+	stageRuns      *prometheus.CounterVec
+	stageDuration  *prometheus.HistogramVec
+	stageRetries   *prometheus.CounterVec
+	stageQueueWait *prometheus.HistogramVec
+
+	containerPull *prometheus.HistogramVec
+	cache         *prometheus.CounterVec
+}
+
+// Metrics records the metrics of the runs of a pipeline and of its stages and modules,
+// see Config. A nil Metrics is valid, and records nothing.
+type Metrics struct {
+	recorder *recorder
+	scope    string
+}
+
+// New creates the metrics of the runs of pipeline, which is added as a label to all the metrics,
+// so that the metrics of many pipelines can be collected from the same host
+func New(pipeline string) *Metrics {
+	r := &recorder{
+		pipeline:   pipeline,
+		runnables:  make(map[string]*runnableState),
+		registry:   prometheus.NewRegistry(),
+		unlabelled: prometheus.NewRegistry(),
+	}
+	r.runs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "togomak_runs_total",
+		Help: "Number of runs of the pipeline, by status.",
+	}, []string{"status"})
+	r.lastRunSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "togomak_last_run_success",
+		Help: "Whether the last run of the pipeline succeeded.",
+	})
+	r.lastRunTime = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "togomak_last_run_timestamp_seconds",
+		Help: "Time at which the last run of the pipeline finished.",
+	})
+	r.lastRunDuration = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "togomak_last_run_duration_seconds",
+		Help: "Duration of the last run of the pipeline.",
+	})
+	r.stageRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "togomak_stage_runs_total",
+		Help: "Number of runs of the stages and modules, by status.",
+	}, []string{"stage", "status"})
+	r.stageDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "togomak_stage_duration_seconds",
+		Help:    "Duration of the stages and modules, including their retries.",
+		Buckets: durationBuckets,
+	}, []string{"stage"})
+	r.stageRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "togomak_stage_retries_total",
+		Help: "Number of retries of the stages and modules.",
+	}, []string{"stage"})
+	r.stageQueueWait = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "togomak_stage_queue_wait_seconds",
+		Help:    "Time the stages and modules waited for their dependencies before they started.",
+		Buckets: durationBuckets,
+	}, []string{"stage"})
+	r.containerPull = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "togomak_container_pull_duration_seconds",
+		Help:    "Time spent pulling the container images of the stages.",
+		Buckets: durationBuckets,
+	}, []string{"image"})
+	r.cache = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "togomak_cache_requests_total",
+		Help: "Number of lookups in the caches of togomak, by cache and result.",
+	}, []string{"cache", "result"})
+
+	collectors := []prometheus.Collector{
+		r.runs, r.lastRunSuccess, r.lastRunTime, r.lastRunDuration,
+		r.stageRuns, r.stageDuration, r.stageRetries, r.stageQueueWait,
+		r.containerPull, r.cache,
+	}
+	r.unlabelled.MustRegister(collectors...)
+	prometheus.WrapRegistererWith(prometheus.Labels{"pipeline": pipeline}, r.registry).MustRegister(collectors...)
+	return &Metrics{recorder: r}
+}
+
+// Scope returns a Metrics which shares the metrics of m, but prefixes the addresses of the
+// stages with scope. This is used by modules, so that the stages of the child pipeline
+// do not collide with the stages of the parent pipeline
+func (m *Metrics) Scope(scope string) *Metrics {
+	if m == nil {
+		return nil
+	}
+	if m.scope != "" {
+		scope = m.scope + "." + scope
+	}
+	return &Metrics{recorder: m.recorder, scope: scope}
+}
+
+func (m *Metrics) address(id string) string {
+	if m.scope == "" {
+		return id
+	}
+	return m.scope + "." + id
+}
+
+// Observe records a change in the status of the stage or module id at t. The queue wait time
+// is the time between pending and running, and the duration is the time between running
+// and the result, which includes the retries. Only the results of the runs are counted, by status
+func (m *Metrics) Observe(id string, status runnable.StatusType, retry int, t time.Time) {
+	if m == nil {
+		return
+	}
+	r := m.recorder
+	address := m.address(id)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	state, ok := r.runnables[address]
+	if !ok {
+		state = &runnableState{}
+		r.runnables[address] = state
+	}
+	switch status {
+	case runnable.StatusPending:
+		state.pending = t
+	case runnable.StatusRunning:
+		if retry != 0 {
+			r.stageRetries.WithLabelValues(address).Inc()
+			return
+		}
+		state.started = t
+		if !state.pending.IsZero() {
+			r.stageQueueWait.WithLabelValues(address).Observe(t.Sub(state.pending).Seconds())
+		}
+	case runnable.StatusSuccess, runnable.StatusFailure, runnable.StatusTerminated, runnable.StatusSkipped:
+		r.stageRuns.WithLabelValues(address, string(status)).Inc()
+		if !state.started.IsZero() {
+			r.stageDuration.WithLabelValues(address).Observe(t.Sub(state.started).Seconds())
+		}
+		delete(r.runnables, address)
+	}
+}
+
+// Run records a run of the pipeline, which started at start and finished at end
+func (m *Metrics) Run(failed bool, start time.Time, end time.Time) {
+	if m == nil {
+		return
+	}
+	r := m.recorder
+	status, success := runnable.StatusSuccess, 1.0
+	if failed {
+		status, success = runnable.StatusFailure, 0
+	}
+	r.runs.WithLabelValues(string(status)).Inc()
+	r.lastRunSuccess.Set(success)
+	r.lastRunTime.Set(float64(end.UnixNano()) / 1e9)
+	r.lastRunDuration.Set(end.Sub(start).Seconds())
+}
+
+// ContainerPull records the time spent pulling image
+func (m *Metrics) ContainerPull(image string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.recorder.containerPull.WithLabelValues(image).Observe(d.Seconds())
+}
+
+// Cache records a lookup in cache, like CacheImage
+func (m *Metrics) Cache(cache string, hit bool) {
+	if m == nil {
+		return
+	}
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.recorder.cache.WithLabelValues(cache, result).Inc()
+}
+
+// WriteTextfile writes the metrics to path in the Prometheus exposition format. The file is
+// replaced atomically, so that the textfile collector never reads a partial file
+func (m *Metrics) WriteTextfile(path string) error {
+	if m == nil {
+		return nil
+	}
+	return prometheus.WriteToTextfile(path, m.recorder.registry)
+}
+
+// Push replaces the metrics of the pipeline on the Pushgateway at url. They are grouped by
+// the pipeline, so that the runs of a pipeline do not replace the metrics of the others
+func (m *Metrics) Push(url string) error {
+	if m == nil {
+		return nil
+	}
+	return push.New(url, meta.AppName).
+		Gatherer(m.recorder.unlabelled).
+		Grouping("pipeline", m.recorder.pipeline).
+		Push()
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func (m *Metrics) Handler() http.Handler {
+	if m == nil {
+		return http.NotFoundHandler()
+	}
+	return promhttp.HandlerFor(m.recorder.registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/srevinsaju/togomak/v1/internal/runnable"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	m := New("togomak.hcl")
+	start := time.Now()
+
+	m.Observe("stage.build", runnable.StatusPending, 0, start)
+	m.Observe("stage.build", runnable.StatusRunning, 0, start.Add(2*time.Second))
+	m.Observe("stage.build", runnable.StatusRunning, 1, start.Add(3*time.Second))
+	m.Observe("stage.build", runnable.StatusFailure, 1, start.Add(5*time.Second))
+	m.Observe("stage.lint", runnable.StatusSkipped, 0, start)
+
+	module := m.Scope("module.api")
+	module.Observe("stage.test", runnable.StatusRunning, 0, start)
+	module.Observe("stage.test", runnable.StatusSuccess, 0, start.Add(time.Second))
+
+	m.ContainerPull("alpine", 4*time.Second)
+	m.Cache(CacheImage, true)
+	m.Cache(CacheImage, false)
+	m.Run(true, start, start.Add(6*time.Second))
+
+	r := m.recorder
+	assert.Equal(t, 1.0, testutil.ToFloat64(r.stageRuns.WithLabelValues("stage.build", "failure")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(r.stageRuns.WithLabelValues("stage.lint", "skipped")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(r.stageRuns.WithLabelValues("module.api.stage.test", "success")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(r.stageRetries.WithLabelValues("stage.build")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(r.runs.WithLabelValues("failure")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(r.lastRunSuccess))
+	assert.Equal(t, 6.0, testutil.ToFloat64(r.lastRunDuration))
+	assert.Equal(t, 1.0, testutil.ToFloat64(r.cache.WithLabelValues(CacheImage, "hit")))
+	assert.Empty(t, r.runnables)
+
+	path := filepath.Join(t.TempDir(), "togomak.prom")
+	assert.NoError(t, m.WriteTextfile(path))
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	text := string(data)
+	assert.Contains(t, text, `togomak_stage_duration_seconds_sum{pipeline="togomak.hcl",stage="stage.build"} 3`)
+	assert.Contains(t, text, `togomak_stage_queue_wait_seconds_sum{pipeline="togomak.hcl",stage="stage.build"} 2`)
+	assert.Contains(t, text, `togomak_container_pull_duration_seconds_count{image="alpine",pipeline="togomak.hcl"} 1`)
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, strings.Contains(rec.Body.String(), "togomak_runs_total"))
+}
+
+func TestMetrics_Push(t *testing.T) {
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	m := New("togomak.hcl")
+	m.Run(false, time.Now(), time.Now())
+	assert.NoError(t, m.Push(server.URL))
+	assert.Equal(t, "/metrics/job/togomak/pipeline/togomak.hcl", path)
+}
+
+func TestMetrics_Nil(t *testing.T) {
+	var m *Metrics
+	m.Observe("stage.build", runnable.StatusRunning, 0, time.Now())
+	m.Run(false, time.Now(), time.Now())
+	assert.Nil(t, m.Scope("module.api"))
+	assert.NoError(t, m.WriteTextfile(filepath.Join(t.TempDir(), "togomak.prom")))
+}
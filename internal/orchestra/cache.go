@@ -0,0 +1,223 @@
+package orchestra
+
+import (
+	"context"
+	"fmt"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	dockerClient "github.com/docker/docker/client"
+	"github.com/dustin/go-humanize"
+	"github.com/srevinsaju/togomak/v1/internal/cache"
+	"github.com/srevinsaju/togomak/v1/internal/ci"
+	"github.com/srevinsaju/togomak/v1/internal/meta"
+	"github.com/srevinsaju/togomak/v1/internal/runlog"
+	"github.com/srevinsaju/togomak/v1/internal/ui"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// CacheConfig configures the togomak cache commands
+type CacheConfig struct {
+	// Dir is the directory of the pipeline whose artifacts are managed, see cache.Artifact
+	Dir string
+
+	// Recursive manages the artifacts of the pipelines within Dir as well
+	Recursive bool
+
+	// OlderThan and KeepLast select the entries removed by CachePrune
+	OlderThan time.Duration
+	KeepLast  int
+
+	// Imports, Artifacts and Containers select what CacheClean removes, All selects all of them.
+	// CacheClean removes the temporary directories of the pipelines if none is set
+	All        bool
+	Imports    bool
+	Artifacts  bool
+	Containers bool
+}
+
+// CacheList lists the remote sources in the cache, and the artifacts of the pipeline, with their
+// size, their age, and the pipeline which owns them. It returns the exit code of the process
+func CacheList(cfg CacheConfig) int {
+	dir := cache.SourcesDir()
+	entries, err := cache.Entries(dir)
+	if err != nil {
+		ui.Error(fmt.Sprintf("failed to read the cache in %s: %s", dir, err))
+		return 1
+	}
+	artifacts, err := cache.Artifacts(cfg.Dir, cfg.Recursive)
+	if err != nil {
+		ui.Error(fmt.Sprintf("failed to read the artifacts in %s: %s", cfg.Dir, err))
+		return 1
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tNAME\tSIZE\tUSED\tPIPELINE")
+	for _, entry := range entries {
+		size, err := cache.Size(entry.Dir(dir))
+		if err != nil {
+			ui.Error(fmt.Sprintf("failed to read %s: %s", entry.Dir(dir), err))
+			return 1
+		}
+		fmt.Fprintf(w, "import\t%s\t%s\t%s\t%s\n", entry.Source, humanize.Bytes(uint64(size)), humanize.Time(entry.UsedAt), entry.Pipeline)
+	}
+	for _, artifact := range artifacts {
+		size, err := cache.Size(artifact.Path)
+		if err != nil {
+			ui.Error(fmt.Sprintf("failed to read %s: %s", artifact.Path, err))
+			return 1
+		}
+		fmt.Fprintf(w, "artifact\t%s\t%s\t%s\t%s\n", relPath(cfg.Dir, artifact.Path), humanize.Bytes(uint64(size)), humanize.Time(artifact.Time), artifact.Pipeline)
+	}
+	_ = w.Flush()
+	return 0
+}
+
+// CacheDiskUsage shows the size of the remote sources in the cache, and of the artifacts of the
+// pipeline. It returns the exit code of the process
+func CacheDiskUsage(cfg CacheConfig) int {
+	dir := cache.SourcesDir()
+	var imports int64
+	if _, err := os.Stat(dir); err == nil {
+		size, err := cache.Size(dir)
+		if err != nil {
+			ui.Error(fmt.Sprintf("failed to read the cache in %s: %s", dir, err))
+			return 1
+		}
+		imports = size
+	}
+	artifacts, err := cache.Artifacts(cfg.Dir, cfg.Recursive)
+	if err != nil {
+		ui.Error(fmt.Sprintf("failed to read the artifacts in %s: %s", cfg.Dir, err))
+		return 1
+	}
+	var artifactsSize int64
+	for _, artifact := range artifacts {
+		size, err := cache.Size(artifact.Path)
+		if err != nil {
+			ui.Error(fmt.Sprintf("failed to read %s: %s", artifact.Path, err))
+			return 1
+		}
+		artifactsSize += size
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "imports\t%s\t%s\n", humanize.Bytes(uint64(imports)), dir)
+	fmt.Fprintf(w, "artifacts\t%s\t%s\n", humanize.Bytes(uint64(artifactsSize)), filepath.Join(cfg.Dir, meta.BuildDirPrefix))
+	fmt.Fprintf(w, "total\t%s\t\n", humanize.Bytes(uint64(imports+artifactsSize)))
+	_ = w.Flush()
+	return 0
+}
+
+// CachePrune removes the remote sources in the cache which were not used for longer than
+// cfg.OlderThan, and the artifacts of the pipeline which are older, except the cfg.KeepLast
+// latest of each. It returns the exit code of the process
+func CachePrune(cfg CacheConfig) int {
+	dir := cache.SourcesDir()
+	pruned, err := cache.PruneSources(dir, cfg.OlderThan, cfg.KeepLast)
+	for _, entry := range pruned {
+		fmt.Printf("removed %s\n", entry.Source)
+	}
+	if err != nil {
+		ui.Error(fmt.Sprintf("failed to prune the cache in %s: %s", dir, err))
+		return 1
+	}
+	artifacts, err := cache.PruneArtifacts(cfg.Dir, cfg.Recursive, cfg.OlderThan, cfg.KeepLast)
+	for _, artifact := range artifacts {
+		fmt.Printf("removed %s\n", relPath(cfg.Dir, artifact.Path))
+	}
+	if err != nil {
+		ui.Error(fmt.Sprintf("failed to prune the artifacts in %s: %s", cfg.Dir, err))
+		return 1
+	}
+	ui.Success("removed %d source(s) and %d artifact(s)", len(pruned), len(artifacts))
+	return 0
+}
+
+// CacheClean removes the remote sources in the cache, the artifacts of the pipeline, or the
+// containers left behind by the runs which were killed, see CacheConfig. It returns the exit
+// code of the process
+func CacheClean(cfg CacheConfig) int {
+	if cfg.All || cfg.Imports {
+		dir := cache.SourcesDir()
+		pruned, err := cache.PruneSources(dir, 0, 0)
+		for _, entry := range pruned {
+			fmt.Printf("removed %s\n", entry.Source)
+		}
+		if err != nil {
+			ui.Error(fmt.Sprintf("failed to clean the cache in %s: %s", dir, err))
+			return 1
+		}
+	}
+
+	none := !cfg.All && !cfg.Imports && !cfg.Artifacts && !cfg.Containers
+	if none || cfg.All || cfg.Artifacts {
+		removed, err := cache.CleanCache(cfg.Dir, cfg.Recursive, cfg.All || cfg.Artifacts)
+		for _, artifact := range removed {
+			fmt.Printf("removed %s\n", relPath(cfg.Dir, artifact.Path))
+		}
+		if err != nil {
+			ui.Error(fmt.Sprintf("failed to clean the artifacts in %s: %s", cfg.Dir, err))
+			return 1
+		}
+	}
+
+	if cfg.All || cfg.Containers {
+		if err := cleanContainers(); err != nil {
+			ui.Error(fmt.Sprintf("failed to clean the containers: %s", err))
+			return 1
+		}
+	}
+	return 0
+}
+
+// cleanContainers removes the containers of the stages, see ci.ContainerLabelRun, unless
+// their run is still running
+func cleanContainers() error {
+	ctx := context.Background()
+	cli, err := dockerClient.NewClientWithOpts(dockerClient.FromEnv, dockerClient.WithAPIVersionNegotiation())
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	containers, err := cli.ContainerList(ctx, types.ContainerListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", ci.ContainerLabelRun)),
+	})
+	if err != nil {
+		return err
+	}
+	for _, container := range containers {
+		runId := container.Labels[ci.ContainerLabelRun]
+		if container.State == "running" {
+			runDir := container.Labels[ci.ContainerLabelRunDir]
+			if runDir == "" {
+				// the run was not recorded, so it is unknown if it is still running
+				fmt.Printf("skipped %s of %s, which is running\n", container.ID[:12], container.Labels[ci.ContainerLabelStage])
+				continue
+			}
+			run, err := runlog.Load(filepath.Dir(runDir), runId)
+			if err == nil && run.Alive() {
+				continue
+			}
+		}
+		if err := cli.ContainerRemove(ctx, container.ID, types.ContainerRemoveOptions{Force: true}); err != nil {
+			return err
+		}
+		fmt.Printf("removed container %s of %s in run %s\n", container.ID[:12], container.Labels[ci.ContainerLabelStage], runId)
+	}
+	return nil
+}
+
+// relPath returns path relative to dir, if it is within dir
+func relPath(dir string, path string) string {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+	return rel
+}
@@ -0,0 +1,32 @@
+package orchestra
+
+import (
+	"fmt"
+	"github.com/srevinsaju/togomak/v1/internal/ci"
+)
+
+// Complete prints the completions of prefix, one on each line, for the shell completion
+// scripts. The addresses of the blocks are completed for describe, and the filters for
+// the other commands. Only the pipeline files are parsed, imports are not expanded,
+// and data providers are not run, so that completion stays fast.
+// It returns the exit code of the process
+func Complete(cfg ci.ConductorConfig, command string, prefix string) int {
+	conductor := ci.NewConductor(cfg)
+	defer conductor.Destroy()
+
+	pipe, diags := ci.Read(conductor)
+	if diags.HasErrors() {
+		return 1
+	}
+
+	var completions []string
+	if command == "describe" {
+		completions = ci.CompleteAddresses(pipe.List(conductor), prefix)
+	} else {
+		completions = ci.CompleteFilters(pipe.List(conductor), prefix)
+	}
+	for _, completion := range completions {
+		fmt.Println(completion)
+	}
+	return 0
+}
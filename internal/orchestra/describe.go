@@ -0,0 +1,57 @@
+package orchestra
+
+import (
+	"fmt"
+	"github.com/srevinsaju/togomak/v1/internal/ci"
+	"github.com/srevinsaju/togomak/v1/internal/runnable"
+)
+
+// Describe prints the fully evaluated configuration of the block at address. The variables,
+// locals, data and macro blocks it depends on are run to evaluate it, stages and modules are not.
+// It returns the exit code of the process
+func Describe(cfg ci.ConductorConfig, address string) int {
+	conductor := ci.NewConductor(cfg)
+	defer conductor.Destroy()
+	logger := conductor.Logger()
+	ExpandGlobalParams(conductor)
+
+	pipe, diags := ci.Read(conductor)
+	if diags.HasErrors() {
+		logger.Fatal(conductor.DiagWriter.WriteDiagnostics(diags))
+	}
+
+	pipe, d := ci.ExpandImports(conductor, pipe, conductor.Config.Paths)
+	diags = diags.Extend(d)
+	if diags.HasErrors() {
+		logger.Fatal(conductor.DiagWriter.WriteDiagnostics(diags))
+	}
+
+	locals, d := pipe.Locals.Expand()
+	diags = diags.Extend(d)
+	if diags.HasErrors() {
+		logger.Fatal(conductor.DiagWriter.WriteDiagnostics(diags))
+	}
+	pipe.Local = locals
+
+	depGraph, d := ci.GraphTopoSort(conductor, pipe)
+	diags = diags.Extend(d)
+	if diags.HasErrors() {
+		logger.Fatal(conductor.DiagWriter.WriteDiagnostics(diags))
+	}
+
+	description, d := pipe.Describe(conductor, depGraph, address,
+		runnable.WithBehavior(conductor.Config.Behavior),
+		runnable.WithPaths(conductor.Config.Paths),
+	)
+	diags = diags.Extend(d)
+	if description != nil {
+		fmt.Print(description.String())
+	}
+	if len(diags) != 0 {
+		_ = conductor.DiagWriter.WriteDiagnostics(diags)
+	}
+	if diags.HasErrors() {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,163 @@
+package orchestra
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/srevinsaju/togomak/v1/internal/cache"
+	"github.com/srevinsaju/togomak/v1/internal/ci"
+	"github.com/srevinsaju/togomak/v1/internal/lockfile"
+	"github.com/srevinsaju/togomak/v1/internal/ui"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// fetch fetches the remote sources of the imports and the modules of the pipeline, ignoring the
+// vendored sources, and verifies them against the lock file, to which the sources which are not
+// locked yet are added. It returns the fetched sources, and false if they could not be fetched
+func fetch(cfg ci.ConductorConfig) (*ci.Conductor, []ci.RemoteSource, bool) {
+	cfg.Pipeline.IgnoreVendor = true
+	conductor := ci.NewConductor(cfg)
+	ExpandGlobalParams(conductor)
+
+	pipe, diags := ci.Read(conductor)
+	if diags.HasErrors() {
+		_ = conductor.DiagWriter.WriteDiagnostics(diags)
+		return conductor, nil, false
+	}
+
+	path := ci.LockFile(conductor.Config.Paths)
+	lock, d := lockfile.Load(path, conductor.Config.Pipeline.Upgrade)
+	diags = diags.Extend(d)
+	if d.HasErrors() {
+		_ = conductor.DiagWriter.WriteDiagnostics(diags)
+		return conductor, nil, false
+	}
+	conductor.Update(ci.ConductorWithLock(lock.AddUnlocked()))
+	diags = diags.Extend(ci.FetchSources(conductor, pipe))
+	_ = conductor.DiagWriter.WriteDiagnostics(diags)
+	if diags.HasErrors() {
+		return conductor, nil, false
+	}
+	if err := lock.Write(); err != nil {
+		ui.Error(fmt.Sprintf("failed to write %s: %s", path, err))
+		return conductor, nil, false
+	}
+	return conductor, conductor.FetchedSources(), true
+}
+
+// Get fetches the remote sources of the imports and the modules of the pipeline to the cache,
+// so that the pipeline can run without access to the network. It returns the exit code of the process
+func Get(cfg ci.ConductorConfig) int {
+	conductor, sources, ok := fetch(cfg)
+	defer conductor.Destroy()
+	if !ok {
+		return 1
+	}
+	for _, source := range sources {
+		fmt.Printf("%s  %s\n", ui.Bold(source.Resolved), ui.Grey(source.Dir))
+	}
+	ui.Success("fetched %d source(s) to %s", len(sources), cache.SourcesDir())
+	return 0
+}
+
+// Vendor fetches the remote sources of the imports and the modules of the pipeline, and replaces
+// ci.VendorDir with a copy of them, which the pipeline uses instead of fetching them. It returns
+// the exit code of the process
+func Vendor(cfg ci.ConductorConfig) int {
+	conductor, sources, ok := fetch(cfg)
+	defer conductor.Destroy()
+	if !ok {
+		return 1
+	}
+
+	dir := filepath.Join(conductor.Config.Paths.Cwd, ci.VendorDir)
+	if err := vendor(dir, sources); err != nil {
+		ui.Error(fmt.Sprintf("failed to vendor the sources to %s: %s", dir, err))
+		return 1
+	}
+	for _, source := range sources {
+		fmt.Println(ui.Bold(source.Resolved))
+	}
+	ui.Success("vendored %d source(s) to %s", len(sources), dir)
+	return 0
+}
+
+// vendor replaces dir with a copy of sources, and their manifest, see ci.ReadVendorManifest
+func vendor(dir string, sources []ci.RemoteSource) error {
+	tmp := dir + ".tmp"
+	if err := os.RemoveAll(tmp); err != nil {
+		return err
+	}
+	manifest := make(ci.VendorManifest)
+	for _, source := range sources {
+		key := source.Key()
+		if err := copyDir(source.Dir, filepath.Join(tmp, key)); err != nil {
+			return err
+		}
+		manifest[key] = source
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(tmp, 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(tmp, ci.VendorManifestFileName), data, 0644); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dir)
+}
+
+// copyDir copies the files in src to dst, ignoring the .git directory
+func copyDir(src string, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, 0755)
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case d.Type().IsRegular():
+			in, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer in.Close()
+			out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(out, in); err != nil {
+				out.Close()
+				return err
+			}
+			return out.Close()
+		}
+		return nil
+	})
+}
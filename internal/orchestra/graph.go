@@ -0,0 +1,82 @@
+package orchestra
+
+import (
+	"fmt"
+	"github.com/srevinsaju/togomak/v1/internal/blocks"
+	"github.com/srevinsaju/togomak/v1/internal/ci"
+)
+
+type GraphConfig struct {
+	Format       string
+	HideInternal bool
+	Collapse     bool
+}
+
+// Graph prints the dependency graph of the pipeline without running it.
+// When filters or queries are passed on the command line, the stages and modules
+// which would run are highlighted.
+func Graph(cfg ci.ConductorConfig, graphCfg GraphConfig) error {
+	conductor := ci.NewConductor(cfg)
+	defer conductor.Destroy()
+	logger := conductor.Logger()
+	ExpandGlobalParams(conductor)
+
+	pipe, diags := ci.Read(conductor)
+	if diags.HasErrors() {
+		logger.Fatal(conductor.DiagWriter.WriteDiagnostics(diags))
+	}
+
+	pipe, d := ci.ExpandImports(conductor, pipe, conductor.Config.Paths)
+	diags = diags.Extend(d)
+	if diags.HasErrors() {
+		logger.Fatal(conductor.DiagWriter.WriteDiagnostics(diags))
+	}
+
+	locals, d := pipe.Locals.Expand()
+	diags = diags.Extend(d)
+	if diags.HasErrors() {
+		logger.Fatal(conductor.DiagWriter.WriteDiagnostics(diags))
+	}
+	pipe.Local = locals
+
+	depGraph, d := ci.GraphTopoSort(conductor, pipe)
+	diags = diags.Extend(d)
+	if diags.HasErrors() {
+		logger.Fatal(conductor.DiagWriter.WriteDiagnostics(diags))
+	}
+
+	var selection map[string]bool
+	if len(cfg.Pipeline.Filtered) != 0 || len(cfg.Pipeline.FilterQuery) != 0 {
+		selection = make(map[string]bool)
+		for _, runnableId := range depGraph.TopoSorted() {
+			runnable, skip, d := pipe.Resolve(runnableId)
+			if skip || d.HasErrors() {
+				continue
+			}
+			if runnable.Type() != blocks.StageBlock && runnable.Type() != blocks.ModuleBlock {
+				continue
+			}
+
+			// the condition of a runnable may depend on the outputs of the
+			// runnables before it, so we assume it evaluates to true
+			ok, _, d := ci.BlockFilter(runnable, conductor, runnableId, depGraph, true)
+			if d.HasErrors() {
+				logger.Warnf("could not determine if %s would run: %s", runnableId, d.Error())
+				continue
+			}
+			selection[runnableId] = ok
+		}
+	}
+
+	export := ci.NewGraphExport(depGraph, ci.GraphExportConfig{
+		HideInternal: graphCfg.HideInternal,
+		Collapse:     graphCfg.Collapse,
+		Selection:    selection,
+	})
+	out, err := export.Render(graphCfg.Format)
+	if err != nil {
+		return err
+	}
+	fmt.Print(out)
+	return nil
+}
@@ -1,29 +1,130 @@
 package orchestra
 
 import (
+	"encoding/json"
 	"fmt"
-	"github.com/hashicorp/hcl/v2"
+	"github.com/srevinsaju/togomak/v1/internal/blocks"
 	"github.com/srevinsaju/togomak/v1/internal/ci"
 	"github.com/srevinsaju/togomak/v1/internal/ui"
 	"os"
+	"path/filepath"
+	"strings"
 )
 
-func List(cfg ci.ConductorConfig) error {
+type ListConfig struct {
+	// Type only lists the blocks of the given type
+	Type string
+
+	// Phase only lists the stages and modules which run in the given lifecycle phase
+	Phase string
+
+	JSON bool
+}
+
+func listItemString(item ci.ListItem, cwd string) string {
+	var attrs []string
+	if item.Description != "" {
+		attrs = append(attrs, item.Description)
+	}
+	if item.VariableType != "" {
+		attrs = append(attrs, fmt.Sprintf("type=%s", item.VariableType))
+	}
+	if item.Default != "" {
+		attrs = append(attrs, fmt.Sprintf("default=%s", item.Default))
+	}
+	if item.Sensitive {
+		attrs = append(attrs, "sensitive")
+	}
+	if item.Source != "" && item.Type != ci.ImportBlock {
+		attrs = append(attrs, fmt.Sprintf("source=%s", item.Source))
+	}
+	if len(item.Phases) != 0 {
+		attrs = append(attrs, fmt.Sprintf("phases=%s", strings.Join(item.Phases, ",")))
+	}
+	if item.Daemon {
+		attrs = append(attrs, ui.Magenta("daemon"))
+	}
+
+	s := ui.Bold(item.Address)
+	if len(attrs) != 0 {
+		s = fmt.Sprintf("%s %s", s, strings.Join(attrs, " "))
+	}
+	if item.Filename != "" {
+		filename := item.Filename
+		if rel, err := filepath.Rel(cwd, filename); err == nil && !strings.HasPrefix(rel, "..") {
+			filename = rel
+		}
+		s = fmt.Sprintf("%s %s", s, ui.Grey(fmt.Sprintf("%s:%d", filename, item.Line)))
+	}
+	return s
+}
+
+func List(cfg ci.ConductorConfig, listCfg ListConfig) error {
 
 	conductor := ci.NewConductor(cfg)
+	defer conductor.Destroy()
 	logger := conductor.Logger()
 
-	dgwriter := hcl.NewDiagnosticTextWriter(os.Stdout, conductor.Parser.Files(), 0, true)
 	pipe, hclDiags := ci.Read(conductor)
 	if hclDiags.HasErrors() {
-		logger.Fatal(dgwriter.WriteDiagnostics(hclDiags))
+		logger.Fatal(conductor.DiagWriter.WriteDiagnostics(hclDiags))
 	}
 
-	pipe, d := pipe.ExpandImports(conductor, conductor.Config.Paths.Cwd)
+	pipe, d := ci.ExpandImports(conductor, pipe, conductor.Config.Paths)
 	hclDiags = hclDiags.Extend(d)
+	if hclDiags.HasErrors() {
+		logger.Fatal(conductor.DiagWriter.WriteDiagnostics(hclDiags))
+	}
+
+	locals, d := pipe.Locals.Expand()
+	hclDiags = hclDiags.Extend(d)
+	if hclDiags.HasErrors() {
+		logger.Fatal(conductor.DiagWriter.WriteDiagnostics(hclDiags))
+	}
+	pipe.Local = locals
+
+	ty := listCfg.Type
+	if ty == blocks.VarBlock {
+		ty = blocks.VariableBlock
+	}
+	var items ci.ListItems
+	for _, item := range pipe.List(conductor) {
+		if ty != "" && item.Type != ty {
+			continue
+		}
+		if listCfg.Phase != "" && !item.HasPhase(listCfg.Phase) {
+			continue
+		}
+		items = append(items, item)
+	}
 
-	for _, stage := range pipe.Stages {
-		fmt.Println(ui.Bold(stage.Id))
+	if listCfg.JSON {
+		if items == nil {
+			items = ci.ListItems{}
+		}
+		data, err := json.MarshalIndent(items, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		cwd = conductor.Config.Paths.Cwd
+	}
+	group := ""
+	for _, item := range items {
+		if item.Import != group {
+			group = item.Import
+			fmt.Println()
+			fmt.Println(ui.Blue(fmt.Sprintf("import %q", group)))
+		}
+		if group != "" {
+			fmt.Print("  ")
+		}
+		fmt.Println(listItemString(item, cwd))
 	}
 	return nil
 
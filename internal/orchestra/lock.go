@@ -0,0 +1,43 @@
+package orchestra
+
+import (
+	"fmt"
+	"github.com/srevinsaju/togomak/v1/internal/ci"
+	"github.com/srevinsaju/togomak/v1/internal/lockfile"
+	"github.com/srevinsaju/togomak/v1/internal/ui"
+)
+
+// Lock fetches the remote sources of the imports and the modules of the pipeline, and
+// replaces the lock file with their resolved commits and hashes. It returns the exit
+// code of the process
+func Lock(cfg ci.ConductorConfig) int {
+	conductor := ci.NewConductor(cfg)
+	defer conductor.Destroy()
+	ExpandGlobalParams(conductor)
+
+	pipe, diags := ci.Read(conductor)
+	if diags.HasErrors() {
+		_ = conductor.DiagWriter.WriteDiagnostics(diags)
+		return 1
+	}
+
+	path := ci.LockFile(conductor.Config.Paths)
+	lock := lockfile.New(path)
+	conductor.Update(ci.ConductorWithLock(lock))
+	diags = diags.Extend(ci.FetchSources(conductor, pipe))
+	_ = conductor.DiagWriter.WriteDiagnostics(diags)
+	if diags.HasErrors() {
+		return 1
+	}
+
+	if err := lock.Write(); err != nil {
+		ui.Error(fmt.Sprintf("failed to write %s: %s", path, err))
+		return 1
+	}
+	sources := lock.Sources()
+	for _, source := range sources {
+		fmt.Printf("%s  %s\n", ui.Bold(source.Resolved), ui.Grey(source.Hash))
+	}
+	ui.Success("locked %d source(s) in %s", len(sources), path)
+	return 0
+}
@@ -0,0 +1,147 @@
+package orchestra
+
+import (
+	"context"
+	"fmt"
+	"github.com/srevinsaju/togomak/v1/internal/ci"
+	"github.com/srevinsaju/togomak/v1/internal/runlog"
+	"github.com/srevinsaju/togomak/v1/internal/ui"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type LogsConfig struct {
+	// Run is the id, or a prefix of the id, of the run. The latest run is used if it is empty
+	Run string
+
+	// Stage only shows the logs of the stages which match it, see runlog.Matches
+	Stage string
+
+	// Follow writes the logs as they are written, until the run finishes
+	Follow bool
+
+	// Tail only shows the last lines of the log of each stage, if it is not zero
+	Tail int
+}
+
+func runStatus(status string, alive bool) string {
+	switch {
+	case status == runlog.StatusRunning && !alive:
+		return ui.Yellow("stopped")
+	case status == runlog.StatusRunning:
+		return ui.Blue(status)
+	case status == runlog.StatusSuccess:
+		return ui.Green(status)
+	}
+	return ui.Red(status)
+}
+
+func listRuns(root string) int {
+	runs, err := runlog.List(root)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, ui.Red(err.Error()))
+		return 1
+	}
+	if len(runs) == 0 {
+		fmt.Fprintf(os.Stderr, "no runs were recorded in %s\n", root)
+		return 0
+	}
+	for _, run := range runs {
+		alive := run.Alive()
+		duration := time.Since(run.Started)
+		if run.Finished != nil {
+			duration = run.Finished.Sub(run.Started)
+		}
+		failed := 0
+		for _, status := range run.Stages {
+			if status == runlog.StatusFailure {
+				failed++
+			}
+		}
+		stages := fmt.Sprintf("%d stages", len(run.Stages))
+		if failed != 0 {
+			stages = fmt.Sprintf("%s, %s", stages, ui.Red(fmt.Sprintf("%d failed", failed)))
+		}
+		fmt.Printf("%s  %-17s  %s  %s  %s\n",
+			ui.Bold(run.Id), runStatus(run.Status, alive),
+			run.Started.Local().Format(time.DateTime), ui.Grey(duration.Round(time.Millisecond).String()), stages)
+	}
+	return 0
+}
+
+func listStages(root string, run runlog.Run) {
+	for _, address := range run.Addresses() {
+		size := ""
+		if info, err := os.Stat(filepath.Join(root, run.Id, runlog.LogFileName(address))); err == nil {
+			size = ui.Grey(fmt.Sprintf("%d bytes", info.Size()))
+		}
+		fmt.Printf("%-17s  %s  %s\n", runStatus(run.Stages[address], run.Alive()), ui.Bold(address), size)
+	}
+}
+
+// tail returns the last n lines of s, or s if n is zero
+func tail(s string, n int) string {
+	if n <= 0 {
+		return s
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "")
+}
+
+// Logs lists the recorded runs, the stages of a run, or shows the logs of its stages
+func Logs(cfg ci.ConductorConfig, logsCfg LogsConfig) int {
+	conductor := ci.NewConductor(cfg)
+	defer conductor.Destroy()
+	root := runlog.Dir(conductor.Config.Paths.Cwd)
+
+	if logsCfg.Run == "" && logsCfg.Stage == "" && !logsCfg.Follow {
+		return listRuns(root)
+	}
+
+	run, err := runlog.Find(root, logsCfg.Run)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, ui.Red(err.Error()))
+		return 1
+	}
+
+	addresses := run.Match(logsCfg.Stage)
+	if logsCfg.Follow {
+		// a single stage is followed as it is, the lines of many stages are prefixed with their address
+		prefix := logsCfg.Stage == "" || len(addresses) != 1
+		err = runlog.Follow(context.Background(), root, run.Id, logsCfg.Stage, os.Stdout, prefix, 250*time.Millisecond)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, ui.Red(err.Error()))
+			return 1
+		}
+		return 0
+	}
+
+	if logsCfg.Stage == "" {
+		listStages(root, run)
+		return 0
+	}
+	if len(addresses) == 0 {
+		fmt.Fprintf(os.Stderr, "%s\n", ui.Red(fmt.Sprintf("no stage of run %s matches %s", run.Id, logsCfg.Stage)))
+		return 1
+	}
+	for _, address := range addresses {
+		data, err := os.ReadFile(filepath.Join(root, run.Id, runlog.LogFileName(address)))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, ui.Red(err.Error()))
+			return 1
+		}
+		if len(addresses) > 1 {
+			fmt.Println(ui.Grey("── ") + ui.Bold(address))
+		}
+		fmt.Print(tail(string(data), logsCfg.Tail))
+	}
+	return 0
+}
@@ -0,0 +1,89 @@
+package orchestra
+
+import (
+	"context"
+	"errors"
+	"github.com/srevinsaju/togomak/v1/internal/ci"
+	"github.com/srevinsaju/togomak/v1/internal/metrics"
+	"net"
+	"net/http"
+	"path/filepath"
+	"time"
+)
+
+// metricsShutdownTimeout is how long togomak waits for the scrapes in progress to finish
+const metricsShutdownTimeout = 5 * time.Second
+
+// metricsPipeline is the value of the pipeline label of the metrics
+func metricsPipeline(conductor *ci.Conductor) string {
+	paths := conductor.Config.Paths
+	if filepath.IsAbs(paths.Pipeline) {
+		return paths.Pipeline
+	}
+	return filepath.Join(paths.Owd, paths.Pipeline)
+}
+
+// StartMetrics records the metrics of the runs of the conductor, and serves them on
+// metrics.Config.Listen. The returned function stops the server, and must be called
+// once togomak exits. The child processes do not record metrics, as their stages
+// are recorded by the parent process
+func StartMetrics(conductor *ci.Conductor) func() {
+	cfg := conductor.Config.Pipeline.Metrics
+	if !cfg.Enabled() || conductor.Config.Behavior.Child.Enabled {
+		return func() {}
+	}
+	logger := conductor.Logger().WithField("orchestra", "metrics")
+	if conductor.Metrics() == nil {
+		conductor.Update(ci.ConductorWithMetrics(metrics.New(metricsPipeline(conductor))))
+	}
+	if cfg.Listen == "" {
+		return func() {}
+	}
+
+	listener, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		logger.Warnf("failed to serve the metrics on %s: %s", cfg.Listen, err)
+		return func() {}
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", conductor.Metrics().Handler())
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Warnf("failed to serve the metrics on %s: %s", cfg.Listen, err)
+		}
+	}()
+	logger.Infof("serving the metrics on http://%s/metrics", listener.Addr())
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), metricsShutdownTimeout)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+	}
+}
+
+// ExportMetrics writes the metrics recorded so far to metrics.Config.Textfile, and pushes
+// them to metrics.Config.Pushgateway. It is called at the end of every run
+func ExportMetrics(conductor *ci.Conductor) {
+	cfg := conductor.Config.Pipeline.Metrics
+	m := conductor.Metrics()
+	if m == nil {
+		return
+	}
+	logger := conductor.Logger().WithField("orchestra", "metrics")
+
+	if cfg.Textfile != "" {
+		if err := m.WriteTextfile(cfg.Textfile); err != nil {
+			logger.Warnf("failed to write the metrics to %s: %s", cfg.Textfile, err)
+		} else {
+			logger.Debugf("metrics written to %s", cfg.Textfile)
+		}
+	}
+	if cfg.Pushgateway != "" {
+		if err := m.Push(cfg.Pushgateway); err != nil {
+			logger.Warnf("failed to push the metrics to %s: %s", cfg.Pushgateway, err)
+		} else {
+			logger.Debugf("metrics pushed to %s", cfg.Pushgateway)
+		}
+	}
+}
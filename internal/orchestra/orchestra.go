@@ -36,6 +36,8 @@ func Perform(conductor *ci.Conductor) int {
 	ctx, cancel := context.WithCancel(conductor.Context())
 	defer cancel()
 	conductor.Update(ci.ConductorWithContext(ctx))
+	defer StartTracing(conductor)()
+	defer StartMetrics(conductor)()
 
 	logger := conductor.Logger().WithField("orchestra", "perform")
 	logger.Debugf("starting watchdogs and signal handlers")
@@ -46,10 +48,25 @@ func Perform(conductor *ci.Conductor) int {
 	if hclDiags.HasErrors() {
 		logger.Fatal(conductor.DiagWriter.WriteDiagnostics(hclDiags))
 	}
+	hclDiags = ci.AttachLoggingSinks(conductor, pipe)
+	if hclDiags.HasErrors() {
+		logger.Fatal(conductor.DiagWriter.WriteDiagnostics(hclDiags))
+	}
+
+	if conductor.Config.Interface.TUI {
+		if reason := tuiUnavailable(conductor); reason != "" {
+			logger.Infof("the terminal UI is not available %s, falling back to logs", reason)
+		} else {
+			return PerformTUI(conductor, pipe, cancel)
+		}
+	}
 
 	h, d := pipe.Run(conductor)
+	WriteProfile(conductor, h)
+	ExportMetrics(conductor)
 	if d.HasErrors() {
 		return h.Fatal()
 	}
+	printOutputs(conductor)
 	return h.Ok()
 }
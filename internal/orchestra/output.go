@@ -0,0 +1,101 @@
+package orchestra
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/srevinsaju/togomak/v1/internal/ci"
+	"github.com/srevinsaju/togomak/v1/internal/runlog"
+	"github.com/srevinsaju/togomak/v1/internal/ui"
+	"os"
+)
+
+type OutputConfig struct {
+	// Run is the id, or a prefix of the id, of the run. The latest run with outputs is used if it is empty
+	Run string
+
+	// Name only shows the output with this name
+	Name string
+
+	// JSON writes the outputs as json
+	JSON bool
+}
+
+// printOutputs prints the outputs of the pipeline at the end of a successful run. The child
+// processes leave them to their parent
+func printOutputs(conductor *ci.Conductor) {
+	outputs := conductor.OutputValues()
+	if len(outputs) == 0 || conductor.Config.Behavior.Child.Enabled {
+		return
+	}
+	fmt.Printf("\n%s\n\n%s", ui.Bold("Outputs:"), outputs)
+}
+
+// findOutputs returns the run with the given id, or the latest run which recorded outputs
+func findOutputs(root string, query string) (runlog.Run, error) {
+	if query != "" && query != "latest" {
+		return runlog.Find(root, query)
+	}
+	runs, err := runlog.List(root)
+	if err != nil {
+		return runlog.Run{}, err
+	}
+	for i := len(runs) - 1; i >= 0; i-- {
+		if len(runs[i].Outputs) != 0 {
+			return runs[i], nil
+		}
+	}
+	return runlog.Run{}, fmt.Errorf("no run recorded outputs in %s", root)
+}
+
+// Output shows the outputs recorded with a run of the pipeline. The sensitive values are redacted,
+// unless a single output is requested by its name
+func Output(cfg ci.ConductorConfig, outputCfg OutputConfig) int {
+	conductor := ci.NewConductor(cfg)
+	defer conductor.Destroy()
+	root := runlog.Dir(conductor.Config.Paths.Cwd)
+
+	run, err := findOutputs(root, outputCfg.Run)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, ui.Red(err.Error()))
+		return 1
+	}
+	outputs, err := ci.OutputValuesFromRun(run)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, ui.Red(err.Error()))
+		return 1
+	}
+
+	if outputCfg.Name == "" {
+		if outputCfg.JSON {
+			data, err := json.MarshalIndent(ci.RedactOutputs(run.Outputs), "", "  ")
+			if err != nil {
+				fmt.Fprintln(os.Stderr, ui.Red(err.Error()))
+				return 1
+			}
+			fmt.Println(string(data))
+			return 0
+		}
+		fmt.Print(outputs)
+		return 0
+	}
+
+	for _, output := range outputs {
+		if output.Name != outputCfg.Name {
+			continue
+		}
+		if outputCfg.JSON {
+			var b bytes.Buffer
+			if err := json.Indent(&b, run.Outputs[output.Name].Value, "", "  "); err != nil {
+				fmt.Fprintln(os.Stderr, ui.Red(err.Error()))
+				return 1
+			}
+			fmt.Println(b.String())
+			return 0
+		}
+		fmt.Println(output.Raw())
+		return 0
+	}
+	fmt.Fprintln(os.Stderr, ui.Red(fmt.Sprintf("run %s has no output %s", run.Id, outputCfg.Name)))
+	return 1
+}
@@ -0,0 +1,86 @@
+package orchestra
+
+import (
+	"fmt"
+	"github.com/srevinsaju/togomak/v1/internal/ci"
+	"github.com/srevinsaju/togomak/v1/internal/runnable"
+	"github.com/srevinsaju/togomak/v1/internal/ui"
+)
+
+func planDecisionColor(decision string, text string) string {
+	switch decision {
+	case ci.PlanDecisionRun:
+		return ui.Green(text)
+	case ci.PlanDecisionSkip:
+		return ui.Grey(text)
+	case ci.PlanDecisionOverridden:
+		return ui.Blue(text)
+	case ci.PlanDecisionDaemon:
+		return ui.Magenta(text)
+	}
+	return text
+}
+
+// Plan prints every runnable of the pipeline, whether it would run with the filters,
+// queries and lifecycle phases passed on the command line, and the rule which decided it.
+// Nothing is run.
+func Plan(cfg ci.ConductorConfig) int {
+	conductor := ci.NewConductor(cfg)
+	defer conductor.Destroy()
+	logger := conductor.Logger()
+	ExpandGlobalParams(conductor)
+
+	pipe, diags := ci.Read(conductor)
+	if diags.HasErrors() {
+		logger.Fatal(conductor.DiagWriter.WriteDiagnostics(diags))
+	}
+
+	pipe, d := ci.ExpandImports(conductor, pipe, conductor.Config.Paths)
+	diags = diags.Extend(d)
+	if diags.HasErrors() {
+		logger.Fatal(conductor.DiagWriter.WriteDiagnostics(diags))
+	}
+
+	locals, d := pipe.Locals.Expand()
+	diags = diags.Extend(d)
+	if diags.HasErrors() {
+		logger.Fatal(conductor.DiagWriter.WriteDiagnostics(diags))
+	}
+	pipe.Local = locals
+
+	depGraph, d := ci.GraphTopoSort(conductor, pipe)
+	diags = diags.Extend(d)
+	if diags.HasErrors() {
+		logger.Fatal(conductor.DiagWriter.WriteDiagnostics(diags))
+	}
+
+	plan, d := pipe.Plan(conductor, depGraph,
+		runnable.WithBehavior(conductor.Config.Behavior),
+		runnable.WithPaths(conductor.Config.Paths),
+	)
+	diags = diags.Extend(d)
+
+	width := len("RUNNABLE")
+	for _, entry := range plan {
+		if len(entry.Id) > width {
+			width = len(entry.Id)
+		}
+	}
+
+	// text/tabwriter does not handle the escape codes of the colored decisions,
+	// so the columns are padded before they are colored
+	counts := make(map[string]int)
+	fmt.Printf("%-*s  %-10s  %s\n", width, "RUNNABLE", "DECISION", "RULE")
+	for _, entry := range plan {
+		counts[entry.Decision]++
+		fmt.Printf("%-*s  %s  %s\n", width, entry.Id, planDecisionColor(entry.Decision, fmt.Sprintf("%-10s", entry.Decision)), entry.Rule)
+	}
+	fmt.Printf("\n%d to run, %d overridden, %d daemons, %d skipped\n",
+		counts[ci.PlanDecisionRun], counts[ci.PlanDecisionOverridden], counts[ci.PlanDecisionDaemon], counts[ci.PlanDecisionSkip])
+
+	if diags.HasErrors() {
+		_ = conductor.DiagWriter.WriteDiagnostics(diags)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,72 @@
+package orchestra
+
+import (
+	"context"
+	"fmt"
+	"github.com/srevinsaju/togomak/v1/internal/ci"
+	"github.com/srevinsaju/togomak/v1/internal/meta"
+	"github.com/srevinsaju/togomak/v1/internal/profile"
+	"github.com/srevinsaju/togomak/v1/internal/ui"
+	"strings"
+	"time"
+)
+
+// traceShutdownTimeout is how long togomak waits for the remaining spans to be exported
+const traceShutdownTimeout = 5 * time.Second
+
+// StartTracing exports the spans of the run to the OpenTelemetry collector set with
+// ConfigPipeline.Trace. The returned function exports the remaining spans, and must be
+// called once the run finishes
+func StartTracing(conductor *ci.Conductor) func() {
+	cfg := conductor.Config.Pipeline.Trace
+	if cfg.Endpoint == "" {
+		return func() {}
+	}
+	logger := conductor.Logger().WithField("orchestra", "trace")
+
+	provider, err := profile.NewTracerProvider(conductor.Context(), cfg)
+	if err != nil {
+		logger.Warnf("failed to export traces to %s: %s", cfg.Endpoint, err)
+		return func() {}
+	}
+	if conductor.Profiler() == nil {
+		conductor.Update(ci.ConductorWithProfiler(profile.New()))
+	}
+	conductor.Profiler().Trace(provider.Tracer(meta.AppName))
+	logger.Debugf("exporting traces to %s", cfg.Endpoint)
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), traceShutdownTimeout)
+		defer cancel()
+		if err := provider.Shutdown(ctx); err != nil {
+			logger.Warnf("failed to export traces to %s: %s", cfg.Endpoint, err)
+		}
+	}
+}
+
+// WriteProfile writes the Chrome trace-event profile recorded during the run, and
+// prints the critical path through the dependency graph of the pipeline
+func WriteProfile(conductor *ci.Conductor, h *ci.Handler) {
+	path := conductor.Config.Pipeline.Profile
+	profiler := conductor.Profiler()
+	if path == "" || profiler == nil {
+		return
+	}
+	logger := conductor.Logger().WithField("orchestra", "profile")
+
+	steps, total := profiler.CriticalPath(h.Graph)
+	if len(steps) > 0 {
+		var s []string
+		for _, step := range steps {
+			s = append(s, fmt.Sprintf("%s %s", step.Id, ui.Grey(fmt.Sprintf("(%s)", step.Duration.Round(time.Millisecond)))))
+		}
+		logger.Infof("critical path %s: %s", ui.Bold(total.Round(time.Millisecond)), strings.Join(s, " → "))
+	}
+
+	err := profiler.Write(path)
+	if err != nil {
+		logger.Warnf("failed to write profile to %s: %s", path, err)
+		return
+	}
+	logger.Infof("profile written to %s, open it with chrome://tracing or https://ui.perfetto.dev", path)
+}
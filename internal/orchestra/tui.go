@@ -0,0 +1,90 @@
+package orchestra
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/mattn/go-isatty"
+	"github.com/sirupsen/logrus"
+	"github.com/srevinsaju/togomak/v1/internal/ci"
+	"github.com/srevinsaju/togomak/v1/internal/dg"
+	"github.com/srevinsaju/togomak/v1/internal/tui"
+	"io"
+	"os"
+)
+
+// tuiUnavailable returns why the terminal UI cannot be shown, or an empty string if it can
+func tuiUnavailable(conductor *ci.Conductor) string {
+	cfg := conductor.Config
+	switch {
+	case cfg.Behavior.Ci:
+		return "in CI"
+	case cfg.Behavior.Unattended:
+		return "in unattended mode"
+	case cfg.Interface.JSONLogging:
+		return "with json logging"
+	case cfg.Pipeline.DryRun:
+		return "in dry run mode"
+	case cfg.Behavior.Child.Enabled:
+		return "in child processes"
+	case !isatty.IsTerminal(os.Stdout.Fd()) || !isatty.IsTerminal(os.Stdin.Fd()):
+		return "when the output is not a terminal"
+	}
+	if _, ok := conductor.RootLogger.(*logrus.Logger); !ok {
+		return "with this logger"
+	}
+	return ""
+}
+
+// PerformTUI runs the pipeline, showing the terminal UI instead of the logs. The logs are
+// restored, and the diagnostics are written, once the user quits the UI. If the user quits
+// before the pipeline finishes, the pipeline is cancelled.
+// It returns the exit code of the process
+func PerformTUI(conductor *ci.Conductor, pipe *ci.Pipeline, cancel context.CancelFunc) int {
+	logger := conductor.RootLogger.(*logrus.Logger)
+	out := logger.Out
+
+	hooks := make(logrus.LevelHooks)
+	for level, h := range logger.Hooks {
+		hooks[level] = append(hooks[level], h...)
+	}
+
+	ui := tui.New(conductor, cancel)
+	var diagnostics bytes.Buffer
+	logger.SetOutput(io.Discard)
+	logger.AddHook(ui)
+	conductor.Update(
+		ci.ConductorWithObserver(ui),
+		ci.ConductorWithOutput(io.Discard),
+		ci.ConductorWithDiagWriter(hcl.NewDiagnosticTextWriter(&diagnostics, conductor.Parser.Files(), 0, true)),
+	)
+
+	type result struct {
+		h *ci.Handler
+		d dg.AbstractDiagnostics
+	}
+	done := make(chan result, 1)
+	go func() {
+		h, d := pipe.Run(conductor)
+		ui.Done(d.HasErrors())
+		done <- result{h, d}
+	}()
+
+	err := ui.Run()
+	logger.ReplaceHooks(hooks)
+	logger.SetOutput(out)
+	if err != nil {
+		logger.Warnf("terminal UI failed: %s", err)
+	}
+
+	r := <-done
+	fmt.Print(diagnostics.String())
+	WriteProfile(conductor, r.h)
+	ExportMetrics(conductor)
+	if r.d.HasErrors() {
+		return r.h.Fatal()
+	}
+	printOutputs(conductor)
+	return r.h.Ok()
+}
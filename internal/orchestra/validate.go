@@ -0,0 +1,77 @@
+package orchestra
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/srevinsaju/togomak/v1/internal/ci"
+	"github.com/srevinsaju/togomak/v1/internal/dg"
+	"github.com/srevinsaju/togomak/v1/internal/ui"
+)
+
+type validateResult struct {
+	Valid        bool                `json:"valid"`
+	ErrorCount   int                 `json:"error_count"`
+	WarningCount int                 `json:"warning_count"`
+	Diagnostics  []dg.JSONDiagnostic `json:"diagnostics"`
+}
+
+func validate(conductor *ci.Conductor) hcl.Diagnostics {
+	pipe, diags := ci.Read(conductor)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	pipe, d := ci.ExpandLocalImports(conductor, pipe, conductor.Config.Paths.Cwd)
+	diags = diags.Extend(d)
+	if d.HasErrors() {
+		return diags
+	}
+
+	locals, d := pipe.Locals.Expand()
+	diags = diags.Extend(d)
+	if d.HasErrors() {
+		return diags
+	}
+	pipe.Local = locals
+
+	diags = diags.Extend(pipe.Validate(conductor))
+
+	_, d = ci.GraphTopoSort(conductor, pipe)
+	diags = diags.Extend(d)
+	return diags
+}
+
+// Validate statically checks the pipeline without running any stage, data provider or
+// fetching remote sources. It returns the exit code of the process
+func Validate(cfg ci.ConductorConfig, jsonOutput bool) int {
+	conductor := ci.NewConductor(cfg)
+	defer conductor.Destroy()
+	ExpandGlobalParams(conductor)
+
+	diags := validate(conductor)
+
+	if jsonOutput {
+		result := validateResult{
+			Valid:        !diags.HasErrors(),
+			ErrorCount:   len(diags.Errs()),
+			WarningCount: len(diags) - len(diags.Errs()),
+			Diagnostics:  dg.NewJSONDiagnostics(diags),
+		}
+		data, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			panic(err)
+		}
+		fmt.Println(string(data))
+	} else {
+		_ = conductor.DiagWriter.WriteDiagnostics(diags)
+		if !diags.HasErrors() {
+			ui.Success("the configuration is valid")
+		}
+	}
+
+	if diags.HasErrors() {
+		return 1
+	}
+	return 0
+}
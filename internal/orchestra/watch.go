@@ -0,0 +1,378 @@
+package orchestra
+
+import (
+	"context"
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/kendru/darwin/go/depgraph"
+	"github.com/sirupsen/logrus"
+	"github.com/srevinsaju/togomak/v1/internal/blocks"
+	"github.com/srevinsaju/togomak/v1/internal/ci"
+	"github.com/srevinsaju/togomak/v1/internal/metrics"
+	"github.com/srevinsaju/togomak/v1/internal/rules"
+	"github.com/srevinsaju/togomak/v1/internal/runnable"
+	"github.com/srevinsaju/togomak/v1/internal/ui"
+	"github.com/srevinsaju/togomak/v1/internal/x"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+type WatchConfig struct {
+	// Debounce is how long togomak waits for more changes, before the
+	// affected stages are rerun
+	Debounce time.Duration
+}
+
+// watchIteration is a single run of the pipeline in watch mode
+type watchIteration struct {
+	id        int
+	selection []string
+	daemons   []string
+	cancel    context.CancelCauseFunc
+	done      chan struct{}
+}
+
+func (it *watchIteration) finished() bool {
+	select {
+	case <-it.done:
+		return true
+	default:
+		return false
+	}
+}
+
+type watcher struct {
+	cfg    ci.ConductorConfig
+	logger logrus.Ext1FieldLogger
+
+	// selection are the stages and modules selected by the filters
+	// passed on the command line, only they are rerun
+	selection  map[string]bool
+	daemons    map[string]bool
+	order      []string
+	iterations []*watchIteration
+	counter    int
+
+	// metrics are shared by the iterations, so that they are served on the same endpoint
+	metrics *metrics.Metrics
+}
+
+// watchIgnored reports if changes to path, relative to the working directory, are ignored.
+// Hidden files and directories, like .git, and node_modules are not watched
+func watchIgnored(path string) bool {
+	for _, part := range strings.Split(filepath.ToSlash(path), "/") {
+		if part == "node_modules" || (strings.HasPrefix(part, ".") && part != "." && part != "..") {
+			return true
+		}
+	}
+	return false
+}
+
+// watchDirs watches root and all the directories in it, fsnotify does not watch recursively
+func watchDirs(w *fsnotify.Watcher, cwd string, root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(cwd, path)
+		if err == nil && watchIgnored(rel) {
+			return filepath.SkipDir
+		}
+		return w.Add(path)
+	})
+}
+
+// plan reads the pipeline, and returns the stages and modules the filters passed on the
+// command line select, the dependency graph, and the stages with a watch pattern matching paths
+func (w *watcher) plan(paths []string) (map[string]bool, map[string]bool, *depgraph.Graph, []string, bool, hcl.Diagnostics) {
+	conductor := ci.NewConductor(w.cfg)
+	defer conductor.Destroy()
+	ExpandGlobalParams(conductor)
+
+	pipe, diags := ci.Read(conductor)
+	if diags.HasErrors() {
+		return nil, nil, nil, nil, false, diags
+	}
+	pipe, d := ci.ExpandImports(conductor, pipe, conductor.Config.Paths)
+	diags = diags.Extend(d)
+	if diags.HasErrors() {
+		return nil, nil, nil, nil, false, diags
+	}
+	locals, d := pipe.Locals.Expand()
+	diags = diags.Extend(d)
+	if diags.HasErrors() {
+		return nil, nil, nil, nil, false, diags
+	}
+	pipe.Local = locals
+
+	depGraph, d := ci.GraphTopoSort(conductor, pipe)
+	diags = diags.Extend(d)
+	if diags.HasErrors() {
+		return nil, nil, nil, nil, false, diags
+	}
+
+	plan, d := pipe.Plan(conductor, depGraph,
+		runnable.WithBehavior(conductor.Config.Behavior),
+		runnable.WithPaths(conductor.Config.Paths),
+	)
+	diags = diags.Extend(d)
+	selection := make(map[string]bool)
+	daemons := make(map[string]bool)
+	for _, entry := range plan {
+		ty := strings.SplitN(entry.Id, ".", 2)[0]
+		if ty != blocks.StageBlock && ty != blocks.ModuleBlock {
+			continue
+		}
+		switch entry.Decision {
+		case ci.PlanDecisionDaemon:
+			daemons[entry.Id] = true
+			selection[entry.Id] = true
+		case ci.PlanDecisionRun, ci.PlanDecisionOverridden:
+			selection[entry.Id] = true
+		}
+	}
+
+	// a change to the pipeline itself reruns everything
+	configChanged := false
+	for filename := range conductor.Parser.Files() {
+		rel, err := filepath.Rel(conductor.Config.Paths.Cwd, filename)
+		if err != nil {
+			continue
+		}
+		for _, path := range paths {
+			if filepath.Clean(path) == rel {
+				configChanged = true
+			}
+		}
+	}
+
+	matched, d := pipe.WatchMatches(conductor, paths)
+	diags = diags.Extend(d)
+	return selection, daemons, depGraph, matched, configChanged, diags
+}
+
+// start runs the selected stages and modules in the background. The first iteration
+// runs with the filters passed on the command line
+func (w *watcher) start(selection []string, reason string) {
+	w.counter++
+	ctx, cancel := context.WithCancelCause(context.Background())
+	it := &watchIteration{
+		id:        w.counter,
+		selection: selection,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+	for _, id := range selection {
+		if w.daemons[id] {
+			it.daemons = append(it.daemons, id)
+		}
+	}
+	w.iterations = append(w.iterations, it)
+
+	cfg := w.cfg
+	if it.id > 1 {
+		// the selection already has the stages and modules depending on the changed ones,
+		// the stages and modules they depend on are not rerun
+		var ops rules.Operations
+		for _, id := range selection {
+			ops = append(ops, rules.NewOperation(rules.OperationTypeAnd, id))
+		}
+		cfg.Pipeline.Filtered = ops
+		cfg.Pipeline.FilterQuery = nil
+		cfg.Pipeline.Exact = true
+	}
+
+	fmt.Println(ui.Bold(fmt.Sprintf("── iteration %d: %s", it.id, reason)))
+	go func() {
+		defer close(it.done)
+		conductor := ci.NewConductor(cfg, ci.ConductorWithContext(ctx), ci.ConductorWithMetrics(w.metrics))
+		defer conductor.Destroy()
+		logger := conductor.Logger().WithField("iteration", it.id)
+		conductor.Update(ci.ConductorWithLogger(logger))
+		defer StartTracing(conductor)()
+		ExpandGlobalParams(conductor)
+
+		pipe, diags := ci.Read(conductor)
+		if !diags.HasErrors() {
+			diags = diags.Extend(ci.AttachLoggingSinks(conductor, pipe))
+		}
+		if diags.HasErrors() {
+			_ = conductor.DiagWriter.WriteDiagnostics(diags)
+			return
+		}
+		h, d := pipe.Run(conductor)
+		ExportMetrics(conductor)
+		if ctx.Err() != nil {
+			logger.Infof("iteration %d stopped", it.id)
+			return
+		}
+		if d.HasErrors() {
+			h.Fatal()
+		} else {
+			h.Ok()
+		}
+		logger.Info(ui.Grey("waiting for changes"))
+	}()
+}
+
+// stop stops the iteration with cause, see ci.ErrWatchIterationStopped
+func (w *watcher) stop(it *watchIteration, cause error) {
+	it.cancel(cause)
+	<-it.done
+}
+
+// rerun reruns the stages with a watch pattern matching the changed paths, and the stages which
+// depend on them. The daemons which are affected are restarted, along with the daemons which
+// were started in the same iteration. The iterations without daemons which are still running
+// are stopped, and their stages are run again in the new iteration
+func (w *watcher) rerun(paths []string) {
+	selection, daemons, depGraph, matched, configChanged, diags := w.plan(paths)
+	if diags.HasErrors() {
+		_ = hcl.NewDiagnosticTextWriter(os.Stdout, nil, 0, true).WriteDiagnostics(diags)
+		w.logger.Warn("the pipeline could not be read, waiting for changes")
+		return
+	}
+	if len(diags) != 0 {
+		_ = hcl.NewDiagnosticTextWriter(os.Stdout, nil, 0, true).WriteDiagnostics(diags)
+	}
+	if configChanged {
+		w.selection, w.daemons = selection, daemons
+		matched = depGraph.TopoSorted()
+	}
+	w.order = depGraph.TopoSorted()
+
+	affected := make(map[string]bool)
+	for _, id := range ci.WatchAffected(depGraph, matched) {
+		if w.selection[id] {
+			affected[id] = true
+		}
+	}
+	if len(affected) == 0 {
+		w.logger.Debugf("no stage watches %s", strings.Join(paths, ", "))
+		return
+	}
+
+	var running []*watchIteration
+	for _, it := range w.iterations {
+		if it.finished() {
+			continue
+		}
+		restart := configChanged || len(it.daemons) == 0
+		for _, id := range it.daemons {
+			restart = restart || affected[id]
+		}
+		if !restart {
+			running = append(running, it)
+			continue
+		}
+		w.logger.Infof("stopping iteration %d", it.id)
+		w.stop(it, ci.ErrWatchIterationStopped)
+		rerun := it.daemons
+		if len(it.daemons) == 0 {
+			rerun = it.selection
+		}
+		for _, id := range rerun {
+			if w.selection[id] {
+				affected[id] = true
+			}
+		}
+	}
+	w.iterations = running
+
+	var rerun []string
+	for _, id := range w.order {
+		if affected[id] {
+			rerun = append(rerun, id)
+		}
+	}
+	reason := fmt.Sprintf("%s changed", strings.Join(paths, ", "))
+	if len(paths) > 3 {
+		reason = fmt.Sprintf("%s and %d more changed", strings.Join(paths[:3], ", "), len(paths)-3)
+	}
+	w.start(rerun, fmt.Sprintf("%s, running %s", reason, strings.Join(rerun, ", ")))
+}
+
+// Watch runs the pipeline, and reruns the stages whose watch patterns match the files which
+// changed, and the stages which depend on them, until it is interrupted.
+// It returns the exit code of the process
+func Watch(cfg ci.ConductorConfig, watchCfg WatchConfig) int {
+	conductor := ci.NewConductor(cfg)
+	defer conductor.Destroy()
+	logger := conductor.Logger().WithField("orchestra", "watch")
+	cwd := conductor.Config.Paths.Cwd
+
+	fsWatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logger.Errorf("failed to watch %s: %s", cwd, err)
+		return 1
+	}
+	defer fsWatcher.Close()
+	if err := watchDirs(fsWatcher, cwd, cwd); err != nil {
+		logger.Errorf("failed to watch %s: %s", cwd, err)
+		return 1
+	}
+
+	defer StartMetrics(conductor)()
+
+	w := &watcher{cfg: cfg, logger: logger, metrics: conductor.Metrics()}
+	selection, daemons, depGraph, _, _, diags := w.plan(nil)
+	if diags.HasErrors() {
+		logger.Fatal(hcl.NewDiagnosticTextWriter(os.Stdout, nil, 0, true).WriteDiagnostics(diags))
+	}
+	w.selection, w.daemons, w.order = selection, daemons, depGraph.TopoSorted()
+	var initial []string
+	for _, id := range w.order {
+		if w.selection[id] {
+			initial = append(initial, id)
+		}
+	}
+	w.start(initial, "starting")
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+
+	pending := make(map[string]bool)
+	var debounce <-chan time.Time
+	for {
+		select {
+		case event := <-fsWatcher.Events:
+			rel, err := filepath.Rel(cwd, event.Name)
+			if err != nil || watchIgnored(rel) || event.Op == fsnotify.Chmod {
+				continue
+			}
+			if event.Op.Has(fsnotify.Create) && x.IsDir(event.Name) {
+				if err := watchDirs(fsWatcher, cwd, event.Name); err != nil {
+					logger.Warnf("failed to watch %s: %s", rel, err)
+				}
+			}
+			pending[rel] = true
+			debounce = time.After(watchCfg.Debounce)
+
+		case err := <-fsWatcher.Errors:
+			logger.Warnf("watch error: %s", err)
+
+		case <-debounce:
+			debounce = nil
+			var paths []string
+			for path := range pending {
+				paths = append(paths, path)
+			}
+			sort.Strings(paths)
+			pending = make(map[string]bool)
+			w.rerun(paths)
+
+		case <-interrupt:
+			for _, it := range w.iterations {
+				w.stop(it, context.Canceled)
+			}
+			return 0
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package profile
+
+import (
+	"github.com/kendru/darwin/go/depgraph"
+	"sort"
+	"time"
+)
+
+// Step is a single runnable on the critical path
+type Step struct {
+	Id       string
+	Duration time.Duration
+}
+
+// CriticalPath returns the chain of dependent runnables in g which took the longest
+// wall time to complete, based on the durations recorded by the profiler.
+// Runnables which were not recorded (skipped, or internal nodes like togomak.root)
+// are considered to have taken no time, and are omitted from the result.
+func (p *Profiler) CriticalPath(g *depgraph.Graph) ([]Step, time.Duration) {
+	if p == nil || g == nil {
+		return nil, 0
+	}
+	durations := p.Durations()
+
+	total := make(map[string]time.Duration)
+	previous := make(map[string]string)
+
+	// g.TopoSorted guarantees that all the dependencies of a node are visited
+	// before the node itself
+	for _, node := range g.TopoSorted() {
+		var deps []string
+		for dep := range g.Dependencies(node) {
+			deps = append(deps, dep)
+		}
+		// the order of map iteration is random, sort it for a deterministic result
+		sort.Strings(deps)
+
+		var longest time.Duration
+		for _, dep := range deps {
+			if total[dep] > longest || (total[dep] == longest && previous[node] == "") {
+				longest = total[dep]
+				previous[node] = dep
+			}
+		}
+		total[node] = longest + durations[node]
+	}
+
+	var end string
+	var longest time.Duration
+	for node, d := range total {
+		if d > longest || (d == longest && node < end) {
+			end = node
+			longest = d
+		}
+	}
+
+	var path []Step
+	for node := end; node != ""; node = previous[node] {
+		if durations[node] == 0 {
+			continue
+		}
+		path = append([]Step{{Id: node, Duration: durations[node]}}, path...)
+	}
+	return path, longest
+}
@@ -0,0 +1,235 @@
+package profile
+
+import (
+	"context"
+	"fmt"
+	"github.com/srevinsaju/togomak/v1/internal/meta"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.20.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	OTLPProtocolGRPC = "grpc"
+	OTLPProtocolHTTP = "http/protobuf"
+)
+
+// OTLPConfig is the configuration of the OpenTelemetry exporter
+type OTLPConfig struct {
+	// Endpoint is the address of the collector, like http://localhost:4317. The connection
+	// is insecure if the scheme is http, and uses TLS otherwise. Tracing is disabled if it is empty
+	Endpoint string
+
+	// Protocol is either OTLPProtocolGRPC, which is the default, or OTLPProtocolHTTP
+	Protocol string
+}
+
+// NewTracerProvider creates a tracer provider which exports the spans to the collector
+// at cfg.Endpoint in batches. It must be shut down to export the remaining spans
+func NewTracerProvider(ctx context.Context, cfg OTLPConfig) (*sdktrace.TracerProvider, error) {
+	endpoint := cfg.Endpoint
+	insecure := false
+	path := ""
+	if strings.Contains(endpoint, "://") {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid otel endpoint %s: %w", endpoint, err)
+		}
+		endpoint = u.Host
+		insecure = u.Scheme == "http"
+		path = u.Path
+	}
+
+	var client otlptrace.Client
+	switch cfg.Protocol {
+	case "", OTLPProtocolGRPC:
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(endpoint)}
+		if insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		client = otlptracegrpc.NewClient(opts...)
+	case "http", OTLPProtocolHTTP:
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(endpoint)}
+		if insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		if path != "" && path != "/" {
+			opts = append(opts, otlptracehttp.WithURLPath(path))
+		}
+		client = otlptracehttp.NewClient(opts...)
+	default:
+		return nil, fmt.Errorf("unknown otel protocol %s, expected %s or %s", cfg.Protocol, OTLPProtocolGRPC, OTLPProtocolHTTP)
+	}
+
+	exporter, err := otlptrace.New(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceName(meta.AppName),
+			semconv.ServiceVersion(meta.AppVersion),
+		)),
+	), nil
+}
+
+// tracing exports the spans of a Profiler as OpenTelemetry spans. The span of a run is the
+// root of the trace, the spans of the runnables are its children, and the other spans on the
+// track of a runnable, like its retries, hooks and scripts, are the children of the runnable
+type tracing struct {
+	mu     sync.Mutex
+	tracer trace.Tracer
+
+	// remote is the trace context of the parent process, see Profiler.Environ
+	remote context.Context
+	run    context.Context
+
+	// runnables are the contexts of the spans of the runnables, by their track
+	runnables map[string]context.Context
+}
+
+// envCarrier maps the environment variables to the keys of the W3C trace context propagator
+var envCarrier = map[string]string{
+	"traceparent": "TRACEPARENT",
+	"tracestate":  "TRACESTATE",
+}
+
+// Trace exports the spans which start after it is called as OpenTelemetry spans of tracer.
+// The trace continues the trace of the parent process, if TRACEPARENT is set
+func (p *Profiler) Trace(tracer trace.Tracer) {
+	if p == nil {
+		return
+	}
+	carrier := propagation.MapCarrier{}
+	for key, env := range envCarrier {
+		if v := os.Getenv(env); v != "" {
+			carrier[key] = v
+		}
+	}
+	remote := propagation.TraceContext{}.Extract(context.Background(), carrier)
+
+	p.recorder.mu.Lock()
+	defer p.recorder.mu.Unlock()
+	p.recorder.tracing = &tracing{
+		tracer:    tracer,
+		remote:    remote,
+		run:       remote,
+		runnables: make(map[string]context.Context),
+	}
+}
+
+// parent returns the context of the parent of a span on track, in the scope of p
+func (t *tracing) parent(p *Profiler, category string, track string) context.Context {
+	if category == CategoryRun {
+		return t.remote
+	}
+	var candidates []string
+	if category != CategoryRunnable {
+		candidates = append(candidates, p.track(track))
+		// the instances of a runnable with for_each are recorded on tracks like stage.build[0]
+		if i := strings.Index(track, "["); i > 0 {
+			candidates = append(candidates, p.track(track[:i]))
+		}
+	}
+	// the runnables of a module are the children of the module
+	if p.scope != "" {
+		candidates = append(candidates, p.scope)
+	}
+	for _, candidate := range candidates {
+		if ctx, ok := t.runnables[candidate]; ok {
+			return ctx
+		}
+	}
+	return t.run
+}
+
+func (t *tracing) start(p *Profiler, category string, track string, name string, start time.Time) trace.Span {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ctx, span := t.tracer.Start(t.parent(p, category, track), name,
+		trace.WithTimestamp(start),
+		trace.WithAttributes(
+			attribute.String("togomak.category", category),
+			attribute.String("togomak.track", p.track(track)),
+		),
+	)
+	switch category {
+	case CategoryRun:
+		t.run = ctx
+	case CategoryRunnable:
+		t.runnables[p.track(track)] = ctx
+	}
+	return span
+}
+
+// Environ returns the TRACEPARENT and TRACESTATE environment variables of the span of the runnable
+// on track, which are passed to its processes, so that the child togomak processes join the trace
+func (p *Profiler) Environ(track string) []string {
+	if p == nil {
+		return nil
+	}
+	p.recorder.mu.Lock()
+	t := p.recorder.tracing
+	p.recorder.mu.Unlock()
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	ctx := t.parent(p, "", track)
+	t.mu.Unlock()
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	var env []string
+	for key, v := range carrier {
+		env = append(env, fmt.Sprintf("%s=%s", envCarrier[key], v))
+	}
+	return env
+}
+
+func attributeOf(key string, value any) attribute.KeyValue {
+	key = "togomak." + key
+	switch v := value.(type) {
+	case string:
+		return attribute.String(key, v)
+	case bool:
+		return attribute.Bool(key, v)
+	case int:
+		return attribute.Int(key, v)
+	case int64:
+		return attribute.Int64(key, v)
+	case float64:
+		return attribute.Float64(key, v)
+	case []string:
+		return attribute.StringSlice(key, v)
+	}
+	return attribute.String(key, fmt.Sprint(value))
+}
+
+// endOtel ends the OpenTelemetry span of s, which failed if it has the arg failed, or success set to false
+func (s *Span) endOtel(end time.Time) {
+	if s.otel == nil {
+		return
+	}
+	if failed, ok := s.args["failed"].(bool); ok && failed {
+		s.otel.SetStatus(codes.Error, "failed")
+	}
+	if success, ok := s.args["success"].(bool); ok && !success {
+		s.otel.SetStatus(codes.Error, "failed")
+	}
+	s.otel.End(trace.WithTimestamp(end))
+}
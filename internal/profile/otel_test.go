@@ -0,0 +1,60 @@
+package profile
+
+import (
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"strings"
+	"testing"
+)
+
+func TestProfiler_Trace(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	t.Setenv("TRACEPARENT", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	p := New()
+	p.Trace(provider.Tracer("togomak"))
+
+	run := p.Start(CategoryRun, TrackOrchestra, "run")
+	build := p.Start(CategoryRunnable, "stage.build", "stage.build").SetArg("phases", []string{"build"})
+	p.Start(CategoryRetry, "stage.build", "retry 1").SetArg("success", false).End()
+	p.Start(CategoryScript, "stage.build[0]", "script").SetArg("exit_code", 2).End()
+	build.SetArg("failed", true).End()
+
+	module := p.Start(CategoryRunnable, "module.api", "module.api")
+	scoped := p.Scope("module.api")
+	scoped.Start(CategoryRunnable, "stage.test", "stage.test").End()
+	env := scoped.Environ("stage.test")
+	module.End()
+	run.End()
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	assert.Len(t, spans, 6)
+
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans["run"].SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", spans["run"].Parent().SpanID().String())
+	assert.Equal(t, spans["run"].SpanContext().SpanID(), spans["stage.build"].Parent().SpanID())
+	assert.Equal(t, spans["stage.build"].SpanContext().SpanID(), spans["retry 1"].Parent().SpanID())
+	assert.Equal(t, spans["stage.build"].SpanContext().SpanID(), spans["script"].Parent().SpanID())
+	assert.Equal(t, spans["module.api"].SpanContext().SpanID(), spans["stage.test"].Parent().SpanID())
+
+	assert.Equal(t, codes.Error, spans["stage.build"].Status().Code)
+	assert.Equal(t, codes.Error, spans["retry 1"].Status().Code)
+	assert.Equal(t, codes.Unset, spans["script"].Status().Code)
+	assert.Contains(t, spans["script"].Attributes(), attributeOf("exit_code", 2))
+	assert.Contains(t, spans["stage.build"].Attributes(), attributeOf("phases", []string{"build"}))
+
+	assert.Len(t, env, 1)
+	assert.True(t, strings.HasPrefix(env[0], "TRACEPARENT=00-4bf92f3577b34da6a3ce929d0e0e4736-"+spans["stage.test"].SpanContext().SpanID().String()))
+}
+
+func TestProfiler_Environ(t *testing.T) {
+	var p *Profiler
+	assert.Nil(t, p.Environ("stage.build"))
+	assert.Nil(t, New().Environ("stage.build"))
+}
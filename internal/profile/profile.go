@@ -0,0 +1,228 @@
+package profile
+
+import (
+	"encoding/json"
+	"go.opentelemetry.io/otel/trace"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	CategoryRun       = "run"
+	CategoryOrchestra = "orchestra"
+	CategoryImport    = "import"
+	CategoryLocals    = "locals"
+	CategoryGraph     = "graph"
+	CategoryRunnable  = "runnable"
+	CategoryRetry     = "retry"
+	CategoryData      = "data"
+	CategoryMacro     = "macro"
+	CategoryContainer = "container"
+	CategoryScript    = "script"
+	CategoryHook      = "hook"
+)
+
+// TrackOrchestra is the track on which the phases of the orchestrator, which are not
+// associated with a single runnable, are recorded
+const TrackOrchestra = "orchestra"
+
+// Event is a single event in the Chrome trace-event format.
+// See https://docs.google.com/document/d/1CvAClvFfyA5R-PhYUmn5OOQtYMH4h6I0nSsKchNAySU
+type Event struct {
+	Name string         `json:"name"`
+	Cat  string         `json:"cat,omitempty"`
+	Ph   string         `json:"ph"`
+	Ts   int64          `json:"ts"`
+	Dur  int64          `json:"dur,omitempty"`
+	Pid  int            `json:"pid"`
+	Tid  int            `json:"tid"`
+	Args map[string]any `json:"args,omitempty"`
+}
+
+type recorder struct {
+	mu        sync.Mutex
+	start     time.Time
+	events    []Event
+	tracks    map[string]int
+	durations map[string]time.Duration
+
+	// tracing exports the spans to OpenTelemetry, it is nil unless Profiler.Trace was called
+	tracing *tracing
+}
+
+// Profiler records spans for every phase of a pipeline run, and exports them
+// as Chrome trace-event JSON, which can be opened in chrome://tracing or ui.perfetto.dev.
+// A nil Profiler is valid, and records nothing.
+type Profiler struct {
+	recorder *recorder
+	scope    string
+}
+
+func New() *Profiler {
+	return &Profiler{
+		recorder: &recorder{
+			start:     time.Now(),
+			tracks:    make(map[string]int),
+			durations: make(map[string]time.Duration),
+		},
+	}
+}
+
+// Scope returns a Profiler which shares the events of p, but prefixes all the tracks
+// with scope. This is used by modules, so that the runnables of the child pipeline
+// do not collide with the runnables of the parent pipeline
+func (p *Profiler) Scope(scope string) *Profiler {
+	if p == nil {
+		return nil
+	}
+	if p.scope != "" {
+		scope = p.scope + "/" + scope
+	}
+	return &Profiler{recorder: p.recorder, scope: scope}
+}
+
+func (p *Profiler) track(name string) string {
+	if p.scope == "" {
+		return name
+	}
+	return p.scope + "/" + name
+}
+
+// Start opens a new span on the given track. The span is recorded when Span.End is called
+func (p *Profiler) Start(category string, track string, name string) *Span {
+	if p == nil {
+		return nil
+	}
+	span := &Span{
+		recorder: p.recorder,
+		category: category,
+		track:    p.track(track),
+		name:     name,
+		start:    time.Now(),
+	}
+	p.recorder.mu.Lock()
+	t := p.recorder.tracing
+	p.recorder.mu.Unlock()
+	if t != nil {
+		span.otel = t.start(p, category, track, name, span.start)
+	}
+	return span
+}
+
+// Durations returns the wall time of every runnable recorded with CategoryRunnable,
+// keyed by the runnable identifier
+func (p *Profiler) Durations() map[string]time.Duration {
+	if p == nil {
+		return nil
+	}
+	p.recorder.mu.Lock()
+	defer p.recorder.mu.Unlock()
+	durations := make(map[string]time.Duration, len(p.recorder.durations))
+	for k, v := range p.recorder.durations {
+		durations[k] = v
+	}
+	return durations
+}
+
+// Events returns the recorded events, including the metadata events naming each track
+func (p *Profiler) Events() []Event {
+	if p == nil {
+		return nil
+	}
+	r := p.recorder
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	events := make([]Event, 0, len(r.events)+len(r.tracks)+1)
+	events = append(events, Event{
+		Name: "process_name",
+		Ph:   "M",
+		Pid:  1,
+		Args: map[string]any{"name": "togomak"},
+	})
+	for name, tid := range r.tracks {
+		events = append(events, Event{
+			Name: "thread_name",
+			Ph:   "M",
+			Pid:  1,
+			Tid:  tid,
+			Args: map[string]any{"name": name},
+		})
+	}
+	events = append(events, r.events...)
+	return events
+}
+
+// Write writes the recorded events to path as Chrome trace-event JSON
+func (p *Profiler) Write(path string) error {
+	data, err := json.Marshal(map[string]any{
+		"traceEvents":     p.Events(),
+		"displayTimeUnit": "ms",
+	})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Span is an in-flight measurement started by Profiler.Start.
+// A nil Span is valid, and records nothing.
+type Span struct {
+	recorder *recorder
+	category string
+	track    string
+	name     string
+	start    time.Time
+	args     map[string]any
+
+	// otel is the OpenTelemetry span, it is nil unless the Profiler is traced
+	otel trace.Span
+}
+
+// SetArg attaches additional information to the span, which is shown
+// in the trace viewer when the span is selected
+func (s *Span) SetArg(key string, value any) *Span {
+	if s == nil {
+		return nil
+	}
+	if s.args == nil {
+		s.args = make(map[string]any)
+	}
+	s.args[key] = value
+	if s.otel != nil {
+		s.otel.SetAttributes(attributeOf(key, value))
+	}
+	return s
+}
+
+// End closes the span and records it
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	end := time.Now()
+	s.endOtel(end)
+	r := s.recorder
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tid, ok := r.tracks[s.track]
+	if !ok {
+		tid = len(r.tracks) + 1
+		r.tracks[s.track] = tid
+	}
+	r.events = append(r.events, Event{
+		Name: s.name,
+		Cat:  s.category,
+		Ph:   "X",
+		Ts:   s.start.Sub(r.start).Microseconds(),
+		Dur:  end.Sub(s.start).Microseconds(),
+		Pid:  1,
+		Tid:  tid,
+		Args: s.args,
+	})
+	if s.category == CategoryRunnable {
+		r.durations[s.track] = end.Sub(s.start)
+	}
+}
@@ -0,0 +1,86 @@
+package profile
+
+import (
+	"encoding/json"
+	"github.com/kendru/darwin/go/depgraph"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestProfiler_Nil(t *testing.T) {
+	var p *Profiler
+	p.Start(CategoryScript, "stage.build", "script").SetArg("k", "v").End()
+	if p.Scope("module.x") != nil {
+		t.Error("Scope() on a nil profiler should return nil")
+	}
+	if len(p.Events()) != 0 {
+		t.Error("Events() on a nil profiler should be empty")
+	}
+}
+
+func TestProfiler_Scope(t *testing.T) {
+	p := New()
+	p.Scope("module.api").Start(CategoryRunnable, "stage.build", "stage.build").End()
+	p.Start(CategoryRunnable, "stage.build", "stage.build").End()
+
+	durations := p.Durations()
+	if _, ok := durations["module.api/stage.build"]; !ok {
+		t.Error("scoped runnable should be recorded under the scope")
+	}
+	if _, ok := durations["stage.build"]; !ok {
+		t.Error("unscoped runnable should be recorded without a scope")
+	}
+}
+
+func TestProfiler_Write(t *testing.T) {
+	p := New()
+	p.Start(CategoryGraph, TrackOrchestra, "generate dependency graph").End()
+	path := filepath.Join(t.TempDir(), "trace.json")
+	if err := p.Write(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var trace struct {
+		TraceEvents []Event `json:"traceEvents"`
+	}
+	if err := json.Unmarshal(data, &trace); err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, e := range trace.TraceEvents {
+		if e.Name == "generate dependency graph" && e.Ph == "X" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("the recorded span was not written to the trace")
+	}
+}
+
+func TestProfiler_CriticalPath(t *testing.T) {
+	g := depgraph.New()
+	_ = g.DependOn("stage.b", "stage.a")
+	_ = g.DependOn("stage.c", "stage.a")
+	_ = g.DependOn("togomak.post", "stage.b")
+	_ = g.DependOn("togomak.post", "stage.c")
+
+	p := New()
+	p.recorder.durations = map[string]time.Duration{
+		"stage.a": 2 * time.Second,
+		"stage.b": 1 * time.Second,
+		"stage.c": 5 * time.Second,
+	}
+
+	path, total := p.CriticalPath(g)
+	if total != 7*time.Second {
+		t.Errorf("expected the critical path to take 7s, got %s", total)
+	}
+	if len(path) != 2 || path[0].Id != "stage.a" || path[1].Id != "stage.c" {
+		t.Errorf("expected stage.a → stage.c, got %v", path)
+	}
+}
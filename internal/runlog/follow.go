@@ -0,0 +1,99 @@
+package runlog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// follower reads the lines appended to the log file of a stage
+type follower struct {
+	offset  int64
+	partial []byte
+}
+
+// read returns the complete lines appended to path since the last read. If final is set,
+// the last line is returned even if it does not end with a newline
+func (f *follower) read(path string, final bool) ([]byte, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(f.offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	f.offset += int64(len(data))
+	data = append(f.partial, data...)
+	f.partial = nil
+
+	i := bytes.LastIndexByte(data, '\n')
+	if final {
+		if len(data) != 0 && i != len(data)-1 {
+			data = append(data, '\n')
+		}
+		return data, nil
+	}
+	f.partial = append([]byte(nil), data[i+1:]...)
+	return data[:i+1], nil
+}
+
+// Follow writes the logs of the stages of the run which match query, see Matches, to w as they
+// are written, every interval, until the run finishes or ctx is cancelled. If prefix is set,
+// each line is prefixed with the address of its stage
+func Follow(ctx context.Context, root string, id string, query string, w io.Writer, prefix bool, interval time.Duration) error {
+	followers := make(map[string]*follower)
+	for {
+		run, err := Load(root, id)
+		if err != nil {
+			return err
+		}
+		// the run is checked before reading the logs, so that the
+		// lines written before it finished are always read
+		alive := run.Alive()
+		for _, address := range run.Match(query) {
+			f, ok := followers[address]
+			if !ok {
+				f = &follower{}
+				followers[address] = f
+			}
+			data, err := f.read(filepath.Join(root, id, LogFileName(address)), !alive)
+			if err != nil {
+				return err
+			}
+			if !prefix {
+				_, err = w.Write(data)
+			} else {
+				for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+					if len(line) != 0 {
+						_, err = fmt.Fprintf(w, "%s | %s", address, line)
+					}
+				}
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if !alive {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
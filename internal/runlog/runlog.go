@@ -0,0 +1,387 @@
+// Package runlog records the output of every stage of a run in .togomak/runs/<run-id>/<address>.log,
+// with the ANSI escape sequences stripped, and reads it back for togomak logs
+package runlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/srevinsaju/togomak/v1/internal/meta"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	StatusRunning = "running"
+	StatusSuccess = "success"
+	StatusFailure = "failure"
+)
+
+const (
+	// IndexFileName is the file in the runs directory which lists the runs, one json object per line
+	IndexFileName = "index.jsonl"
+
+	// RunFileName is the file in the directory of a run with its status, see Run
+	RunFileName = "run.json"
+)
+
+// Dir returns the directory where the runs of the pipeline in dir are recorded
+func Dir(dir string) string {
+	return filepath.Join(dir, meta.BuildDirPrefix, "runs")
+}
+
+// Run is the record of a single run of the pipeline
+type Run struct {
+	Id       string     `json:"id"`
+	Pipeline string     `json:"pipeline"`
+	Pid      int        `json:"pid"`
+	Started  time.Time  `json:"started"`
+	Finished *time.Time `json:"finished,omitempty"`
+	Status   string     `json:"status"`
+
+	// Stages are the statuses of the stages which wrote a log, by their address
+	Stages map[string]string `json:"stages,omitempty"`
+
+	// Outputs are the values of the output blocks of the pipeline, by their name
+	Outputs map[string]Output `json:"outputs,omitempty"`
+}
+
+// Output is the value of an output block, with its type, both encoded as
+// cty json. The sensitive values are recorded as is, and only hidden when shown
+type Output struct {
+	Value       json.RawMessage `json:"value"`
+	Type        json.RawMessage `json:"type"`
+	Sensitive   bool            `json:"sensitive,omitempty"`
+	Description string          `json:"description,omitempty"`
+}
+
+// Alive reports if the run is still running. A run which did not finish, because
+// its process was killed, is not alive
+func (r Run) Alive() bool {
+	if r.Status != StatusRunning {
+		return false
+	}
+	process, err := os.FindProcess(r.Pid)
+	if err != nil {
+		return false
+	}
+	return process.Signal(syscall.Signal(0)) == nil
+}
+
+// Addresses returns the sorted addresses of the stages which wrote a log
+func (r Run) Addresses() []string {
+	var addresses []string
+	for address := range r.Stages {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+// LogFileName returns the name of the log file of the stage with the given address
+func LogFileName(address string) string {
+	return strings.NewReplacer("/", "_", "\\", "_").Replace(address) + ".log"
+}
+
+func newId(now time.Time) string {
+	return fmt.Sprintf("%s-%s", now.Format("20060102-150405"), uuid.New().String()[:8])
+}
+
+// indexEntry is a line of the index, the status of the run is only recorded in its own directory
+type indexEntry struct {
+	Id       string    `json:"id"`
+	Pipeline string    `json:"pipeline"`
+	Started  time.Time `json:"started"`
+}
+
+type recorder struct {
+	mu  sync.Mutex
+	dir string
+	run Run
+
+	// attempts are the number of times each stage was run, by their address
+	attempts map[string]int
+}
+
+// Recorder records the logs of the stages of a run.
+// A nil Recorder is valid, and records nothing.
+type Recorder struct {
+	recorder *recorder
+	scope    string
+}
+
+// Start creates the directory of a new run of pipeline in root, see Dir, and adds it to the index
+func Start(root string, pipeline string) (*Recorder, error) {
+	now := time.Now()
+	r := &recorder{
+		attempts: make(map[string]int),
+		run: Run{
+			Id:       newId(now),
+			Pipeline: pipeline,
+			Pid:      os.Getpid(),
+			Started:  now,
+			Status:   StatusRunning,
+			Stages:   make(map[string]string),
+		},
+	}
+	r.dir = filepath.Join(root, r.run.Id)
+	if err := os.MkdirAll(r.dir, 0755); err != nil {
+		return nil, err
+	}
+	if err := r.write(); err != nil {
+		return nil, err
+	}
+
+	index, err := os.OpenFile(filepath.Join(root, IndexFileName), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer index.Close()
+	line, err := json.Marshal(indexEntry{Id: r.run.Id, Pipeline: pipeline, Started: now})
+	if err != nil {
+		return nil, err
+	}
+	_, err = index.Write(append(line, '\n'))
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{recorder: r}, nil
+}
+
+// write writes run.json, through a temporary file, so that it is never read partially written
+func (r *recorder) write() error {
+	data, err := json.MarshalIndent(r.run, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(r.dir, RunFileName+".tmp")
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(r.dir, RunFileName))
+}
+
+// Id returns the id of the run
+func (r *Recorder) Id() string {
+	if r == nil {
+		return ""
+	}
+	return r.recorder.run.Id
+}
+
+// Dir returns the directory of the run
+func (r *Recorder) Dir() string {
+	if r == nil {
+		return ""
+	}
+	return r.recorder.dir
+}
+
+// Scope returns a Recorder which writes to the same run, but prefixes the addresses
+// of the stages with scope. This is used by modules, so that the stages of the child
+// pipeline do not collide with the stages of the parent pipeline
+func (r *Recorder) Scope(scope string) *Recorder {
+	if r == nil {
+		return nil
+	}
+	if r.scope != "" {
+		scope = r.scope + "." + scope
+	}
+	return &Recorder{recorder: r.recorder, scope: scope}
+}
+
+func (r *Recorder) address(address string) string {
+	if r.scope == "" {
+		return address
+	}
+	return r.scope + "." + address
+}
+
+// Stage opens the log file of the stage with the given address. The writer strips
+// the ANSI escape sequences, and must be closed when the stage finishes. When the
+// stage is retried, the output of each attempt is appended after a header
+func (r *Recorder) Stage(address string) (io.WriteCloser, error) {
+	if r == nil {
+		return nil, nil
+	}
+	address = r.address(address)
+	r.recorder.mu.Lock()
+	defer r.recorder.mu.Unlock()
+	f, err := os.OpenFile(filepath.Join(r.recorder.dir, LogFileName(address)), os.O_CREATE|os.O_APPEND|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	r.recorder.attempts[address]++
+	if attempt := r.recorder.attempts[address]; attempt > 1 {
+		if err := writeAttemptHeader(f, attempt); err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+	}
+	r.recorder.run.Stages[address] = StatusRunning
+	return &stripWriter{w: f}, r.recorder.write()
+}
+
+// writeAttemptHeader writes the header of the attempt to the log file f, on its own line
+func writeAttemptHeader(f *os.File, attempt int) error {
+	header := fmt.Sprintf("--- attempt %d ---\n", attempt)
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, info.Size()-1); err != nil {
+			return err
+		}
+		if last[0] != '\n' {
+			header = "\n" + header
+		}
+	}
+	_, err = f.WriteString(header)
+	return err
+}
+
+// Finish records the status of the stage with the given address
+func (r *Recorder) Finish(address string, failed bool) error {
+	if r == nil {
+		return nil
+	}
+	status := StatusSuccess
+	if failed {
+		status = StatusFailure
+	}
+	r.recorder.mu.Lock()
+	defer r.recorder.mu.Unlock()
+	r.recorder.run.Stages[r.address(address)] = status
+	return r.recorder.write()
+}
+
+// SetOutputs records the values of the output blocks of the pipeline. The outputs
+// of the modules are not recorded, only those of the pipeline of the run
+func (r *Recorder) SetOutputs(outputs map[string]Output) error {
+	if r == nil || r.scope != "" {
+		return nil
+	}
+	r.recorder.mu.Lock()
+	defer r.recorder.mu.Unlock()
+	r.recorder.run.Outputs = outputs
+	return r.recorder.write()
+}
+
+// Close records the status of the run
+func (r *Recorder) Close(failed bool) error {
+	if r == nil {
+		return nil
+	}
+	now := time.Now()
+	r.recorder.mu.Lock()
+	defer r.recorder.mu.Unlock()
+	r.recorder.run.Finished = &now
+	r.recorder.run.Status = StatusSuccess
+	if failed {
+		r.recorder.run.Status = StatusFailure
+	}
+	return r.recorder.write()
+}
+
+// Load reads the record of the run with the given id
+func Load(root string, id string) (Run, error) {
+	var run Run
+	data, err := os.ReadFile(filepath.Join(root, id, RunFileName))
+	if err != nil {
+		return run, err
+	}
+	err = json.Unmarshal(data, &run)
+	return run, err
+}
+
+// List returns the runs in the index, oldest first. The runs whose directory was removed are skipped
+func List(root string) ([]Run, error) {
+	f, err := os.Open(filepath.Join(root, IndexFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var runs []Run
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry indexEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		run, err := Load(root, entry.Id)
+		if err != nil {
+			continue
+		}
+		runs = append(runs, run)
+	}
+	return runs, scanner.Err()
+}
+
+// Find returns the run whose id is, or starts with, query. An empty query, or latest,
+// returns the latest run
+func Find(root string, query string) (Run, error) {
+	runs, err := List(root)
+	if err != nil {
+		return Run{}, err
+	}
+	if len(runs) == 0 {
+		return Run{}, fmt.Errorf("no runs were recorded in %s", root)
+	}
+	if query == "" || query == "latest" {
+		return runs[len(runs)-1], nil
+	}
+	var found []Run
+	for _, run := range runs {
+		if run.Id == query {
+			return run, nil
+		}
+		if strings.HasPrefix(run.Id, query) {
+			found = append(found, run)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return Run{}, fmt.Errorf("no run matches %s", query)
+	case 1:
+		return found[0], nil
+	}
+	return Run{}, fmt.Errorf("%d runs match %s, use a longer prefix of the run id", len(found), query)
+}
+
+// Matches reports if the address of a stage matches query, which is either the address of the
+// stage, its name, or the address of a module with all the stages in it. An empty query matches all the stages
+func Matches(address string, query string) bool {
+	if query == "" {
+		return true
+	}
+	for _, q := range []string{query, "stage." + query} {
+		if address == q || strings.HasPrefix(address, q+".") || strings.HasPrefix(address, q+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+// Match returns the addresses of the stages of run which match query, see Matches
+func (r Run) Match(query string) []string {
+	var addresses []string
+	for _, address := range r.Addresses() {
+		if Matches(address, query) {
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses
+}
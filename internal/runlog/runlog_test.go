@@ -0,0 +1,97 @@
+package runlog
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecorder(t *testing.T) {
+	root := t.TempDir()
+	r, err := Start(root, "togomak.hcl")
+	assert.NoError(t, err)
+
+	w, err := r.Stage("stage.build")
+	assert.NoError(t, err)
+	_, _ = w.Write([]byte("\x1b[31mcomp"))
+	_, _ = w.Write([]byte("iling\x1b[0m\ndone"))
+
+	run, err := Load(root, r.Id())
+	assert.NoError(t, err)
+	assert.True(t, run.Alive())
+	assert.Equal(t, map[string]string{"stage.build": StatusRunning}, run.Stages)
+
+	assert.NoError(t, w.Close())
+	assert.NoError(t, r.Finish("stage.build", false))
+
+	module := r.Scope("module.api")
+	w, err = module.Stage("stage.build")
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	assert.NoError(t, module.Finish("stage.build", true))
+	assert.NoError(t, module.SetOutputs(map[string]Output{"ignored": {Value: []byte(`"1.0"`), Type: []byte(`"string"`)}}))
+	assert.NoError(t, r.SetOutputs(map[string]Output{"version": {Value: []byte(`"1.2.3"`), Type: []byte(`"string"`)}}))
+	assert.NoError(t, r.Close(true))
+
+	data, err := os.ReadFile(filepath.Join(r.Dir(), "stage.build.log"))
+	assert.NoError(t, err)
+	assert.Equal(t, "compiling\ndone", string(data))
+
+	run, err = Find(root, "latest")
+	assert.NoError(t, err)
+	assert.Equal(t, r.Id(), run.Id)
+	assert.Equal(t, StatusFailure, run.Status)
+	assert.False(t, run.Alive())
+	assert.NotNil(t, run.Finished)
+	assert.Len(t, run.Outputs, 1)
+	assert.JSONEq(t, `"1.2.3"`, string(run.Outputs["version"].Value))
+	assert.Equal(t, []string{"module.api.stage.build", "stage.build"}, run.Addresses())
+	assert.Equal(t, []string{"stage.build"}, run.Match("build"))
+	assert.Equal(t, []string{"module.api.stage.build"}, run.Match("module.api"))
+
+	_, err = Find(root, "does-not-exist")
+	assert.Error(t, err)
+
+	var out bytes.Buffer
+	err = Follow(context.Background(), root, run.Id, "", &out, true, time.Millisecond)
+	assert.NoError(t, err)
+	assert.Equal(t, "stage.build | compiling\nstage.build | done\n", out.String())
+}
+
+func TestRecorder_Retry(t *testing.T) {
+	r, err := Start(t.TempDir(), "togomak.hcl")
+	assert.NoError(t, err)
+
+	// the output of the earlier attempts is kept
+	for _, attempt := range []string{"first", "second\n", "third"} {
+		w, err := r.Stage("stage.test")
+		assert.NoError(t, err)
+		_, _ = w.Write([]byte(attempt))
+		assert.NoError(t, w.Close())
+	}
+	data, err := os.ReadFile(filepath.Join(r.Dir(), "stage.test.log"))
+	assert.NoError(t, err)
+	assert.Equal(t, "first\n--- attempt 2 ---\nsecond\n--- attempt 3 ---\nthird", string(data))
+}
+
+func TestList(t *testing.T) {
+	root := t.TempDir()
+	runs, err := List(root)
+	assert.NoError(t, err)
+	assert.Empty(t, runs)
+
+	first, err := Start(root, "togomak.hcl")
+	assert.NoError(t, err)
+	second, err := Start(root, "togomak.hcl")
+	assert.NoError(t, err)
+	assert.NoError(t, os.RemoveAll(first.Dir()))
+
+	runs, err = List(root)
+	assert.NoError(t, err)
+	assert.Len(t, runs, 1)
+	assert.Equal(t, second.Id(), runs[0].Id)
+}
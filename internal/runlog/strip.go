@@ -0,0 +1,45 @@
+package runlog
+
+import (
+	"bytes"
+	"github.com/acarl005/stripansi"
+	"io"
+	"sync"
+)
+
+// stripWriter strips the ANSI escape sequences of each line before writing it. The lines are
+// buffered, so that an escape sequence split over two writes is stripped too
+type stripWriter struct {
+	mu  sync.Mutex
+	w   io.WriteCloser
+	buf bytes.Buffer
+}
+
+func (s *stripWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buf.Write(p)
+	i := bytes.LastIndexByte(s.buf.Bytes(), '\n')
+	if i < 0 {
+		return len(p), nil
+	}
+	lines := s.buf.Next(i + 1)
+	if _, err := io.WriteString(s.w, stripansi.Strip(string(lines))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close writes the last line, if it does not end with a newline, and closes the file
+func (s *stripWriter) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.buf.Len() != 0 {
+		if _, err := io.WriteString(s.w, stripansi.Strip(s.buf.String())); err != nil {
+			s.w.Close()
+			return err
+		}
+		s.buf.Reset()
+	}
+	return s.w.Close()
+}
@@ -10,6 +10,7 @@ const (
 	StatusTerminated StatusType = "terminated"
 	StatusRunning    StatusType = "running"
 	StatusSkipped    StatusType = "skipped"
+	StatusPending    StatusType = "pending"
 	StatusUnknown    StatusType = "unknown"
 )
 
@@ -0,0 +1,351 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"github.com/acarl005/stripansi"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/srevinsaju/togomak/v1/internal/ci"
+	"github.com/srevinsaju/togomak/v1/internal/runnable"
+	"github.com/srevinsaju/togomak/v1/internal/ui"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxLogs is the number of log lines, which are not the output of a stage, shown below the output pane
+const maxLogs = 4
+
+var spinner = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+type eventMsg ci.RunnableEvent
+
+type logMsg string
+
+type doneMsg struct {
+	failed bool
+}
+
+type tickMsg time.Time
+
+// row is the state of a single stage or module
+type row struct {
+	id       string
+	block    ci.Block
+	status   runnable.StatusType
+	daemon   bool
+	retry    int
+	started  time.Time
+	finished time.Time
+}
+
+func (r *row) elapsed(now time.Time) time.Duration {
+	if r.started.IsZero() {
+		return 0
+	}
+	if r.finished.IsZero() {
+		return now.Sub(r.started).Round(100 * time.Millisecond)
+	}
+	return r.finished.Sub(r.started).Round(100 * time.Millisecond)
+}
+
+// Model is the bubbletea model of the terminal UI. It lists the stages and modules of the
+// pipeline with their status, and shows the output of the selected stage
+type Model struct {
+	rows     []*row
+	index    map[string]*row
+	selected int
+
+	// hideOutput hides the output pane of the selected stage
+	hideOutput bool
+
+	logs []string
+
+	outputs   func() map[string]*ci.OutputStream
+	terminate func(block ci.Block)
+	cancel    context.CancelFunc
+
+	start  time.Time
+	now    time.Time
+	frame  int
+	done   bool
+	failed bool
+
+	width  int
+	height int
+}
+
+// NewModel creates the model of the terminal UI. outputs returns the output streams of the
+// stages, terminate terminates a stage, and cancel stops the pipeline when the user quits
+func NewModel(outputs func() map[string]*ci.OutputStream, terminate func(block ci.Block), cancel context.CancelFunc) *Model {
+	now := time.Now()
+	return &Model{
+		index:     make(map[string]*row),
+		outputs:   outputs,
+		terminate: terminate,
+		cancel:    cancel,
+		start:     now,
+		now:       now,
+		width:     80,
+		height:    24,
+	}
+}
+
+func tick() tea.Cmd {
+	return tea.Tick(100*time.Millisecond, func(t time.Time) tea.Msg {
+		return tickMsg(t)
+	})
+}
+
+func (m *Model) Init() tea.Cmd {
+	return tick()
+}
+
+func (m *Model) observe(event ci.RunnableEvent) {
+	r, ok := m.index[event.Id]
+	if !ok {
+		r = &row{id: event.Id}
+		m.index[event.Id] = r
+		m.rows = append(m.rows, r)
+	}
+	r.block = event.Block
+	r.status = event.Status
+	r.daemon = event.Daemon
+	r.retry = event.Retry
+	switch event.Status {
+	case runnable.StatusRunning:
+		if r.started.IsZero() {
+			r.started = event.Time
+		}
+	case runnable.StatusSuccess, runnable.StatusFailure, runnable.StatusTerminated:
+		r.finished = event.Time
+	}
+}
+
+func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case eventMsg:
+		m.observe(ci.RunnableEvent(msg))
+	case logMsg:
+		m.logs = append(m.logs, string(msg))
+		if len(m.logs) > maxLogs {
+			m.logs = m.logs[len(m.logs)-maxLogs:]
+		}
+	case doneMsg:
+		m.done = true
+		m.failed = msg.failed
+		m.now = time.Now()
+	case tickMsg:
+		m.frame++
+		if !m.done {
+			m.now = time.Time(msg)
+		}
+		return m, tick()
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "up", "k":
+			if m.selected > 0 {
+				m.selected--
+			}
+		case "down", "j":
+			if m.selected < len(m.rows)-1 {
+				m.selected++
+			}
+		case "enter", "o":
+			m.hideOutput = !m.hideOutput
+		case "t":
+			if m.selected < len(m.rows) {
+				r := m.rows[m.selected]
+				if r.block != nil && r.status == runnable.StatusRunning {
+					go m.terminate(r.block)
+				}
+			}
+		case "q", "ctrl+c":
+			if !m.done {
+				m.cancel()
+			}
+			return m, tea.Quit
+		}
+	}
+	return m, nil
+}
+
+func (m *Model) icon(r *row) string {
+	switch r.status {
+	case runnable.StatusRunning:
+		frame := spinner[m.frame%len(spinner)]
+		if r.daemon {
+			return ui.Magenta(frame)
+		}
+		return ui.Blue(frame)
+	case runnable.StatusSuccess:
+		return ui.Green("✔")
+	case runnable.StatusFailure:
+		return ui.Red("✖")
+	case runnable.StatusTerminated:
+		return ui.Yellow("■")
+	case runnable.StatusSkipped:
+		return ui.Grey("○")
+	}
+	return ui.Grey("·")
+}
+
+func (m *Model) statusText(r *row) string {
+	status := r.status.String()
+	if r.daemon && r.status == runnable.StatusRunning {
+		status = "daemon"
+	}
+	status = fmt.Sprintf("%-10s", status)
+	switch r.status {
+	case runnable.StatusRunning:
+		if r.daemon {
+			return ui.Magenta(status)
+		}
+		return ui.Blue(status)
+	case runnable.StatusSuccess:
+		return ui.Green(status)
+	case runnable.StatusFailure:
+		return ui.Red(status)
+	case runnable.StatusTerminated:
+		return ui.Yellow(status)
+	}
+	return ui.Grey(status)
+}
+
+func (m *Model) header() string {
+	counts := make(map[runnable.StatusType]int)
+	for _, r := range m.rows {
+		counts[r.status]++
+	}
+	state := ui.Blue("running")
+	if m.done && m.failed {
+		state = ui.Red("failed")
+	} else if m.done {
+		state = ui.Green("finished")
+	}
+	return fmt.Sprintf("%s %s  %d running  %d succeeded  %d failed  %d skipped  %s",
+		ui.Bold("togomak"), state,
+		counts[runnable.StatusRunning], counts[runnable.StatusSuccess],
+		counts[runnable.StatusFailure]+counts[runnable.StatusTerminated], counts[runnable.StatusSkipped],
+		ui.Grey(m.now.Sub(m.start).Round(100*time.Millisecond).String()),
+	)
+}
+
+// output returns the output of the stage with the given address. The stages with
+// for_each write to one stream for each instance, which are concatenated
+func (m *Model) output(id string) string {
+	outputs := m.outputs()
+	var names []string
+	for name := range outputs {
+		if name == id || strings.HasPrefix(name, id+"[") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(outputs[name].String())
+	}
+	return b.String()
+}
+
+// lastLines returns the last n lines of s, each truncated to width
+func lastLines(s string, n int, width int) []string {
+	s = stripansi.Strip(strings.TrimRight(s, "\n"))
+	if s == "" || n <= 0 {
+		return nil
+	}
+	lines := strings.Split(s, "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	for i, line := range lines {
+		// only the text after the last carriage return is visible on a terminal
+		if j := strings.LastIndex(line, "\r"); j >= 0 {
+			line = line[j+1:]
+		}
+		if runes := []rune(line); len(runes) > width {
+			line = string(runes[:width])
+		}
+		lines[i] = line
+	}
+	return lines
+}
+
+func (m *Model) View() string {
+	var b strings.Builder
+	b.WriteString(m.header())
+	b.WriteString("\n\n")
+
+	// the list takes at most half of the screen when the output is shown,
+	// and is scrolled to keep the selected row visible
+	listHeight := len(m.rows)
+	maxListHeight := m.height - 4 - len(m.logs)
+	if !m.hideOutput {
+		maxListHeight = m.height / 2
+	}
+	if maxListHeight < 1 {
+		maxListHeight = 1
+	}
+	if listHeight > maxListHeight {
+		listHeight = maxListHeight
+	}
+	first := 0
+	if m.selected >= listHeight {
+		first = m.selected - listHeight + 1
+	}
+
+	width := 0
+	for _, r := range m.rows {
+		if len(r.id) > width {
+			width = len(r.id)
+		}
+	}
+	for i := first; i < first+listHeight && i < len(m.rows); i++ {
+		r := m.rows[i]
+		cursor := " "
+		id := fmt.Sprintf("%-*s", width, r.id)
+		if i == m.selected {
+			cursor = ui.Bold(">")
+			id = ui.Bold(id)
+		}
+		line := fmt.Sprintf("%s %s %s  %s", cursor, m.icon(r), id, m.statusText(r))
+		if elapsed := r.elapsed(m.now); elapsed != 0 {
+			line = fmt.Sprintf("%s %s", line, ui.Grey(elapsed.String()))
+		}
+		if r.retry != 0 {
+			line = fmt.Sprintf("%s %s", line, ui.Yellow(fmt.Sprintf("retry %d", r.retry)))
+		}
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+
+	if !m.hideOutput && m.selected < len(m.rows) {
+		id := m.rows[m.selected].id
+		b.WriteString(ui.Grey(fmt.Sprintf("── %s ", id)))
+		b.WriteString("\n")
+		outputHeight := m.height - listHeight - 6 - len(m.logs)
+		for _, line := range lastLines(m.output(id), outputHeight, m.width) {
+			b.WriteString(line)
+			b.WriteString("\n")
+		}
+	}
+
+	if len(m.logs) != 0 {
+		b.WriteString("\n")
+		for _, line := range m.logs {
+			b.WriteString(line)
+			b.WriteString("\n")
+		}
+	}
+
+	help := "↑/↓ select • enter output • t terminate • q quit"
+	if m.done {
+		help = "↑/↓ select • enter output • q quit"
+	}
+	b.WriteString("\n")
+	b.WriteString(ui.Grey(help))
+	return b.String()
+}
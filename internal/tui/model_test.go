@@ -0,0 +1,56 @@
+package tui
+
+import (
+	"github.com/acarl005/stripansi"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/srevinsaju/togomak/v1/internal/ci"
+	"github.com/srevinsaju/togomak/v1/internal/runnable"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestModel(t *testing.T) {
+	build := &ci.Stage{Id: "build"}
+	test := &ci.Stage{Id: "test"}
+	output := &ci.OutputStream{}
+	_, _ = output.Write([]byte("compiling\ndone\n"))
+	outputs := func() map[string]*ci.OutputStream {
+		return map[string]*ci.OutputStream{"stage.build": output}
+	}
+	terminated := make(chan ci.Block, 1)
+	cancelled := false
+	m := NewModel(outputs, func(block ci.Block) { terminated <- block }, func() { cancelled = true })
+
+	now := time.Now()
+	m.Update(eventMsg{Id: "stage.build", Block: build, Status: runnable.StatusPending, Time: now})
+	m.Update(eventMsg{Id: "stage.test", Block: test, Status: runnable.StatusPending, Time: now})
+	m.Update(eventMsg{Id: "stage.build", Block: build, Status: runnable.StatusRunning, Time: now})
+	m.Update(eventMsg{Id: "stage.test", Block: test, Status: runnable.StatusRunning, Retry: 2, Time: now})
+
+	view := stripansi.Strip(m.View())
+	assert.Contains(t, view, "2 running")
+	assert.Contains(t, view, "stage.test   running")
+	assert.Contains(t, view, "retry 2")
+	assert.Contains(t, view, "── stage.build")
+	assert.Contains(t, view, "compiling\ndone\n")
+
+	m.Update(tea.KeyMsg{Type: tea.KeyDown})
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("t")})
+	assert.Equal(t, test, <-terminated)
+
+	m.Update(eventMsg{Id: "stage.build", Block: build, Status: runnable.StatusSuccess, Time: now.Add(time.Second)})
+	view = stripansi.Strip(m.View())
+	assert.Contains(t, view, "stage.build  success    1s")
+
+	_, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("q")})
+	assert.True(t, cancelled)
+	assert.NotNil(t, cmd)
+}
+
+func TestLastLines(t *testing.T) {
+	assert.Equal(t, []string{"c", "d"}, lastLines("a\nb\nc\nd\n", 2, 80))
+	assert.Equal(t, []string{"100%"}, lastLines("10%\r50%\r100%", 1, 80))
+	assert.Equal(t, []string{"abc"}, lastLines("\x1b[31mabcdef\x1b[0m", 1, 3))
+	assert.Nil(t, lastLines("", 2, 80))
+}
@@ -0,0 +1,81 @@
+// Package tui is the interactive terminal UI of togomak run, which shows the live state of
+// the stages and modules of the pipeline, and the output of the selected stage
+package tui
+
+import (
+	"context"
+	"fmt"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sirupsen/logrus"
+	"github.com/srevinsaju/togomak/v1/internal/ci"
+	"github.com/srevinsaju/togomak/v1/internal/ui"
+	"strings"
+)
+
+// UI runs the terminal UI. It observes the runnables of the conductor, see ci.Observer,
+// and the log entries which are not written by a stage or a module, as a logrus.Hook
+type UI struct {
+	program *tea.Program
+}
+
+func New(conductor *ci.Conductor, cancel context.CancelFunc) *UI {
+	model := NewModel(conductor.Outputs, func(block ci.Block) {
+		diags := block.Terminate(nil, true)
+		if diags.HasErrors() {
+			conductor.Logger().Warnf("failed to terminate %s: %s", block.Identifier(), diags.Error())
+		}
+	}, cancel)
+	return &UI{program: tea.NewProgram(model, tea.WithAltScreen())}
+}
+
+// Observe implements ci.Observer
+func (u *UI) Observe(event ci.RunnableEvent) {
+	u.program.Send(eventMsg(event))
+}
+
+// Levels implements logrus.Hook
+func (u *UI) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire implements logrus.Hook. The output of the stages is shown in the output pane, the
+// warnings, errors, and the messages which are not written by a stage or a module are
+// shown below it
+func (u *UI) Fire(entry *logrus.Entry) error {
+	_, stage := entry.Data["stage"]
+	_, module := entry.Data["module"]
+	if (stage || module) && entry.Level > logrus.WarnLevel {
+		return nil
+	}
+	if entry.Level > logrus.InfoLevel || strings.TrimSpace(entry.Message) == "" {
+		return nil
+	}
+
+	message := entry.Message
+	for _, field := range []string{"stage", "module"} {
+		if v, ok := entry.Data[field]; ok {
+			message = fmt.Sprintf("%s: %s", v, message)
+		}
+	}
+	switch entry.Level {
+	case logrus.InfoLevel:
+		message = ui.Grey(message)
+	case logrus.WarnLevel:
+		message = ui.Yellow(message)
+	default:
+		message = ui.Red(message)
+	}
+	u.program.Send(logMsg(message))
+	return nil
+}
+
+// Done tells the UI that the pipeline finished. The UI stays open until the user quits
+func (u *UI) Done(failed bool) {
+	u.program.Send(doneMsg{failed: failed})
+}
+
+// Run runs the UI until the user quits
+func (u *UI) Run() error {
+	_, err := u.program.Run()
+	return err
+}
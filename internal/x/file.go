@@ -10,3 +10,11 @@ func FileExists(path string) bool {
 		return !f.IsDir()
 	}
 }
+
+func IsDir(path string) bool {
+	f, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return f.IsDir()
+}